@@ -3,26 +3,106 @@ package backup
 import (
 	"flag"
 	"fmt"
+	"os"
 
 	"github.com/greenplum-db/gpbackup/utils"
+
+	"github.com/pkg/errors"
 )
 
 var (
-	connection *utils.DBConn
-	logger     *utils.Logger
+	backupManifest *utils.Manifest
+	backupReport   *utils.Report
+	connection     *utils.DBConn
+	logger         *utils.Logger
+	verifyMode     bool
+	workerConns    []*utils.DBConn
 )
 
 var ( // Command-line flags
-	dbname  = flag.String("dbname", "", "The database to be backed up")
-	debug   = flag.Bool("debug", false, "Print verbose and debug log messages")
+	compressionLevel        *int
+	compressionType         *string
+	dbname                  *string
+	debug                   *bool
+	deleteBackupTimestamp   *string
+	dumpDir                 *string
+	encrypt                 *bool
+	encryptionKeyFile       *string
+	encryptionPassphraseEnv *string
+	excludeSchema           *utils.ArrayFlags
+	excludeTable            *utils.ArrayFlags
+	excludeTableFile        *string
+	includeSchema           *utils.ArrayFlags
+	includeTable            *utils.ArrayFlags
+	includeTableFile        *string
+	incremental             *bool
+	keepDaily               *int
+	keepDays                *int
+	keepLast                *int
+	keepMonthly             *int
+	keepWeekly              *int
+	listBackups             *bool
+	lockTimeout             *int
+	numJobs                 *int
+	pluginConfigFile        *string
+	quiet                   *bool
+	skipLockedTables        *bool
+	timestamp               *string
+	verbose                 *bool
+)
+
+var ( // Schema and table filters, parsed from the filter flags
+	includeSchemas []utils.Schema
+	excludeSchemas []utils.Schema
+	includeTables  []utils.Relation
+	excludeTables  []utils.Relation
+)
+
+/*
+ * Flags are registered here instead of at package initialization so that the
+ * backup and restore packages can be linked into the same test binary without
+ * their flags conflicting.
+ */
+func initializeFlags() {
+	compressionLevel = flag.Int("compression-level", 0, "The compression level to use for table data files.  A level of 0 uses the default level for the compression type.")
+	compressionType = flag.String("compression-type", "", "The program to compress table data files with: gzip, zstd, lz4, or none.  Defaults to gzip if compression-level is set, otherwise none.")
+	dbname = flag.String("dbname", "", "The database to be backed up")
+	debug = flag.Bool("debug", false, "Print verbose and debug log messages")
+	deleteBackupTimestamp = flag.String("delete-backup", "", "Delete the backup with the specified timestamp from the master and every segment, instead of taking a backup")
 	dumpDir = flag.String("dumpdir", "", "The directory to which all dump files will be written")
-	quiet   = flag.Bool("quiet", false, "Suppress non-warning, non-error log messages")
+	encrypt = flag.Bool("encrypt", false, "Encrypt table data files on the segments and metadata files on the master with the key given by encryption-key-file or encryption-passphrase-env.  OpenSSL 1.1.1 or later must be installed on every host in the cluster.")
+	encryptionKeyFile = flag.String("encryption-key-file", "", "A file containing the encryption key.  The file must exist at the same path on every host in the cluster.")
+	encryptionPassphraseEnv = flag.String("encryption-passphrase-env", "", "The name of an environment variable containing the encryption passphrase.  The variable must also be set in the environment of the segments.")
+	excludeSchema = &utils.ArrayFlags{}
+	flag.Var(excludeSchema, "exclude-schema", "Back up all metadata except objects in the specified schema.  This flag can be specified multiple times.")
+	excludeTable = &utils.ArrayFlags{}
+	flag.Var(excludeTable, "exclude-table", "Back up all metadata except the specified table, in schema.table format.  This flag can be specified multiple times.")
+	excludeTableFile = flag.String("exclude-table-file", "", "A file containing a list of tables, in schema.table format and one per line, to exclude from the backup")
+	includeSchema = &utils.ArrayFlags{}
+	flag.Var(includeSchema, "include-schema", "Back up only the specified schema.  This flag can be specified multiple times.")
+	includeTable = &utils.ArrayFlags{}
+	flag.Var(includeTable, "include-table", "Back up only the specified table, in schema.table format.  This flag can be specified multiple times.")
+	includeTableFile = flag.String("include-table-file", "", "A file containing a list of tables, in schema.table format and one per line, to include in the backup")
+	incremental = flag.Bool("incremental", false, "Only back up data for append-optimized tables that have changed since the most recent full backup")
+	keepDaily = flag.Int("keep-daily", 0, "Delete expired backups instead of taking a backup, keeping the most recent backup from each of this many days with backups")
+	keepDays = flag.Int("keep-days", 0, "Delete expired backups instead of taking a backup, keeping the backups taken in this many days")
+	keepLast = flag.Int("keep-last", 0, "Delete expired backups instead of taking a backup, keeping this many of the most recent backups")
+	keepMonthly = flag.Int("keep-monthly", 0, "Delete expired backups instead of taking a backup, keeping the most recent backup from each of this many months with backups")
+	keepWeekly = flag.Int("keep-weekly", 0, "Delete expired backups instead of taking a backup, keeping the most recent backup from each of this many weeks with backups")
+	listBackups = flag.Bool("list-backups", false, "Print the history of backups, or of backups of the database given with --dbname, instead of taking a backup")
+	lockTimeout = flag.Int("lock-timeout", 0, "The number of seconds to wait for the lock on each table before giving up on it.  A timeout of 0 waits indefinitely.")
+	numJobs = flag.Int("jobs", 1, "The number of parallel connections to use when backing up data")
+	pluginConfigFile = flag.String("plugin-config", "", "The config file of a storage plugin to send backup files to, instead of leaving them only on the local disks.  The file must exist at the same path on every host in the cluster.")
+	quiet = flag.Bool("quiet", false, "Suppress non-warning, non-error log messages")
+	skipLockedTables = flag.Bool("skip-locked-tables", false, "Leave tables that cannot be locked out of the backup instead of failing the backup")
+	timestamp = flag.String("timestamp", "", "The timestamp of the backup to be verified, in the format YYYYMMDDHHMMSS.  Only valid with verify.")
 	verbose = flag.Bool("verbose", false, "Print verbose log messages")
-)
+}
 
 // This function handles setup that can be done before parsing flags.
 func DoInit() {
 	SetLogger(utils.InitializeLogging("gpbackup", ""))
+	initializeFlags()
 }
 
 func SetLogger(log *utils.Logger) {
@@ -32,10 +112,105 @@ func SetLogger(log *utils.Logger) {
 /*
 * This function handles argument parsing and validation, e.g. checking that a passed filename exists.
 * It should only validate; initialization with any sort of side effects should go in DoInit or DoSetup.
+*
+* Running "gpbackup verify --timestamp X" checks an existing backup against its
+* checksum file instead of taking a new backup.  The flag package stops parsing
+* at the first non-flag argument, so the verify argument is removed before the
+* flags are parsed.
  */
 func DoValidation() {
-	flag.Parse()
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] == "verify" {
+		verifyMode = true
+		args = args[1:]
+	}
+	flag.CommandLine.Parse(args)
 	utils.CheckExclusiveFlags("debug", "quiet", "verbose")
+	if len(flag.Args()) > 0 {
+		logger.Fatal(errors.Errorf("Unrecognized argument %s", flag.Arg(0)), "")
+	}
+	if verifyMode {
+		utils.CheckMandatoryFlags("timestamp")
+		if !utils.IsValidTimestamp(*timestamp) {
+			logger.Fatal(errors.Errorf("Timestamp %s is invalid.  Timestamps must be in the format YYYYMMDDHHMMSS.", *timestamp), "")
+		}
+		if *pluginConfigFile != "" {
+			logger.Fatal(errors.Errorf("Flag plugin-config cannot be used with verify"), "")
+		}
+	} else if *timestamp != "" {
+		logger.Fatal(errors.Errorf("Flag timestamp can only be used with verify"), "")
+	}
+	numCommands := 0
+	for _, isCommand := range []bool{*listBackups, verifyMode, *deleteBackupTimestamp != "", getRetentionPolicy().IsSet()} {
+		if isCommand {
+			numCommands++
+		}
+	}
+	if numCommands > 1 {
+		logger.Fatal(errors.Errorf("Only one of list-backups, verify, delete-backup, and the keep flags may be used at a time"), "")
+	}
+	if *deleteBackupTimestamp != "" && !utils.IsValidTimestamp(*deleteBackupTimestamp) {
+		logger.Fatal(errors.Errorf("Timestamp %s is invalid.  Timestamps must be in the format YYYYMMDDHHMMSS.", *deleteBackupTimestamp), "")
+	}
+	if *keepLast < 0 || *keepDays < 0 || *keepDaily < 0 || *keepWeekly < 0 || *keepMonthly < 0 {
+		logger.Fatal(errors.Errorf("Flags keep-last, keep-days, keep-daily, keep-weekly, and keep-monthly must be at least 0"), "")
+	}
+	if *numJobs < 1 {
+		logger.Fatal(errors.Errorf("Flag jobs must be at least 1"), "")
+	}
+	if *lockTimeout < 0 {
+		logger.Fatal(errors.Errorf("Flag lock-timeout must be at least 0"), "")
+	}
+	compressionTypeName := utils.GetCompressionTypeName(*compressionType, *compressionLevel)
+	compression, ok := utils.GetCompressionType(compressionTypeName)
+	if !ok {
+		logger.Fatal(errors.Errorf("Compression type %s is not supported", compressionTypeName), "")
+	}
+	if *compressionLevel < 0 || *compressionLevel > compression.MaxLevel {
+		logger.Fatal(errors.Errorf("Flag compression-level must be between 0 and %d for compression type %s", compression.MaxLevel, compressionTypeName), "")
+	}
+	utils.CheckExclusiveFlags("encryption-key-file", "encryption-passphrase-env")
+	if *encrypt && *encryptionKeyFile == "" && *encryptionPassphraseEnv == "" {
+		logger.Fatal(errors.Errorf("Flag encryption-key-file or encryption-passphrase-env must be set when encrypt is set"), "")
+	}
+	if !*encrypt && (*encryptionKeyFile != "" || *encryptionPassphraseEnv != "") {
+		logger.Fatal(errors.Errorf("Flags encryption-key-file and encryption-passphrase-env can only be used with encrypt"), "")
+	}
+	tablesToInclude := *includeTable
+	if *includeTableFile != "" {
+		tablesToInclude = append(tablesToInclude, utils.ReadLinesFromFile(*includeTableFile)...)
+	}
+	tablesToExclude := *excludeTable
+	if *excludeTableFile != "" {
+		tablesToExclude = append(tablesToExclude, utils.ReadLinesFromFile(*excludeTableFile)...)
+	}
+	SetFilters(*includeSchema, *excludeSchema, tablesToInclude, tablesToExclude)
+}
+
+/*
+ * Parses the schema and table names passed to the filter flags.  When any
+ * tables are included, only those tables and the objects that belong to them
+ * (constraints, indexes, rules, triggers, and owned sequences) are backed up,
+ * along with their schemas; otherwise, all objects in the included schemas
+ * that are not in an excluded schema or table are backed up.
+ */
+func SetFilters(inclSchemas []string, exclSchemas []string, inclTables []string, exclTables []string) {
+	includeSchemas = make([]utils.Schema, 0)
+	for _, schema := range inclSchemas {
+		includeSchemas = append(includeSchemas, utils.SchemaFromString(schema))
+	}
+	excludeSchemas = make([]utils.Schema, 0)
+	for _, schema := range exclSchemas {
+		excludeSchemas = append(excludeSchemas, utils.SchemaFromString(schema))
+	}
+	includeTables = make([]utils.Relation, 0)
+	for _, table := range inclTables {
+		includeTables = append(includeTables, utils.RelationFromString(table))
+	}
+	excludeTables = make([]utils.Relation, 0)
+	for _, table := range exclTables {
+		excludeTables = append(excludeTables, utils.RelationFromString(table))
+	}
 }
 
 // This function handles setup that must be done after parsing flags.
@@ -47,11 +222,19 @@ func DoSetup() {
 	} else if *verbose {
 		logger.SetVerbosity(utils.LOGVERBOSE)
 	}
-	connection = utils.NewDBConn(*dbname)
+	connectionDBName := *dbname
+	if !isTakingBackup() && connectionDBName == "" {
+		connectionDBName = "postgres"
+	}
+	connection = utils.NewDBConn(connectionDBName)
 	connection.Connect()
 	connection.Exec("SET application_name TO 'gpbackup'")
+	utils.MakeCancellable(connection)
+	utils.HandleSignals(connection.DBName)
 
-	utils.SetDumpTimestamp("")
+	utils.SetDumpTimestamp(*timestamp)
+	utils.SetCompression(utils.GetCompressionTypeName(*compressionType, *compressionLevel), *compressionLevel)
+	utils.SetEncryption(*encryptionKeyFile, *encryptionPassphraseEnv)
 
 	if *dumpDir != "" {
 		utils.BaseDumpDir = *dumpDir
@@ -59,13 +242,80 @@ func DoSetup() {
 	logger.Verbose("Creating dump directories")
 	segConfig := utils.GetSegmentConfiguration(connection)
 	utils.SetupSegmentConfiguration(segConfig)
+	if !isTakingBackup() {
+		return
+	}
 	utils.CreateDumpDirs()
+	if utils.IsEncrypted() {
+		utils.CheckOpenSSLVersion()
+	}
+	if *pluginConfigFile != "" {
+		utils.Plugin = utils.ReadPluginConfig(*pluginConfigFile)
+		utils.Plugin.CheckPluginVersion()
+		logger.Info("Backup files will be sent to plugin %s", utils.Plugin.ExecutablePath)
+		utils.Plugin.Execute("setup_plugin_for_backup", utils.GetDirForContent(-1))
+	}
 }
 
 func DoBackup() {
+	if *listBackups {
+		printBackupHistory()
+		return
+	}
+	if verifyMode {
+		logger.Info("Verifying backup %s", utils.DumpTimestamp)
+		VerifyBackup(connection)
+		return
+	}
+	if *deleteBackupTimestamp != "" {
+		DeleteBackup(*deleteBackupTimestamp)
+		return
+	}
+	if policy := getRetentionPolicy(); policy.IsSet() {
+		ApplyRetentionPolicy(policy, *dbname)
+		return
+	}
 	logger.Info("Dump Key = %s", utils.DumpTimestamp)
 	logger.Info("Dump Database = %s", utils.QuoteIdent(connection.DBName))
-	logger.Info("Database Size = %s", connection.GetDBSize())
+	databaseSize := connection.GetDBSize()
+	logger.Info("Database Size = %s", databaseSize)
+
+	backupManifest = &utils.Manifest{
+		BackupVersion:    utils.Version,
+		DatabaseName:     connection.DBName,
+		DatabaseVersion:  GetDatabaseVersion(connection),
+		SegmentCount:     len(utils.GetContentList()) - 1,
+		Flags:            utils.GetSetFlags(),
+		CompressionType:  utils.Compression.Name,
+		CompressionLevel: utils.CompressionLevel,
+		Encrypted:        utils.IsEncrypted(),
+		Plugin:           pluginExecutablePath(),
+		Incremental:      *incremental,
+		StartTime:        utils.DumpTimestamp,
+		Status:           utils.BACKUP_STATUS_IN_PROGRESS,
+	}
+	backupReport = &utils.Report{
+		Timestamp:    utils.DumpTimestamp,
+		DatabaseName: connection.DBName,
+		DatabaseSize: databaseSize,
+		Flags:        backupManifest.Flags,
+		StartTime:    utils.System.Now(),
+	}
+	var baseManifest *utils.Manifest
+	if *incremental {
+		baseManifest = GetIncrementalBaseManifest(utils.GetBackupManifests(), connection.DBName, utils.Compression.Name, utils.IsEncrypted(), utils.DumpTimestamp)
+		if baseManifest == nil {
+			encryptionDesc := "unencrypted"
+			if utils.IsEncrypted() {
+				encryptionDesc = "encrypted"
+			}
+			logger.Fatal(errors.Errorf("No complete %s full backup of database %s with compression type %s was found to base an incremental backup on", encryptionDesc, connection.DBName, utils.Compression.Name), "")
+		}
+		logger.Info("Base Backup = %s", baseManifest.StartTime)
+		backupManifest.BaseTimestamp = baseManifest.StartTime
+	}
+	logger.Verbose("Writing manifest file to %s", utils.GetManifestFilePath())
+	utils.WriteManifest(utils.GetManifestFilePath(), backupManifest)
 
 	masterDumpDir := utils.GetDirForContent(-1)
 
@@ -76,165 +326,491 @@ func DoBackup() {
 	connection.Begin()
 	connection.Exec("SET search_path TO pg_catalog")
 
-	tables := GetAllUserTables(connection)
+	var tables []utils.Relation
+	if *numJobs > 1 {
+		tables = setUpWorkerConnections()
+	} else {
+		tables = lockTablesForBackup(connection, GetAllUserTables(connection), "ACCESS SHARE")
+	}
 	extTableMap := GetExternalTablesMap(connection)
+	toc := &utils.TOC{}
 
+	backupReport.StartPhase("global")
 	logger.Info("Writing global database metadata to %s", globalFilename)
-	backupGlobal(globalFilename)
+	backupGlobal(globalFilename, toc)
+	encryptMetadataFile(globalFilename)
 	logger.Info("Global database metadata dump complete")
 
+	backupReport.StartPhase("predata")
 	logger.Info("Writing pre-data metadata to %s", predataFilename)
-	backupPredata(predataFilename, tables, extTableMap)
+	backupPredata(predataFilename, toc, tables, extTableMap)
+	encryptMetadataFile(predataFilename)
 	logger.Info("Pre-data metadata dump complete")
 
+	backupReport.StartPhase("data")
 	logger.Info("Writing data to file")
-	backupData(tables, extTableMap)
+	backupData(tables, extTableMap, baseManifest)
 	logger.Info("Data dump complete")
 
+	backupReport.StartPhase("postdata")
 	logger.Info("Writing post-data metadata to %s", postdataFilename)
-	backupPostdata(postdataFilename, tables, extTableMap)
+	backupPostdata(postdataFilename, toc, tables, extTableMap)
+	encryptMetadataFile(postdataFilename)
 	logger.Info("Post-data metadata dump complete")
+	backupReport.EndPhase()
+
+	logger.Verbose("Writing table of contents file to %s", utils.GetTOCFilePath())
+	utils.WriteTOC(utils.GetTOCFilePath(), toc)
 
 	connection.Commit()
+
+	logger.Verbose("Writing checksum file to %s", utils.GetChecksumFilePath())
+	utils.WriteChecksumFile(utils.GetChecksumFilePath(), GetBackupChecksums(connection, utils.GetMetadataFilePaths()))
+
+	if utils.Plugin != nil {
+		for _, filename := range append(utils.GetMetadataFilePaths(), utils.GetChecksumFilePath()) {
+			utils.Plugin.BackupFile(filename)
+		}
+	}
+
+	backupManifest.EndTime = utils.CurrentTimestamp()
+	backupManifest.Status = utils.BACKUP_STATUS_COMPLETE
+	utils.WriteManifest(utils.GetManifestFilePath(), backupManifest)
+
+	// The manifest is sent last, so that a backup whose other files were not all sent is never marked complete
+	if utils.Plugin != nil {
+		utils.Plugin.BackupFile(utils.GetManifestFilePath())
+		utils.Plugin.Execute("cleanup_plugin_for_backup", utils.GetDirForContent(-1))
+	}
+}
+
+func getRetentionPolicy() RetentionPolicy {
+	return RetentionPolicy{KeepLast: *keepLast, KeepDays: *keepDays, KeepDaily: *keepDaily, KeepWeekly: *keepWeekly, KeepMonthly: *keepMonthly}
 }
 
-func backupGlobal(filename string) {
-	globalFile := utils.MustOpenFile(filename)
+// Listing, verifying, and deleting backups are done instead of taking a backup
+func isTakingBackup() bool {
+	return !*listBackups && !verifyMode && *deleteBackupTimestamp == "" && !getRetentionPolicy().IsSet()
+}
+
+func pluginExecutablePath() string {
+	if utils.Plugin == nil {
+		return ""
+	}
+	return utils.Plugin.ExecutablePath
+}
+
+func encryptMetadataFile(filename string) {
+	if utils.IsEncrypted() {
+		logger.Verbose("Encrypting %s", filename)
+		utils.EncryptFile(filename)
+	}
+}
+
+/*
+ * The history is printed to stdout without any log messages so that it can be
+ * processed by other tools.
+ */
+func printBackupHistory() {
+	entries := utils.ReadHistoryFile(utils.GetHistoryFilePath())
+	if *dbname != "" {
+		dbEntries := make([]utils.HistoryEntry, 0)
+		for _, entry := range entries {
+			if entry.DatabaseName == *dbname {
+				dbEntries = append(dbEntries, entry)
+			}
+		}
+		entries = dbEntries
+	}
+	utils.PrintHistoryEntries(os.Stdout, entries)
+}
+
+/*
+ * Each worker connection used to dump data in parallel has its own transaction, so
+ * to ensure that all of them see the same data as the metadata transaction, a
+ * separate connection holds EXCLUSIVE locks on every table to be dumped, blocking
+ * concurrent writes to them, while the metadata and worker transactions take their
+ * snapshots.  The workers keep ACCESS SHARE locks on the tables until they finish
+ * dumping data, and the metadata connection keeps them until the backup ends, so
+ * the tables cannot be altered or dropped before the post-data metadata is read.
+ * These locks are taken with a timeout even if lock-timeout is not set, as
+ * explained in LockTablesForSnapshot.
+ */
+func setUpWorkerConnections() []utils.Relation {
+	lockConn := utils.NewDBConn(connection.DBName)
+	lockConn.Connect()
+	defer lockConn.Close()
+	lockConn.Exec("SET application_name TO 'gpbackup'")
+	utils.MakeCancellable(lockConn)
+	lockConn.Begin()
+	tables := GetAllUserTables(lockConn)
+	logger.Verbose("Locking %d tables to synchronize snapshots across %d connections", len(tables), *numJobs)
+	tables = lockTablesForBackup(lockConn, tables, "EXCLUSIVE")
+	workerLockTimeout := *lockTimeout
+	if workerLockTimeout == 0 {
+		workerLockTimeout = DEFAULT_WORKER_LOCK_TIMEOUT
+	}
+
+	// A serializable transaction takes its snapshot when its first query runs, not when it begins
+	LockTablesForSnapshot(connection, tables, "The metadata connection", workerLockTimeout)
+	_, err := connection.Exec("SELECT 1")
+	utils.CheckError(err)
+	workerConns = make([]*utils.DBConn, *numJobs)
+	for i := 0; i < *numJobs; i++ {
+		workerConns[i] = utils.NewDBConn(connection.DBName)
+		workerConns[i].Connect()
+		workerConns[i].Exec("SET application_name TO 'gpbackup'")
+		utils.MakeCancellable(workerConns[i])
+		workerConns[i].Begin()
+		LockTablesForSnapshot(workerConns[i], tables, fmt.Sprintf("Worker %d", i), workerLockTimeout)
+		_, err = workerConns[i].Exec("SELECT 1")
+		utils.CheckError(err)
+	}
+
+	lockConn.Commit()
+	return tables
+}
+
+/*
+ * Locking the tables before any data is dumped keeps them from being altered or
+ * dropped partway through the backup.  When a table cannot be locked, the
+ * sessions holding conflicting locks on it are logged so that the user can see
+ * what is blocking the backup.  A table that cannot be locked fails the backup,
+ * unless skip-locked-tables is set, in which case it is added to the excluded
+ * tables so that its metadata is left out of the backup along with its data.
+ */
+func lockTablesForBackup(conn *utils.DBConn, tables []utils.Relation, lockMode string) []utils.Relation {
+	logger.Verbose("Acquiring %s locks on %d tables", lockMode, len(tables))
+	lockErrors := LockTablesWithTimeout(conn, tables, lockMode, *lockTimeout)
+	if len(lockErrors) == 0 {
+		return tables
+	}
+	lockedTables := make([]utils.Relation, 0)
+	for _, table := range tables {
+		lockErr, failed := lockErrors[table.ToString()]
+		if !failed {
+			lockedTables = append(lockedTables, table)
+			continue
+		}
+		logger.Error("Unable to acquire %s lock on table %s: %v", lockMode, table.ToString(), lockErr)
+		for _, holder := range GetLockHolders(conn, table, lockMode) {
+			logger.Error("Table %s is locked in %s by pid %d of user %s running query: %s", table.ToString(), holder.Mode, holder.Pid, holder.UserName, holder.Query)
+		}
+		if *skipLockedTables {
+			logger.Warn("Skipping table %s because it could not be locked", table.ToString())
+			excludeTables = append(excludeTables, table)
+		}
+	}
+	if !*skipLockedTables {
+		logger.Fatal(errors.Errorf("Unable to lock %d of %d tables", len(lockErrors), len(tables)), "")
+	}
+	return lockedTables
+}
+
+func backupGlobal(filename string, toc *utils.TOC) {
+	globalFile := utils.NewFileWithByteCount(utils.MustOpenFile(filename))
 
 	logger.Verbose("Writing session GUCs to global file")
 	gucs := GetSessionGUCs(connection)
+	start := globalFile.ByteCount
 	PrintSessionGUCs(globalFile, gucs)
+	toc.AddGlobalEntry("", "", "SESSION GUCS", "", start, globalFile)
 
 	logger.Verbose("Writing CREATE DATABASE statement to global file")
-	PrintCreateDatabaseStatement(globalFile)
+	databaseOwner := GetDatabaseOwner(connection)
+	databaseEncoding := GetDatabaseEncoding(connection)
+	PrintCreateDatabaseStatement(globalFile, toc, connection.DBName, databaseOwner, databaseEncoding)
 
 	logger.Verbose("Writing database GUCs to global file")
 	databaseGucs := GetDatabaseGUCs(connection)
-	PrintDatabaseGUCs(globalFile, databaseGucs, connection.DBName)
+	PrintDatabaseGUCs(globalFile, toc, databaseGucs, connection.DBName)
 
 	logger.Verbose("Writing database comment to global file")
 	databaseComment := GetDatabaseComment(connection)
-	if databaseComment != "" {
-		utils.MustPrintf(globalFile, "\nCOMMENT ON DATABASE %s IS '%s';\n", connection.DBName, databaseComment)
-	}
+	PrintDatabaseComment(globalFile, toc, databaseComment, connection.DBName)
 
 	logger.Verbose("Writing CREATE RESOURCE QUEUE statements to global file")
 	resQueues := GetResourceQueues(connection)
-	PrintCreateResourceQueueStatements(globalFile, resQueues)
+	PrintCreateResourceQueueStatements(globalFile, toc, resQueues)
 
 	logger.Verbose("Writing CREATE ROLE statements to global file")
 	roles := GetRoles(connection)
-	PrintCreateRoleStatements(globalFile, roles)
+	PrintCreateRoleStatements(globalFile, toc, roles)
 }
 
-func backupPredata(filename string, tables []utils.Relation, extTableMap map[string]bool) {
-	predataFile := utils.MustOpenFile(filename)
+func backupPredata(filename string, toc *utils.TOC, tables []utils.Relation, extTableMap map[string]bool) {
+	predataFile := utils.NewFileWithByteCount(utils.MustOpenFile(filename))
 	PrintConnectionString(predataFile, connection.DBName)
 
 	logger.Verbose("Writing session GUCs to predata file")
 	gucs := GetSessionGUCs(connection)
+	start := predataFile.ByteCount
 	PrintSessionGUCs(predataFile, gucs)
+	toc.AddPredataEntry("", "", "SESSION GUCS", "", start, predataFile)
 
 	logger.Verbose("Writing CREATE SCHEMA statements to predata file")
 	schemas := GetAllUserSchemas(connection)
-	PrintCreateSchemaStatements(predataFile, schemas)
+	if len(includeTables) > 0 {
+		schemas = utils.GetUniqueSchemas(schemas, tables)
+	}
+	PrintCreateSchemaStatements(predataFile, toc, schemas)
+
+	if len(includeTables) == 0 {
+		backupNonTableObjects(predataFile, toc)
+	}
+
+	logger.Verbose("Writing CREATE TABLE statements to predata file")
+	tablesMetadata := GetMetadataForObjectType(connection, "relnamespace", "relacl", "relowner", "pg_class")
+	for _, table := range tables {
+		isExternal := extTableMap[table.ToString()]
+		tableDef := ConstructDefinitionsForTable(connection, table, isExternal)
+		PrintCreateTableStatement(predataFile, toc, table, tableDef, tablesMetadata[table.RelationOid])
+	}
 
+	logger.Verbose("Writing CREATE VIEW statements to predata file")
+	viewDefs := GetViewDefinitions(connection)
+	PrintCreateViewStatements(predataFile, toc, viewDefs)
+
+	logger.Verbose("Writing ADD CONSTRAINT statements to predata file")
+	allConstraints, allFkConstraints := ConstructConstraintsForAllTables(connection, tables)
+	PrintConstraintStatements(predataFile, toc, allConstraints, allFkConstraints)
+
+	logger.Verbose("Writing CREATE SEQUENCE statements to predata file")
+	sequenceDefs := GetAllSequences(connection)
+	sequenceOwners := GetSequenceOwnerMap(connection)
+	PrintCreateSequenceStatements(predataFile, toc, sequenceDefs, sequenceOwners)
+
+}
+
+/*
+ * Types, functions, and the other objects that don't belong to a particular
+ * table are only backed up when no tables are specifically included.
+ */
+func backupNonTableObjects(predataFile *utils.FileWithByteCount, toc *utils.TOC) {
 	types := GetTypeDefinitions(connection)
 	logger.Verbose("Writing CREATE TYPE statements for shell types to predata file")
-	PrintShellTypeStatements(predataFile, types)
+	PrintShellTypeStatements(predataFile, toc, types)
 
 	funcInfoMap := GetFunctionOidToInfoMap(connection)
 	logger.Verbose("Writing CREATE PROCEDURAL LANGUAGE statements to predata file")
 	procLangs := GetProceduralLanguages(connection)
-	PrintCreateLanguageStatements(predataFile, procLangs, funcInfoMap)
+	PrintCreateLanguageStatements(predataFile, toc, procLangs, funcInfoMap)
 
 	logger.Verbose("Writing CREATE TYPE statements for composite and enum types to predata file")
-	PrintCreateCompositeAndEnumTypeStatements(predataFile, types)
+	PrintCreateCompositeAndEnumTypeStatements(predataFile, toc, types)
 
 	logger.Verbose("Writing CREATE FUNCTION statements to predata file")
 	funcDefs := GetFunctionDefinitions(connection)
-	PrintCreateFunctionStatements(predataFile, funcDefs)
+	PrintCreateFunctionStatements(predataFile, toc, funcDefs)
 
 	logger.Verbose("Writing CREATE TYPE statements for base types to predata file")
-	PrintCreateBaseTypeStatements(predataFile, types)
+	PrintCreateBaseTypeStatements(predataFile, toc, types)
 
 	logger.Verbose("Writing CREATE PROTOCOL statements to predata file")
 	protocols := GetExternalProtocols(connection)
-	PrintCreateExternalProtocolStatements(predataFile, protocols, funcInfoMap)
+	PrintCreateExternalProtocolStatements(predataFile, toc, protocols, funcInfoMap)
 
 	logger.Verbose("Writing CREATE AGGREGATE statements to predata file")
 	aggDefs := GetAggregateDefinitions(connection)
-	PrintCreateAggregateStatements(predataFile, aggDefs, funcInfoMap)
+	PrintCreateAggregateStatements(predataFile, toc, aggDefs, funcInfoMap)
 
 	logger.Verbose("Writing CREATE CAST statements to predata file")
 	castDefs := GetCastDefinitions(connection)
-	PrintCreateCastStatements(predataFile, castDefs)
-
-	logger.Verbose("Writing CREATE TABLE statements to predata file")
-	tablesMetadata := GetMetadataForObjectType(connection, "relnamespace", "relacl", "relowner", "pg_class")
-	for _, table := range tables {
-		isExternal := extTableMap[table.ToString()]
-		tableDef := ConstructDefinitionsForTable(connection, table, isExternal)
-		PrintCreateTableStatement(predataFile, table, tableDef, tablesMetadata[table.RelationOid])
-	}
-
-	logger.Verbose("Writing CREATE VIEW statements to predata file")
-	viewDefs := GetViewDefinitions(connection)
-	PrintCreateViewStatements(predataFile, viewDefs)
-
-	logger.Verbose("Writing ADD CONSTRAINT statements to predata file")
-	allConstraints, allFkConstraints := ConstructConstraintsForAllTables(connection, tables)
-	PrintConstraintStatements(predataFile, allConstraints, allFkConstraints)
-
-	logger.Verbose("Writing CREATE SEQUENCE statements to predata file")
-	sequenceDefs := GetAllSequences(connection)
-	sequenceOwners := GetSequenceOwnerMap(connection)
-	PrintCreateSequenceStatements(predataFile, sequenceDefs, sequenceOwners)
-
+	PrintCreateCastStatements(predataFile, toc, castDefs)
 }
 
-func backupData(tables []utils.Relation, extTableMap map[string]bool) {
+/*
+ * The state of every append-optimized table is recorded in the manifest of
+ * each backup, so that any full backup can serve as the base of a later
+ * incremental backup.  If a base manifest is given, the tables that have not
+ * changed since that backup are recorded in the table map without being dumped.
+ */
+func backupData(tables []utils.Relation, extTableMap map[string]bool, baseManifest *utils.Manifest) {
+	// Only tables whose data is actually dumped go in the table map, so restore knows which files to load
+	tablesToDump := make([]utils.Relation, 0)
 	for _, table := range tables {
 		isExternal := extTableMap[table.ToString()]
 		if !isExternal {
-			logger.Verbose("Writing data for table %s to file", table.ToString())
-			dumpFile := GetTableDumpFilePath(table)
-			CopyTableOut(connection, table, dumpFile)
+			tablesToDump = append(tablesToDump, table)
 		} else {
 			logger.Warn("Skipping data dump of table %s because it is an external table.", table.ToString())
 		}
 	}
-	logger.Verbose("Writing table map file to %s", GetTableMapFilePath())
-	WriteTableMapFile(tables)
+
+	tableSizes := GetTableSizes(connection, tablesToDump)
+	backupManifest.TableCount = len(tablesToDump)
+	for _, size := range tableSizes {
+		backupManifest.DataSize += size
+	}
+	aoTableStates := GetAOTableStates(connection, tablesToDump)
+	backupManifest.AOTableStates = aoTableStates
+
+	tablesToCopy := tablesToDump
+	baseTimestamps := make(map[uint32]string, 0)
+	if baseManifest != nil {
+		var unchangedTables []utils.Relation
+		tablesToCopy, unchangedTables = FilterUnchangedAOTables(tablesToDump, aoTableStates, baseManifest)
+		for _, table := range unchangedTables {
+			logger.Verbose("Skipping data dump of table %s because it is unchanged since backup %s", table.ToString(), baseManifest.StartTime)
+			baseTimestamps[table.RelationOid] = baseManifest.StartTime
+		}
+		logger.Info("%d of %d tables are unchanged since backup %s and will not be dumped", len(unchangedTables), len(tablesToDump), baseManifest.StartTime)
+	}
+
+	dataConns := []*utils.DBConn{connection}
+	if len(workerConns) > 0 {
+		dataConns = workerConns
+	}
+	rowCounts, tableErrors := CopyAllTablesOut(dataConns, tablesToCopy, tableSizes)
+	if len(tableErrors) > 0 {
+		for _, table := range tablesToCopy {
+			if err, failed := tableErrors[table.ToString()]; failed {
+				logger.Error("Unable to dump data for table %s: %v", table.ToString(), err)
+			}
+		}
+		logger.Fatal(errors.Errorf("Data dump failed for %d of %d tables", len(tableErrors), len(tablesToCopy)), "")
+	}
+	for _, workerConn := range workerConns {
+		workerConn.Commit()
+	}
+
+	logger.Verbose("Writing table map file to %s", utils.GetTableMapFilePath())
+	WriteTableMapFile(tablesToDump, tableSizes, baseTimestamps)
+	logger.Verbose("Writing row count file to %s", utils.GetRowCountFilePath())
+	WriteRowCountFile(tablesToCopy, rowCounts)
+	if utils.Plugin == nil {
+		backupReport.SegmentSizes = GetSegmentDataSizes(connection)
+	}
 }
 
-func backupPostdata(filename string, tables []utils.Relation, extTableMap map[string]bool) {
-	postdataFile := utils.MustOpenFile(filename)
+func backupPostdata(filename string, toc *utils.TOC, tables []utils.Relation, extTableMap map[string]bool) {
+	postdataFile := utils.NewFileWithByteCount(utils.MustOpenFile(filename))
 	PrintConnectionString(postdataFile, connection.DBName)
 
 	logger.Verbose("Writing session GUCs to predata file")
 	gucs := GetSessionGUCs(connection)
+	start := postdataFile.ByteCount
 	PrintSessionGUCs(postdataFile, gucs)
+	toc.AddPostdataEntry("", "", "SESSION GUCS", "", start, postdataFile)
 
 	logger.Verbose("Writing CREATE INDEX statements to postdata file")
 	indexes := GetIndexesForAllTables(connection, tables)
-	PrintPostdataCreateStatements(postdataFile, indexes)
+	PrintPostdataCreateStatements(postdataFile, toc, indexes)
 
 	logger.Verbose("Writing CREATE RULE statements to postdata file")
 	rules := GetRuleDefinitions(connection)
-	PrintPostdataCreateStatements(postdataFile, rules)
+	PrintPostdataCreateStatements(postdataFile, toc, rules)
 
 	logger.Verbose("Writing CREATE TRIGGER statements to postdata file")
 	triggers := GetTriggerDefinitions(connection)
-	PrintPostdataCreateStatements(postdataFile, triggers)
+	PrintPostdataCreateStatements(postdataFile, toc, triggers)
 }
 
+/*
+ * A run that fails with a fatal error exits with EXIT_FATAL, and a run that
+ * succeeds but logs warnings, such as for skipped tables, exits with
+ * EXIT_WARNINGS, so that scripts running gpbackup can tell them apart.  A
+ * backup stopped by a signal fails like any other, since its queries are
+ * cancelled, but it is recorded as cancelled instead of failed.
+ */
 func DoTeardown() {
-	if r := recover(); r != nil {
+	exitCode := utils.EXIT_SUCCESS
+	r := recover()
+	if r != nil {
 		fmt.Println(r)
+		exitCode = utils.EXIT_FATAL
+		rollBackTransactions()
+		if backupManifest != nil && backupManifest.Status == utils.BACKUP_STATUS_IN_PROGRESS {
+			backupManifest.EndTime = utils.CurrentTimestamp()
+			backupManifest.Status = utils.BACKUP_STATUS_FAILED
+			if utils.WasSignalReceived() {
+				backupManifest.Status = utils.BACKUP_STATUS_CANCELLED
+			}
+			utils.WriteManifest(utils.GetManifestFilePath(), backupManifest)
+			cleanUpFailedBackup()
+		}
+	}
+	if backupManifest != nil {
+		runTeardownStep("append the backup to the history file", func() {
+			utils.AppendHistoryEntry(utils.GetHistoryFilePath(), utils.NewHistoryEntry(backupManifest))
+		})
+	}
+	if backupReport != nil {
+		runTeardownStep("write the report file", func() { writeBackupReport(r) })
 	}
 	if connection != nil {
 		connection.Close()
 	}
-	// TODO: Add logic for error codes based on whether we Abort()ed or not
+	for _, workerConn := range workerConns {
+		workerConn.Close()
+	}
+	if exitCode == utils.EXIT_SUCCESS && logger != nil && len(logger.GetWarnings()) > 0 {
+		exitCode = utils.EXIT_WARNINGS
+	}
+	os.Exit(exitCode)
+}
+
+/*
+ * A panic in DoTeardown would skip the rest of the teardown and exit without
+ * the right exit code, so a step that can fail logs a warning instead.
+ */
+func runTeardownStep(description string, step func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Warn("Unable to %s: %v", description, r)
+		}
+	}()
+	step()
+}
+
+func rollBackTransactions() {
+	if connection != nil {
+		connection.Rollback()
+	}
+	for _, workerConn := range workerConns {
+		workerConn.Rollback()
+	}
+}
+
+/*
+ * The files of a failed backup are removed so that a partial backup never takes
+ * up space or gets restored, leaving only its manifest, which is marked failed,
+ * and its report.  Errors are logged as warnings instead of failing, since the
+ * backup has already failed, and the files on the master are removed even if
+ * the segments cannot be reached.
+ */
+func cleanUpFailedBackup() {
+	logger.Info("Removing files of failed backup %s", utils.DumpTimestamp)
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				logger.Warn("Unable to remove files of failed backup %s on the master: %v", utils.DumpTimestamp, r)
+			}
+		}()
+		DeleteFailedBackupFiles()
+	}()
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				logger.Warn("Unable to remove files of failed backup %s on the segments: %v", utils.DumpTimestamp, r)
+			}
+		}()
+		DeleteSegmentBackupDirectories(utils.DumpTimestamp)
+	}()
+}
+
+/*
+ * The report is written whether or not the backup succeeded, so err is the
+ * value recovered from the panic that failed the backup, if any.
+ */
+func writeBackupReport(err interface{}) {
+	backupReport.EndTime = utils.System.Now()
+	backupReport.TableCount = backupManifest.TableCount
+	backupReport.Status = backupManifest.Status
+	backupReport.Warnings = logger.GetWarnings()
+	if err != nil {
+		backupReport.Error = fmt.Sprintf("%v", err)
+	}
+	logger.Verbose("Writing report file to %s", utils.GetReportFilePath())
+	utils.WriteReportFile(utils.GetReportFilePath(), backupReport)
 }
@@ -0,0 +1,101 @@
+package backup
+
+/*
+ * This file contains functions related to computing the checksums of the files
+ * in a backup and to verifying a backup against the checksums recorded for it.
+ */
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/greenplum-db/gpbackup/utils"
+
+	"github.com/pkg/errors"
+)
+
+/*
+ * The data files are hashed on the segments that hold them, so they never have
+ * to be sent to the master.  Each segment runs sha256sum over its own data files
+ * for the backup and the results are loaded into a temporary table on the master
+ * through COPY FROM PROGRAM.  Errors from sha256sum are discarded so that a
+ * missing directory or file is left out of the results instead of failing the
+ * COPY, so that a backup being verified can report the file as missing.
+ */
+func GetDataFileChecksums(connection *utils.DBConn) map[string]string {
+	hashCommand := fmt.Sprintf(`(cd %s && sha256sum gpbackup_<SEGID>_%s_*) 2>/dev/null | awk '{print $1 "," $2}'`, utils.GetGenericSegDir(), utils.DumpTimestamp)
+	_, err := connection.Exec("CREATE TEMPORARY TABLE gpbackup_checksums (checksum text, filename text) DISTRIBUTED RANDOMLY;")
+	utils.CheckError(err)
+	copyQuery := fmt.Sprintf("COPY gpbackup_checksums FROM PROGRAM '%s' WITH CSV ON SEGMENT;", strings.Replace(hashCommand, "'", "''", -1))
+	_, err = connection.Exec(copyQuery)
+	utils.CheckError(err)
+
+	results := make([]struct {
+		Checksum string
+		Filename string
+	}, 0)
+	err = connection.Select(&results, "SELECT checksum, filename FROM gpbackup_checksums;")
+	utils.CheckError(err)
+	_, err = connection.Exec("DROP TABLE gpbackup_checksums;")
+	utils.CheckError(err)
+
+	checksums := make(map[string]string, 0)
+	for _, result := range results {
+		checksums[result.Filename] = result.Checksum
+	}
+	return checksums
+}
+
+/*
+ * Data files sent to a plugin are not stored on the segments, so only the
+ * metadata files are checksummed when a plugin is in use.
+ */
+func GetBackupChecksums(connection *utils.DBConn, metadataFilePaths []string) *utils.ChecksumManifest {
+	checksums := &utils.ChecksumManifest{
+		MetadataFiles: utils.GetLocalFileChecksums(metadataFilePaths),
+		DataFiles:     map[string]string{},
+	}
+	if utils.Plugin == nil {
+		checksums.DataFiles = GetDataFileChecksums(connection)
+	} else {
+		logger.Warn("Checksums are not recorded for data files sent to a plugin")
+	}
+	return checksums
+}
+
+/*
+ * Every corrupt or missing file is logged before failing, so that a single
+ * run of verify reports all of the problems with a backup.  The metadata files
+ * to checksum are taken from the checksum file rather than from the current
+ * flags, so that an encrypted backup can be verified without its key.
+ */
+func VerifyBackup(connection *utils.DBConn) {
+	checksumFilename := utils.GetChecksumFilePath()
+	if _, err := utils.System.Stat(checksumFilename); err != nil {
+		logger.Fatal(errors.Errorf("Checksum file %s does not exist", checksumFilename), "")
+	}
+	expected := utils.ReadChecksumFile(checksumFilename)
+	metadataFilePaths := make([]string, 0)
+	for filename := range expected.MetadataFiles {
+		metadataFilePaths = append(metadataFilePaths, path.Join(utils.GetDirForContent(-1), filename))
+	}
+	actual := GetBackupChecksums(connection, metadataFilePaths)
+
+	corruptMetadata, missingMetadata := utils.CompareChecksums(expected.MetadataFiles, actual.MetadataFiles)
+	corruptData, missingData := utils.CompareChecksums(expected.DataFiles, actual.DataFiles)
+	corruptFiles := append(corruptMetadata, corruptData...)
+	missingFiles := append(missingMetadata, missingData...)
+	for _, filename := range corruptFiles {
+		logger.Error("File %s is corrupt", filename)
+	}
+	for _, filename := range missingFiles {
+		logger.Error("File %s is missing", filename)
+	}
+
+	numFiles := len(expected.MetadataFiles) + len(expected.DataFiles)
+	if len(corruptFiles) > 0 || len(missingFiles) > 0 {
+		logger.Fatal(errors.Errorf("Backup %s failed verification: %d of %d files are corrupt and %d are missing", utils.DumpTimestamp, len(corruptFiles), numFiles, len(missingFiles)), "")
+	}
+	logger.Info("Backup %s verified successfully: all %d files match their checksums", utils.DumpTimestamp, numFiles)
+}
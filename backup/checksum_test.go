@@ -0,0 +1,108 @@
+package backup_test
+
+import (
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/greenplum-db/gpbackup/backup"
+	"github.com/greenplum-db/gpbackup/testutils"
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+var _ = Describe("backup/checksum tests", func() {
+	var connection *utils.DBConn
+	var mock sqlmock.Sqlmock
+	BeforeEach(func() {
+		connection, mock = testutils.CreateAndConnectMockDB()
+		testutils.SetupTestLogger()
+		testutils.SetDefaultSegmentConfiguration()
+	})
+	AfterEach(func() {
+		utils.System.OpenFile = os.OpenFile
+		utils.System.Stat = os.Stat
+	})
+	expectDataFileChecksums := func(rows *sqlmock.Rows) {
+		mock.ExpectExec(regexp.QuoteMeta("CREATE TEMPORARY TABLE gpbackup_checksums (checksum text, filename text) DISTRIBUTED RANDOMLY;")).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta(`COPY gpbackup_checksums FROM PROGRAM '(cd <SEG_DATA_DIR>/backups/20170101/20170101010101 && sha256sum gpbackup_<SEGID>_20170101010101_*) 2>/dev/null | awk ''{print $1 "," $2}''' WITH CSV ON SEGMENT;`)).WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectQuery("SELECT checksum, filename FROM gpbackup_checksums;").WillReturnRows(rows)
+		mock.ExpectExec("DROP TABLE gpbackup_checksums;").WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+
+	Describe("GetDataFileChecksums", func() {
+		It("returns the checksum of each data file on the segments keyed by file name", func() {
+			rows := sqlmock.NewRows([]string{"checksum", "filename"}).
+				AddRow("1111", "gpbackup_0_20170101010101_3456").
+				AddRow("2222", "gpbackup_1_20170101010101_3456")
+			expectDataFileChecksums(rows)
+			Expect(backup.GetDataFileChecksums(connection)).To(Equal(map[string]string{
+				"gpbackup_0_20170101010101_3456": "1111",
+				"gpbackup_1_20170101010101_3456": "2222",
+			}))
+		})
+	})
+	Describe("VerifyBackup", func() {
+		checksumContents := `{"MetadataFiles": {}, "DataFiles": {"gpbackup_0_20170101010101_3456": "1111", "gpbackup_1_20170101010101_3456": "2222"}}`
+		BeforeEach(func() {
+			r, w, _ := os.Pipe()
+			w.WriteString(checksumContents)
+			w.Close()
+			utils.System.OpenFile = func(name string, flag int, perm os.FileMode) (*os.File, error) { return r, nil }
+			utils.System.Stat = func(name string) (os.FileInfo, error) { return nil, nil }
+		})
+		It("succeeds if every file matches its checksum", func() {
+			rows := sqlmock.NewRows([]string{"checksum", "filename"}).
+				AddRow("1111", "gpbackup_0_20170101010101_3456").
+				AddRow("2222", "gpbackup_1_20170101010101_3456")
+			expectDataFileChecksums(rows)
+			backup.VerifyBackup(connection)
+		})
+		It("reports corrupt and missing files and panics", func() {
+			_, _, stderr, _ := testutils.SetupTestLogger()
+			rows := sqlmock.NewRows([]string{"checksum", "filename"}).
+				AddRow("3333", "gpbackup_0_20170101010101_3456")
+			expectDataFileChecksums(rows)
+			defer func() {
+				Expect(stderr).To(gbytes.Say("File gpbackup_0_20170101010101_3456 is corrupt"))
+				Expect(stderr).To(gbytes.Say("File gpbackup_1_20170101010101_3456 is missing"))
+			}()
+			defer testutils.ShouldPanicWithMessage("Backup 20170101010101 failed verification: 1 of 2 files are corrupt and 1 are missing")
+			backup.VerifyBackup(connection)
+		})
+		It("checksums the metadata files named in the checksum file even if no encryption flags are set", func() {
+			utils.EncryptionPassArg = ""
+			checksumReader, checksumWriter, _ := os.Pipe()
+			checksumWriter.WriteString(`{"MetadataFiles": {"predata.sql.enc": "93fa600274ec99c650f7e6f1b0a9636a7d27a88022da094835143d1dde46e9d0"}, "DataFiles": {}}`)
+			checksumWriter.Close()
+			predataReader, predataWriter, _ := os.Pipe()
+			predataWriter.WriteString("encrypted predata")
+			predataWriter.Close()
+			openedFiles := make([]string, 0)
+			utils.System.OpenFile = func(name string, flag int, perm os.FileMode) (*os.File, error) {
+				openedFiles = append(openedFiles, name)
+				if strings.HasSuffix(name, "predata.sql.enc") {
+					return predataReader, nil
+				}
+				return checksumReader, nil
+			}
+			expectDataFileChecksums(sqlmock.NewRows([]string{"checksum", "filename"}))
+
+			backup.VerifyBackup(connection)
+
+			Expect(openedFiles).To(Equal([]string{
+				"/data/gpseg-1/backups/20170101/20170101010101/gpbackup_20170101010101_checksums.json",
+				"/data/gpseg-1/backups/20170101/20170101010101/predata.sql.enc",
+			}))
+		})
+		It("panics if the checksum file does not exist", func() {
+			utils.System.Stat = func(name string) (os.FileInfo, error) { return nil, os.ErrNotExist }
+			defer testutils.ShouldPanicWithMessage("Checksum file /data/gpseg-1/backups/20170101/20170101010101/gpbackup_20170101010101_checksums.json does not exist")
+			backup.VerifyBackup(connection)
+		})
+	})
+})
@@ -6,31 +6,241 @@ package backup
 
 import (
 	"fmt"
+	"strings"
+	"sync"
 
 	"github.com/greenplum-db/gpbackup/utils"
+
+	"github.com/pkg/errors"
 )
 
 var (
 	tableDelim = ","
 )
 
-func GetTableMapFilePath() string {
-	return fmt.Sprintf("%s/gpbackup_%s_table_map", utils.GetDirForContent(-1), utils.DumpTimestamp)
+func GetTableDumpFilePath(table utils.Relation) string {
+	return utils.GetTableBackupFilePath(table.RelationOid)
 }
 
-func GetTableDumpFilePath(table utils.Relation) string {
-	return fmt.Sprintf("%s/gpbackup_<SEGID>_%s_%d", utils.GetGenericSegDir(), utils.DumpTimestamp, table.RelationOid)
+/*
+ * Each line of the table map file has the form "schema.table: oid size", where
+ * the size in bytes is recorded so that restore can load the largest tables first.
+ * For a table whose data was not dumped because it is unchanged since the base
+ * backup of an incremental backup, the timestamp of that backup is appended.
+ */
+func WriteTableMapFile(tables []utils.Relation, tableSizes map[uint32]int64, baseTimestamps map[uint32]string) {
+	tableMapFile := utils.MustOpenFile(utils.GetTableMapFilePath())
+	for _, table := range tables {
+		utils.MustPrintf(tableMapFile, "%s: %d %d", table.ToString(), table.RelationOid, tableSizes[table.RelationOid])
+		if baseTimestamp, ok := baseTimestamps[table.RelationOid]; ok {
+			utils.MustPrintf(tableMapFile, " %s", baseTimestamp)
+		}
+		utils.MustPrintln(tableMapFile)
+	}
 }
 
-func WriteTableMapFile(tables []utils.Relation) {
-	tableMapFile := utils.MustOpenFile(GetTableMapFilePath())
+/*
+ * Each line of the row count file has the form "schema.table: oid rows", where
+ * the number of rows is the number reported by the COPY that dumped the table,
+ * so that restore can check that every row was loaded back in.  Only tables
+ * whose data was dumped in this backup are included.
+ */
+func WriteRowCountFile(tables []utils.Relation, rowCounts map[uint32]int64) {
+	rowCountFile := utils.MustOpenFile(utils.GetRowCountFilePath())
 	for _, table := range tables {
-		utils.MustPrintf(tableMapFile, "%s: %d\n", table.ToString(), table.RelationOid)
+		if rowCount, ok := rowCounts[table.RelationOid]; ok {
+			utils.MustPrintf(rowCountFile, "%s: %d %d\n", table.ToString(), table.RelationOid, rowCount)
+		}
+	}
+}
+
+/*
+ * The error is returned instead of being handled here because this function
+ * is called from worker goroutines, where a panic could not be recovered by
+ * DoTeardown.  When compression is enabled, each segment pipes its data
+ * through the compression program instead of writing it to the file directly.
+ * The number of rows dumped across all segments is returned on success.
+ */
+func CopyTableOut(connection *utils.DBConn, table utils.Relation, dumpFile string) (int64, error) {
+	query := fmt.Sprintf("COPY %s TO %s WITH CSV DELIMITER '%s' ON SEGMENT;", table.ToString(), utils.GetCopyToTarget(dumpFile), tableDelim)
+	result, err := connection.Exec(query)
+	if err != nil {
+		return 0, err
 	}
+	return result.RowsAffected()
 }
 
-func CopyTableOut(connection *utils.DBConn, table utils.Relation, dumpFile string) {
-	query := fmt.Sprintf("COPY %s TO '%s' WITH CSV DELIMITER '%s' ON SEGMENT;", table.ToString(), dumpFile, tableDelim)
-	_, err := connection.Exec(query)
+/*
+ * Tables are handed out to the connections from a shared queue, so a connection
+ * that finishes a small table moves on to the next one immediately.  A failed
+ * COPY aborts the transaction on that connection, so the connection stops taking
+ * tables while the remaining connections carry on.  The first returned map
+ * contains the number of rows dumped for each table, keyed by the table's oid,
+ * and the second contains an error for each table that was not dumped, keyed
+ * by the table's FQN.  Progress is reported using the sizes in tableSizes.
+ */
+func CopyAllTablesOut(connections []*utils.DBConn, tables []utils.Relation, tableSizes map[uint32]int64) (map[uint32]int64, map[string]error) {
+	tableQueue := make(chan utils.Relation, len(tables))
+	for _, table := range tables {
+		tableQueue <- table
+	}
+	close(tableQueue)
+
+	totalSize := int64(0)
+	for _, table := range tables {
+		totalSize += tableSizes[table.RelationOid]
+	}
+	progress := utils.NewProgressReporter("Backing up data", len(tables), totalSize)
+	progress.Start()
+
+	rowCounts := make(map[uint32]int64, 0)
+	tableErrors := make(map[string]error, 0)
+	var mutex sync.Mutex
+	var waitGroup sync.WaitGroup
+	for _, conn := range connections {
+		waitGroup.Add(1)
+		go func(conn *utils.DBConn) {
+			defer waitGroup.Done()
+			for table := range tableQueue {
+				logger.Verbose("Writing data for table %s to file", table.ToString())
+				progress.StartTable(table.ToString(), tableSizes[table.RelationOid])
+				rowCount, err := CopyTableOut(conn, table, GetTableDumpFilePath(table))
+				progress.FinishTable(table.ToString())
+				mutex.Lock()
+				if err != nil {
+					tableErrors[table.ToString()] = err
+					mutex.Unlock()
+					return
+				}
+				rowCounts[table.RelationOid] = rowCount
+				mutex.Unlock()
+			}
+		}(conn)
+	}
+	waitGroup.Wait()
+	progress.Stop()
+
+	// Any tables still in the queue were never attempted because every connection failed
+	for table := range tableQueue {
+		tableErrors[table.ToString()] = errors.New("Not attempted because all connections encountered errors")
+	}
+	return rowCounts, tableErrors
+}
+
+/*
+ * The sizes of the data files are gathered from the segments that hold them in
+ * the same way as their checksums, through COPY FROM PROGRAM into a temporary
+ * table.  A segment with no data files for the backup is left out.
+ */
+func GetSegmentDataSizes(connection *utils.DBConn) map[int]int64 {
+	sizeCommand := fmt.Sprintf(`(cd %s && du -cb gpbackup_<SEGID>_%s_*) 2>/dev/null | tail -n 1 | awk '{print "<SEGID>," $1}'`, utils.GetGenericSegDir(), utils.DumpTimestamp)
+	_, err := connection.Exec("CREATE TEMPORARY TABLE gpbackup_segment_sizes (segid int, size bigint) DISTRIBUTED RANDOMLY;")
+	utils.CheckError(err)
+	copyQuery := fmt.Sprintf("COPY gpbackup_segment_sizes FROM PROGRAM '%s' WITH CSV ON SEGMENT;", strings.Replace(sizeCommand, "'", "''", -1))
+	_, err = connection.Exec(copyQuery)
 	utils.CheckError(err)
+
+	results := make([]struct {
+		SegID int
+		Size  int64
+	}, 0)
+	err = connection.Select(&results, "SELECT segid, size FROM gpbackup_segment_sizes;")
+	utils.CheckError(err)
+	_, err = connection.Exec("DROP TABLE gpbackup_segment_sizes;")
+	utils.CheckError(err)
+
+	segmentSizes := make(map[int]int64, 0)
+	for _, result := range results {
+		segmentSizes[result.SegID] = result.Size
+	}
+	return segmentSizes
+}
+
+/*
+ * GPDB 5 has no lock_timeout setting, so a timeout is applied with
+ * statement_timeout, which is reset once the tables are locked so that it does
+ * not apply to the rest of the transaction.  A timeout of 0 leaves the setting
+ * alone and waits indefinitely for each lock.  All of the tables are first
+ * locked in a single statement, which is all that is needed unless a table
+ * cannot be locked.  Only then is each table locked in its own savepoint, so
+ * that a lock that is not granted within the timeout rolls back just that
+ * savepoint, the tables locked before it stay locked, and the transaction can
+ * still be used to find the sessions blocking it.  The returned map contains an
+ * error for each table that could not be locked, keyed by the table's FQN.
+ */
+func LockTablesWithTimeout(connection *utils.DBConn, tables []utils.Relation, lockMode string, timeoutSeconds int) map[string]error {
+	if len(tables) == 0 {
+		return map[string]error{}
+	}
+	if timeoutSeconds > 0 {
+		_, err := connection.Exec(fmt.Sprintf("SET statement_timeout TO %d;", timeoutSeconds*1000))
+		utils.CheckError(err)
+	}
+	lockErrors := lockTablesInSavepoints(connection, tables, lockMode)
+	if timeoutSeconds > 0 {
+		_, err := connection.Exec("RESET statement_timeout;")
+		utils.CheckError(err)
+	}
+	return lockErrors
+}
+
+func lockTablesInSavepoints(connection *utils.DBConn, tables []utils.Relation, lockMode string) map[string]error {
+	lockErrors := make(map[string]error, 0)
+	tableList := make([]string, 0)
+	for _, table := range tables {
+		tableList = append(tableList, table.ToString())
+	}
+	_, err := connection.Exec("SAVEPOINT gpbackup_lock;")
+	utils.CheckError(err)
+	_, lockErr := connection.Exec(fmt.Sprintf("LOCK TABLE %s IN %s MODE;", strings.Join(tableList, ", "), lockMode))
+	if lockErr == nil {
+		_, err = connection.Exec("RELEASE SAVEPOINT gpbackup_lock;")
+		utils.CheckError(err)
+		return lockErrors
+	}
+	_, err = connection.Exec("ROLLBACK TO SAVEPOINT gpbackup_lock;")
+	utils.CheckError(err)
+	_, err = connection.Exec("RELEASE SAVEPOINT gpbackup_lock;")
+	utils.CheckError(err)
+
+	for _, table := range tables {
+		_, err = connection.Exec("SAVEPOINT gpbackup_lock;")
+		utils.CheckError(err)
+		_, lockErr = connection.Exec(fmt.Sprintf("LOCK TABLE %s IN %s MODE;", table.ToString(), lockMode))
+		if lockErr != nil {
+			lockErrors[table.ToString()] = lockErr
+			_, err = connection.Exec("ROLLBACK TO SAVEPOINT gpbackup_lock;")
+			utils.CheckError(err)
+		}
+		_, err = connection.Exec("RELEASE SAVEPOINT gpbackup_lock;")
+		utils.CheckError(err)
+	}
+	return lockErrors
+}
+
+// How long the metadata and worker connections wait for their locks when lock-timeout is not set
+const DEFAULT_WORKER_LOCK_TIMEOUT = 60
+
+/*
+ * The ACCESS SHARE locks of the metadata and worker connections do not conflict
+ * with the EXCLUSIVE locks that the lock connection holds, so a connection only
+ * waits for a lock if another session is already queued for a conflicting lock
+ * on the table, such as a DROP or ALTER waiting for the lock connection itself.
+ * That session cannot get its lock until the lock connection commits, which only
+ * happens after every connection has its locks, and the database cannot detect
+ * the cycle because it passes through gpbackup, so the connection gives up after
+ * the timeout instead of waiting forever.  The connectionName, such as
+ * "Worker 1", begins each error message.
+ */
+func LockTablesForSnapshot(connection *utils.DBConn, tables []utils.Relation, connectionName string, timeoutSeconds int) {
+	lockErrors := LockTablesWithTimeout(connection, tables, "ACCESS SHARE", timeoutSeconds)
+	if len(lockErrors) == 0 {
+		return
+	}
+	for _, table := range tables {
+		if lockErr, failed := lockErrors[table.ToString()]; failed {
+			logger.Error("%s was unable to acquire ACCESS SHARE lock on table %s: %v", connectionName, table.ToString(), lockErr)
+		}
+	}
+	logger.Fatal(errors.Errorf("%s was unable to lock %d of %d tables within %d seconds, possibly because another session is waiting to alter or drop them", connectionName, len(lockErrors), len(tables), timeoutSeconds), "")
 }
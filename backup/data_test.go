@@ -1,21 +1,27 @@
 package backup_test
 
 import (
+	"errors"
+	"regexp"
+
 	"github.com/greenplum-db/gpbackup/backup"
 	"github.com/greenplum-db/gpbackup/testutils"
 	"github.com/greenplum-db/gpbackup/utils"
 
 	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
 	"gopkg.in/DATA-DOG/go-sqlmock.v1"
 )
 
 var _ = Describe("backup/data tests", func() {
 	var connection *utils.DBConn
 	var mock sqlmock.Sqlmock
+	var logfile *gbytes.Buffer
 	BeforeEach(func() {
 		connection, mock = testutils.CreateAndConnectMockDB()
-		testutils.SetupTestLogger()
+		_, _, _, logfile = testutils.SetupTestLogger()
 	})
 	Describe("CopyTableOut", func() {
 		It("will dump a table to its own file", func() {
@@ -23,7 +29,156 @@ var _ = Describe("backup/data tests", func() {
 			execStr := "COPY public.foo TO '<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456' WITH CSV DELIMITER ',' ON SEGMENT;"
 			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
 			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456"
-			backup.CopyTableOut(connection, testTable, filename)
+			rowCount, err := backup.CopyTableOut(connection, testTable, filename)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rowCount).To(Equal(int64(0)))
+		})
+		DescribeTable("will dump a table to its own file through the compression program", func(compressionType string, level int, execStr string) {
+			utils.SetCompression(compressionType, level)
+			defer utils.SetCompression("none", 0)
+			utils.DumpTimestamp = "20170101010101"
+			testTable := utils.Relation{2345, 3456, "public", "foo", "", ""}
+			mock.ExpectExec(regexp.QuoteMeta(execStr)).WillReturnResult(sqlmock.NewResult(10, 0))
+			_, err := backup.CopyTableOut(connection, testTable, backup.GetTableDumpFilePath(testTable))
+			Expect(err).ToNot(HaveOccurred())
+		},
+			Entry("with gzip", "gzip", 6, "COPY public.foo TO PROGRAM 'gzip -c -6 > <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.gz' WITH CSV DELIMITER ',' ON SEGMENT;"),
+			Entry("with zstd", "zstd", 10, "COPY public.foo TO PROGRAM 'zstd -q -c -10 > <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.zst' WITH CSV DELIMITER ',' ON SEGMENT;"),
+			Entry("with lz4", "lz4", 0, "COPY public.foo TO PROGRAM 'lz4 -c -1 > <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.lz4' WITH CSV DELIMITER ',' ON SEGMENT;"),
+			Entry("with no compression", "none", 0, "COPY public.foo TO '<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456' WITH CSV DELIMITER ',' ON SEGMENT;"),
+		)
+		It("returns the number of rows dumped", func() {
+			testTable := utils.Relation{2345, 3456, "public", "foo", "", ""}
+			mock.ExpectExec("COPY public.foo (.*)").WillReturnResult(sqlmock.NewResult(0, 42))
+			rowCount, err := backup.CopyTableOut(connection, testTable, "filename")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rowCount).To(Equal(int64(42)))
+		})
+		It("returns an error instead of panicking if the COPY fails", func() {
+			testTable := utils.Relation{2345, 3456, "public", "foo", "", ""}
+			mock.ExpectExec("COPY (.*)").WillReturnError(errors.New("permission denied"))
+			_, err := backup.CopyTableOut(connection, testTable, "filename")
+			Expect(err).To(MatchError("permission denied"))
+		})
+	})
+	Describe("CopyAllTablesOut", func() {
+		tableOne := utils.Relation{2345, 3456, "public", "foo", "", ""}
+		tableTwo := utils.Relation{2345, 4567, "public", "bar", "", ""}
+		tableThree := utils.Relation{2345, 5678, "public", "baz", "", ""}
+		BeforeEach(func() {
+			utils.DumpTimestamp = "20170101010101"
+		})
+
+		It("dumps all tables over a single connection", func() {
+			mock.ExpectExec("COPY public.foo (.*)").WillReturnResult(sqlmock.NewResult(0, 10))
+			mock.ExpectExec("COPY public.bar (.*)").WillReturnResult(sqlmock.NewResult(0, 20))
+			rowCounts, tableErrors := backup.CopyAllTablesOut([]*utils.DBConn{connection}, []utils.Relation{tableOne, tableTwo}, map[uint32]int64{})
+			Expect(tableErrors).To(BeEmpty())
+			Expect(rowCounts).To(Equal(map[uint32]int64{3456: 10, 4567: 20}))
+			Expect(mock.ExpectationsWereMet()).To(Succeed())
+		})
+		It("dumps all tables over multiple connections", func() {
+			connectionTwo, mockTwo := testutils.CreateAndConnectMockDB()
+			mock.MatchExpectationsInOrder(false)
+			mockTwo.MatchExpectationsInOrder(false)
+			for _, table := range []string{"foo", "bar", "baz"} {
+				mock.ExpectExec("COPY public." + table + " (.*)").WillReturnResult(sqlmock.NewResult(0, 10))
+				mockTwo.ExpectExec("COPY public." + table + " (.*)").WillReturnResult(sqlmock.NewResult(0, 10))
+			}
+			_, tableErrors := backup.CopyAllTablesOut([]*utils.DBConn{connection, connectionTwo}, []utils.Relation{tableOne, tableTwo, tableThree}, map[uint32]int64{})
+			Expect(tableErrors).To(BeEmpty())
+		})
+		It("reports the failed table and any tables not attempted when the only connection fails", func() {
+			mock.ExpectExec("COPY public.foo (.*)").WillReturnError(errors.New("permission denied"))
+			rowCounts, tableErrors := backup.CopyAllTablesOut([]*utils.DBConn{connection}, []utils.Relation{tableOne, tableTwo, tableThree}, map[uint32]int64{})
+			Expect(rowCounts).To(BeEmpty())
+			Expect(len(tableErrors)).To(Equal(3))
+			Expect(tableErrors["public.foo"]).To(MatchError("permission denied"))
+			Expect(tableErrors["public.bar"]).To(MatchError("Not attempted because all connections encountered errors"))
+			Expect(tableErrors["public.baz"]).To(MatchError("Not attempted because all connections encountered errors"))
+		})
+	})
+	Describe("GetSegmentDataSizes", func() {
+		It("returns the size of the data files on each segment keyed by content id", func() {
+			testutils.SetDefaultSegmentConfiguration()
+			mock.ExpectExec(regexp.QuoteMeta("CREATE TEMPORARY TABLE gpbackup_segment_sizes (segid int, size bigint) DISTRIBUTED RANDOMLY;")).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(regexp.QuoteMeta(`COPY gpbackup_segment_sizes FROM PROGRAM '(cd <SEG_DATA_DIR>/backups/20170101/20170101010101 && du -cb gpbackup_<SEGID>_20170101010101_*) 2>/dev/null | tail -n 1 | awk ''{print "<SEGID>," $1}''' WITH CSV ON SEGMENT;`)).WillReturnResult(sqlmock.NewResult(0, 2))
+			mock.ExpectQuery("SELECT segid, size FROM gpbackup_segment_sizes;").WillReturnRows(sqlmock.NewRows([]string{"segid", "size"}).AddRow(0, 1024).AddRow(1, 2048))
+			mock.ExpectExec("DROP TABLE gpbackup_segment_sizes;").WillReturnResult(sqlmock.NewResult(0, 0))
+			Expect(backup.GetSegmentDataSizes(connection)).To(Equal(map[int]int64{0: 1024, 1: 2048}))
+			Expect(mock.ExpectationsWereMet()).To(Succeed())
+		})
+	})
+	Describe("LockTablesWithTimeout", func() {
+		tables := []utils.Relation{utils.BasicRelation("public", "foo"), utils.BasicRelation("public", "bar")}
+		It("locks all tables in a single statement with the given timeout", func() {
+			mock.ExpectExec("SET statement_timeout TO 5000;").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("SAVEPOINT gpbackup_lock;").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("LOCK TABLE public.foo, public.bar IN ACCESS SHARE MODE;").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("RELEASE SAVEPOINT gpbackup_lock;").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("RESET statement_timeout;").WillReturnResult(sqlmock.NewResult(0, 0))
+			lockErrors := backup.LockTablesWithTimeout(connection, tables, "ACCESS SHARE", 5)
+			Expect(lockErrors).To(BeEmpty())
+			Expect(mock.ExpectationsWereMet()).To(Succeed())
+		})
+		It("does not set a timeout if the timeout is 0", func() {
+			mock.ExpectExec("SAVEPOINT gpbackup_lock;").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("LOCK TABLE public.foo, public.bar IN ACCESS SHARE MODE;").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("RELEASE SAVEPOINT gpbackup_lock;").WillReturnResult(sqlmock.NewResult(0, 0))
+			lockErrors := backup.LockTablesWithTimeout(connection, tables, "ACCESS SHARE", 0)
+			Expect(lockErrors).To(BeEmpty())
+			Expect(mock.ExpectationsWereMet()).To(Succeed())
+		})
+		It("locks each table in its own savepoint and continues with the next table if a table cannot be locked", func() {
+			mock.ExpectExec("SET statement_timeout TO 5000;").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("SAVEPOINT gpbackup_lock;").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("LOCK TABLE public.foo, public.bar IN ACCESS SHARE MODE;").WillReturnError(errors.New("canceling statement due to statement timeout"))
+			mock.ExpectExec("ROLLBACK TO SAVEPOINT gpbackup_lock;").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("RELEASE SAVEPOINT gpbackup_lock;").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("SAVEPOINT gpbackup_lock;").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("LOCK TABLE public.foo IN ACCESS SHARE MODE;").WillReturnError(errors.New("canceling statement due to statement timeout"))
+			mock.ExpectExec("ROLLBACK TO SAVEPOINT gpbackup_lock;").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("RELEASE SAVEPOINT gpbackup_lock;").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("SAVEPOINT gpbackup_lock;").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("LOCK TABLE public.bar IN ACCESS SHARE MODE;").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("RELEASE SAVEPOINT gpbackup_lock;").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("RESET statement_timeout;").WillReturnResult(sqlmock.NewResult(0, 0))
+			lockErrors := backup.LockTablesWithTimeout(connection, tables, "ACCESS SHARE", 5)
+			Expect(lockErrors).To(HaveLen(1))
+			Expect(lockErrors["public.foo"]).To(MatchError("canceling statement due to statement timeout"))
+			Expect(mock.ExpectationsWereMet()).To(Succeed())
+		})
+		It("does nothing if there are no tables", func() {
+			lockErrors := backup.LockTablesWithTimeout(connection, []utils.Relation{}, "ACCESS SHARE", 5)
+			Expect(lockErrors).To(BeEmpty())
+			Expect(mock.ExpectationsWereMet()).To(Succeed())
+		})
+	})
+	Describe("LockTablesForSnapshot", func() {
+		tables := []utils.Relation{utils.BasicRelation("public", "foo")}
+		It("locks the tables in ACCESS SHARE mode with the given timeout", func() {
+			mock.ExpectExec("SET statement_timeout TO 60000;").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("SAVEPOINT gpbackup_lock;").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("LOCK TABLE public.foo IN ACCESS SHARE MODE;").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("RELEASE SAVEPOINT gpbackup_lock;").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("RESET statement_timeout;").WillReturnResult(sqlmock.NewResult(0, 0))
+			backup.LockTablesForSnapshot(connection, tables, "Worker 1", 60)
+			Expect(mock.ExpectationsWereMet()).To(Succeed())
+		})
+		It("panics instead of waiting indefinitely when a session waiting to drop a table blocks the lock", func() {
+			mock.ExpectExec("SET statement_timeout TO 60000;").WillReturnResult(sqlmock.NewResult(0, 0))
+			for i := 0; i < 2; i++ {
+				mock.ExpectExec("SAVEPOINT gpbackup_lock;").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec("LOCK TABLE public.foo IN ACCESS SHARE MODE;").WillReturnError(errors.New("canceling statement due to statement timeout"))
+				mock.ExpectExec("ROLLBACK TO SAVEPOINT gpbackup_lock;").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec("RELEASE SAVEPOINT gpbackup_lock;").WillReturnResult(sqlmock.NewResult(0, 0))
+			}
+			mock.ExpectExec("RESET statement_timeout;").WillReturnResult(sqlmock.NewResult(0, 0))
+			defer func() {
+				testutils.ExpectRegexp(logfile, "Worker 1 was unable to acquire ACCESS SHARE lock on table public.foo: canceling statement due to statement timeout")
+			}()
+			defer testutils.ShouldPanicWithMessage("Worker 1 was unable to lock 1 of 1 tables within 60 seconds, possibly because another session is waiting to alter or drop them")
+			backup.LockTablesForSnapshot(connection, tables, "Worker 1", 60)
 		})
 	})
 	Describe("GetTableDumpFilePath", func() {
@@ -34,5 +189,14 @@ var _ = Describe("backup/data tests", func() {
 			actualFilename := backup.GetTableDumpFilePath(testTable)
 			Expect(actualFilename).To(Equal(expectedFilename))
 		})
+		It("will add the extension of the compression type to the dump path if compression is enabled", func() {
+			utils.SetCompression("gzip", 1)
+			defer utils.SetCompression("none", 0)
+			testTable := utils.Relation{2345, 3456, "public", "foo", "", ""}
+			utils.DumpTimestamp = "20170101010101"
+			expectedFilename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.gz"
+			actualFilename := backup.GetTableDumpFilePath(testTable)
+			Expect(actualFilename).To(Equal(expectedFilename))
+		})
 	})
 })
@@ -32,21 +32,48 @@ SET default_with_oids = %s;
 `, gucs.ClientEncoding, gucs.StdConformingStrings, gucs.DefaultWithOids)
 }
 
-func PrintCreateDatabaseStatement(globalFile io.Writer) {
-	dbname := utils.QuoteIdent(connection.DBName)
-	owner := utils.QuoteIdent(GetDatabaseOwner(connection))
-	utils.MustPrintf(globalFile, "\n\nCREATE DATABASE %s;", dbname)
-	utils.MustPrintf(globalFile, "\nALTER DATABASE %s OWNER TO %s;", dbname, utils.QuoteIdent(owner))
+/*
+ * CREATE DATABASE cannot be run in a multi-statement query, so it has its own
+ * TOC entry separate from the statement setting the database owner.  The
+ * database is created from template0 so that its encoding can differ from
+ * that of template1.
+ */
+func PrintCreateDatabaseStatement(globalFile *utils.FileWithByteCount, toc *utils.TOC, dbname string, owner string, encoding string) {
+	start := globalFile.ByteCount
+	quotedDBName := utils.QuoteIdent(dbname)
+	utils.MustPrintf(globalFile, "\n\nCREATE DATABASE %s TEMPLATE template0", quotedDBName)
+	if encoding != "" {
+		utils.MustPrintf(globalFile, " ENCODING '%s'", encoding)
+	}
+	utils.MustPrintf(globalFile, ";")
+	toc.AddGlobalEntry("", dbname, "DATABASE", "", start, globalFile)
+	if owner != "" {
+		start = globalFile.ByteCount
+		utils.MustPrintf(globalFile, "\nALTER DATABASE %s OWNER TO %s;", quotedDBName, utils.QuoteIdent(owner))
+		toc.AddGlobalEntry("", dbname, "DATABASE OWNER", "", start, globalFile)
+	}
 }
 
-func PrintDatabaseGUCs(globalFile io.Writer, gucs []string, dbname string) {
+func PrintDatabaseGUCs(globalFile *utils.FileWithByteCount, toc *utils.TOC, gucs []string, dbname string) {
 	for _, guc := range gucs {
+		start := globalFile.ByteCount
 		utils.MustPrintf(globalFile, "\nALTER DATABASE %s %s;", utils.QuoteIdent(dbname), guc)
+		toc.AddGlobalEntry("", dbname, "DATABASE GUC", "", start, globalFile)
+	}
+}
+
+func PrintDatabaseComment(globalFile *utils.FileWithByteCount, toc *utils.TOC, comment string, dbname string) {
+	if comment == "" {
+		return
 	}
+	start := globalFile.ByteCount
+	utils.MustPrintf(globalFile, "\nCOMMENT ON DATABASE %s IS '%s';\n", utils.QuoteIdent(dbname), comment)
+	toc.AddGlobalEntry("", dbname, "DATABASE COMMENT", "", start, globalFile)
 }
 
-func PrintCreateResourceQueueStatements(globalFile io.Writer, resQueues []QueryResourceQueue) {
+func PrintCreateResourceQueueStatements(globalFile *utils.FileWithByteCount, toc *utils.TOC, resQueues []QueryResourceQueue) {
 	for _, resQueue := range resQueues {
+		start := globalFile.ByteCount
 		attributes := []string{}
 		if resQueue.ActiveStatements != -1 {
 			attributes = append(attributes, fmt.Sprintf("ACTIVE_STATEMENTS=%d", resQueue.ActiveStatements))
@@ -79,11 +106,13 @@ func PrintCreateResourceQueueStatements(globalFile io.Writer, resQueues []QueryR
 		if resQueue.Comment != "" {
 			utils.MustPrintf(globalFile, "\n\nCOMMENT ON RESOURCE QUEUE %s IS '%s';", utils.QuoteIdent(resQueue.Name), resQueue.Comment)
 		}
+		toc.AddGlobalEntry("", resQueue.Name, "RESOURCE QUEUE", "", start, globalFile)
 	}
 }
 
-func PrintCreateRoleStatements(globalFile io.Writer, roles []QueryRole) {
+func PrintCreateRoleStatements(globalFile *utils.FileWithByteCount, toc *utils.TOC, roles []QueryRole) {
 	for _, role := range roles {
+		start := globalFile.ByteCount
 		attrs := []string{}
 
 		if role.Super {
@@ -164,5 +193,6 @@ ALTER ROLE %s WITH %s;`, utils.QuoteIdent(role.Name), utils.QuoteIdent(role.Name
 		if role.Comment != "" {
 			utils.MustPrintf(globalFile, "\n\nCOMMENT ON ROLE %s IS '%s';", utils.QuoteIdent(role.Name), role.Comment)
 		}
+		toc.AddGlobalEntry("", role.Name, "ROLE", "", start, globalFile)
 	}
 }
@@ -3,16 +3,22 @@ package backup_test
 import (
 	"github.com/greenplum-db/gpbackup/backup"
 	"github.com/greenplum-db/gpbackup/testutils"
+	"github.com/greenplum-db/gpbackup/utils"
 
 	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/gbytes"
 )
 
 var _ = Describe("backup/global objects tests", func() {
 	buffer := gbytes.NewBuffer()
+	var toc *utils.TOC
+	var backupfile *utils.FileWithByteCount
 
 	BeforeEach(func() {
 		buffer = gbytes.BufferWithBytes([]byte(""))
+		toc = &utils.TOC{}
+		backupfile = utils.NewFileWithByteCount(buffer)
 	})
 	Describe("PrintSessionGUCs", func() {
 		It("prints session GUCs", func() {
@@ -27,6 +33,19 @@ SET standard_conforming_strings = on;
 SET default_with_oids = false`)
 		})
 	})
+	Describe("PrintCreateDatabaseStatement", func() {
+		It("prints a CREATE DATABASE statement with an encoding and owner", func() {
+			backup.PrintCreateDatabaseStatement(backupfile, toc, "testdb", "testrole", "UTF8")
+			testutils.ExpectRegexp(buffer, `CREATE DATABASE testdb TEMPLATE template0 ENCODING 'UTF8';
+ALTER DATABASE testdb OWNER TO testrole;`)
+		})
+		It("adds separate entries for creating the database and setting its owner to the TOC", func() {
+			backup.PrintCreateDatabaseStatement(backupfile, toc, "testdb", "testrole", "UTF8")
+			Expect(len(toc.GlobalEntries)).To(Equal(2))
+			Expect(toc.GlobalEntries[0]).To(Equal(utils.MetadataEntry{"", "testdb", "DATABASE", "", 0, toc.GlobalEntries[1].StartByte}))
+			Expect(toc.GlobalEntries[1]).To(Equal(utils.MetadataEntry{"", "testdb", "DATABASE OWNER", "", toc.GlobalEntries[0].EndByte, backupfile.ByteCount}))
+		})
+	})
 	Describe("PrintDatabaseGUCs", func() {
 		dbname := "testdb"
 		defaultOidGUC := "SET default_with_oids TO 'true'"
@@ -36,17 +55,37 @@ SET default_with_oids = false`)
 		It("prints single database GUC", func() {
 			gucs := []string{defaultOidGUC}
 
-			backup.PrintDatabaseGUCs(buffer, gucs, dbname)
+			backup.PrintDatabaseGUCs(backupfile, toc, gucs, dbname)
 			testutils.ExpectRegexp(buffer, `ALTER DATABASE testdb SET default_with_oids TO 'true';`)
 		})
 		It("prints multiple database GUCs", func() {
 			gucs := []string{defaultOidGUC, searchPathGUC, defaultStorageGUC}
 
-			backup.PrintDatabaseGUCs(buffer, gucs, dbname)
+			backup.PrintDatabaseGUCs(backupfile, toc, gucs, dbname)
 			testutils.ExpectRegexp(buffer, `ALTER DATABASE testdb SET default_with_oids TO 'true';
 ALTER DATABASE testdb SET search_path TO 'pg_catalog, public';
 ALTER DATABASE testdb SET gp_default_storage_options TO 'appendonly=true,blocksize=32768';`)
 		})
+		It("adds an entry for each database GUC to the TOC", func() {
+			gucs := []string{defaultOidGUC, searchPathGUC}
+
+			backup.PrintDatabaseGUCs(backupfile, toc, gucs, dbname)
+			Expect(len(toc.GlobalEntries)).To(Equal(2))
+			Expect(toc.GlobalEntries[0]).To(Equal(utils.MetadataEntry{"", "testdb", "DATABASE GUC", "", 0, toc.GlobalEntries[1].StartByte}))
+			Expect(toc.GlobalEntries[1]).To(Equal(utils.MetadataEntry{"", "testdb", "DATABASE GUC", "", toc.GlobalEntries[0].EndByte, backupfile.ByteCount}))
+		})
+	})
+	Describe("PrintDatabaseComment", func() {
+		It("prints a database comment", func() {
+			backup.PrintDatabaseComment(backupfile, toc, "This is a database comment.", "testdb")
+			testutils.ExpectRegexp(buffer, `COMMENT ON DATABASE testdb IS 'This is a database comment.';`)
+			Expect(toc.GlobalEntries).To(Equal([]utils.MetadataEntry{{"", "testdb", "DATABASE COMMENT", "", 0, backupfile.ByteCount}}))
+		})
+		It("prints nothing if the database has no comment", func() {
+			backup.PrintDatabaseComment(backupfile, toc, "", "testdb")
+			Expect(backupfile.ByteCount).To(Equal(uint64(0)))
+			Expect(toc.GlobalEntries).To(BeEmpty())
+		})
 	})
 	Describe("PrintCreateResourceQueueStatements", func() {
 		It("prints resource queues", func() {
@@ -54,7 +93,7 @@ ALTER DATABASE testdb SET gp_default_storage_options TO 'appendonly=true,blocksi
 			maxCostQueue := backup.QueryResourceQueue{"someMaxCostQueue", -1, "99.9", true, "0.00", "medium", "-1", ""}
 			resQueues := []backup.QueryResourceQueue{someQueue, maxCostQueue}
 
-			backup.PrintCreateResourceQueueStatements(buffer, resQueues)
+			backup.PrintCreateResourceQueueStatements(backupfile, toc, resQueues)
 			testutils.ExpectRegexp(buffer, `CREATE RESOURCE QUEUE some_queue WITH (ACTIVE_STATEMENTS=1);
 
 CREATE RESOURCE QUEUE "someMaxCostQueue" WITH (MAX_COST=99.9, COST_OVERCOMMIT=TRUE);`)
@@ -63,21 +102,21 @@ CREATE RESOURCE QUEUE "someMaxCostQueue" WITH (MAX_COST=99.9, COST_OVERCOMMIT=TR
 			someActiveMaxCostQueue := backup.QueryResourceQueue{"someActiveMaxCostQueue", 5, "62.03", false, "0.00", "medium", "-1", ""}
 			resQueues := []backup.QueryResourceQueue{someActiveMaxCostQueue}
 
-			backup.PrintCreateResourceQueueStatements(buffer, resQueues)
+			backup.PrintCreateResourceQueueStatements(backupfile, toc, resQueues)
 			testutils.ExpectRegexp(buffer, `CREATE RESOURCE QUEUE "someActiveMaxCostQueue" WITH (ACTIVE_STATEMENTS=5, MAX_COST=62.03);`)
 		})
 		It("prints a resource queue with active statements and max cost", func() {
 			everythingQueue := backup.QueryResourceQueue{"everythingQueue", 7, "32.80", true, "1.34", "low", "2GB", ""}
 			resQueues := []backup.QueryResourceQueue{everythingQueue}
 
-			backup.PrintCreateResourceQueueStatements(buffer, resQueues)
+			backup.PrintCreateResourceQueueStatements(backupfile, toc, resQueues)
 			testutils.ExpectRegexp(buffer, `CREATE RESOURCE QUEUE "everythingQueue" WITH (ACTIVE_STATEMENTS=7, MAX_COST=32.80, COST_OVERCOMMIT=TRUE, MIN_COST=1.34, PRIORITY=LOW, MEMORY_LIMIT='2GB');`)
 		})
 		It("prints a resource queue with a comment", func() {
 			commentQueue := backup.QueryResourceQueue{"commentQueue", 1, "-1.00", false, "0.00", "medium", "-1", "this is a comment on a resource queue"}
 			resQueues := []backup.QueryResourceQueue{commentQueue}
 
-			backup.PrintCreateResourceQueueStatements(buffer, resQueues)
+			backup.PrintCreateResourceQueueStatements(backupfile, toc, resQueues)
 			testutils.ExpectRegexp(buffer, `CREATE RESOURCE QUEUE "commentQueue" WITH (ACTIVE_STATEMENTS=1);
 
 COMMENT ON RESOURCE QUEUE "commentQueue" IS 'this is a comment on a resource queue'`)
@@ -86,7 +125,7 @@ COMMENT ON RESOURCE QUEUE "commentQueue" IS 'this is a comment on a resource que
 			pg_default := backup.QueryResourceQueue{"pg_default", 1, "-1.00", false, "0.00", "medium", "-1", ""}
 			resQueues := []backup.QueryResourceQueue{pg_default}
 
-			backup.PrintCreateResourceQueueStatements(buffer, resQueues)
+			backup.PrintCreateResourceQueueStatements(backupfile, toc, resQueues)
 			testutils.ExpectRegexp(buffer, `ALTER RESOURCE QUEUE pg_default WITH (ACTIVE_STATEMENTS=1);`)
 		})
 	})
@@ -144,7 +183,7 @@ COMMENT ON RESOURCE QUEUE "commentQueue" IS 'this is a comment on a resource que
 		}
 		It("prints basic role", func() {
 
-			backup.PrintCreateRoleStatements(buffer, []backup.QueryRole{testrole1})
+			backup.PrintCreateRoleStatements(backupfile, toc, []backup.QueryRole{testrole1})
 
 			testutils.ExpectRegexp(buffer, `CREATE ROLE testrole1;
 
@@ -152,7 +191,7 @@ ALTER ROLE testrole1 WITH NOSUPERUSER NOINHERIT NOCREATEROLE NOCREATEDB NOLOGIN
 		})
 		It("prints roles with non-defaults", func() {
 
-			backup.PrintCreateRoleStatements(buffer, []backup.QueryRole{testrole2})
+			backup.PrintCreateRoleStatements(backupfile, toc, []backup.QueryRole{testrole2})
 
 			testutils.ExpectRegexp(buffer, `CREATE ROLE "testRole2";
 
@@ -164,9 +203,16 @@ ALTER ROLE "testRole2" DENY BETWEEN DAY 5 TIME '00:00:00' AND DAY 5 TIME '24:00:
 
 COMMENT ON ROLE "testRole2" IS 'this is a role comment';`)
 		})
+		It("adds an entry for each role to the TOC", func() {
+			backup.PrintCreateRoleStatements(backupfile, toc, []backup.QueryRole{testrole1, testrole2})
+
+			Expect(len(toc.GlobalEntries)).To(Equal(2))
+			Expect(toc.GlobalEntries[0]).To(Equal(utils.MetadataEntry{"", "testrole1", "ROLE", "", 0, toc.GlobalEntries[1].StartByte}))
+			Expect(toc.GlobalEntries[1]).To(Equal(utils.MetadataEntry{"", "testRole2", "ROLE", "", toc.GlobalEntries[0].EndByte, backupfile.ByteCount}))
+		})
 		It("prints multiple roles", func() {
 
-			backup.PrintCreateRoleStatements(buffer, []backup.QueryRole{testrole1, testrole1})
+			backup.PrintCreateRoleStatements(backupfile, toc, []backup.QueryRole{testrole1, testrole1})
 
 			testutils.ExpectRegexp(buffer, `CREATE ROLE testrole1;
 
@@ -0,0 +1,59 @@
+package backup
+
+/*
+ * This file contains functions related to incremental backups, in which the
+ * append-optimized tables that have not changed since an earlier full backup
+ * are not dumped again.
+ */
+
+import (
+	"github.com/greenplum-db/gpbackup/utils"
+)
+
+/*
+ * Returns the manifest of the most recent complete full backup of the same
+ * database that was taken before the current backup, or nil if there is none.
+ * The data files of the base backup are read with the compression type and
+ * encryption key of the incremental backup, so only backups with the same
+ * compression type that are also encrypted or unencrypted match; the key is
+ * not recorded, so it is assumed to be the same.
+ */
+func GetIncrementalBaseManifest(manifests []*utils.Manifest, dbname string, compressionType string, encrypted bool, timestamp string) *utils.Manifest {
+	var baseManifest *utils.Manifest
+	for _, manifest := range manifests {
+		if manifest.Status != utils.BACKUP_STATUS_COMPLETE || manifest.Incremental {
+			continue
+		}
+		if manifest.DatabaseName != dbname || manifest.CompressionType != compressionType || manifest.Encrypted != encrypted {
+			continue
+		}
+		if manifest.StartTime >= timestamp {
+			continue
+		}
+		if baseManifest == nil || manifest.StartTime > baseManifest.StartTime {
+			baseManifest = manifest
+		}
+	}
+	return baseManifest
+}
+
+/*
+ * Splits the tables into those that need to be dumped and those whose data
+ * files in the base backup can be used instead.  A table can only be skipped
+ * if it was append-optimized and backed up in the base backup and its state
+ * is unchanged since then.
+ */
+func FilterUnchangedAOTables(tables []utils.Relation, aoTableStates map[string]utils.AOTableState, baseManifest *utils.Manifest) ([]utils.Relation, []utils.Relation) {
+	changedTables := make([]utils.Relation, 0)
+	unchangedTables := make([]utils.Relation, 0)
+	for _, table := range tables {
+		currentState, isAO := aoTableStates[table.ToString()]
+		baseState, inBase := baseManifest.AOTableStates[table.ToString()]
+		if isAO && inBase && currentState == baseState {
+			unchangedTables = append(unchangedTables, table)
+		} else {
+			changedTables = append(changedTables, table)
+		}
+	}
+	return changedTables, unchangedTables
+}
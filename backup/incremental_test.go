@@ -0,0 +1,65 @@
+package backup_test
+
+import (
+	"github.com/greenplum-db/gpbackup/backup"
+	"github.com/greenplum-db/gpbackup/testutils"
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("backup/incremental tests", func() {
+	BeforeEach(func() {
+		testutils.SetupTestLogger()
+	})
+
+	Describe("GetIncrementalBaseManifest", func() {
+		fullBackup := &utils.Manifest{DatabaseName: "testdb", CompressionType: "gzip", StartTime: "20170101010101", Status: utils.BACKUP_STATUS_COMPLETE}
+		laterFullBackup := &utils.Manifest{DatabaseName: "testdb", CompressionType: "gzip", StartTime: "20170102010101", Status: utils.BACKUP_STATUS_COMPLETE}
+		incrementalBackup := &utils.Manifest{DatabaseName: "testdb", CompressionType: "gzip", Incremental: true, StartTime: "20170103010101", Status: utils.BACKUP_STATUS_COMPLETE}
+		failedBackup := &utils.Manifest{DatabaseName: "testdb", CompressionType: "gzip", StartTime: "20170104010101", Status: utils.BACKUP_STATUS_FAILED}
+		otherDatabaseBackup := &utils.Manifest{DatabaseName: "otherdb", CompressionType: "gzip", StartTime: "20170105010101", Status: utils.BACKUP_STATUS_COMPLETE}
+		otherCompressionBackup := &utils.Manifest{DatabaseName: "testdb", CompressionType: "none", StartTime: "20170106010101", Status: utils.BACKUP_STATUS_COMPLETE}
+		encryptedBackup := &utils.Manifest{DatabaseName: "testdb", CompressionType: "gzip", Encrypted: true, StartTime: "20170106020202", Status: utils.BACKUP_STATUS_COMPLETE}
+		allManifests := []*utils.Manifest{laterFullBackup, fullBackup, incrementalBackup, failedBackup, otherDatabaseBackup, otherCompressionBackup, encryptedBackup}
+
+		It("returns the most recent complete full backup of the same database with the same compression type", func() {
+			Expect(backup.GetIncrementalBaseManifest(allManifests, "testdb", "gzip", false, "20170107010101")).To(Equal(laterFullBackup))
+		})
+		It("does not return a backup taken after the current backup", func() {
+			Expect(backup.GetIncrementalBaseManifest(allManifests, "testdb", "gzip", false, "20170102000000")).To(Equal(fullBackup))
+		})
+		It("only returns an encrypted backup if the current backup is encrypted", func() {
+			Expect(backup.GetIncrementalBaseManifest(allManifests, "testdb", "gzip", true, "20170107010101")).To(Equal(encryptedBackup))
+		})
+		It("returns nil if there is no matching backup", func() {
+			Expect(backup.GetIncrementalBaseManifest(allManifests, "testdb", "zstd", false, "20170107010101")).To(BeNil())
+		})
+	})
+	Describe("FilterUnchangedAOTables", func() {
+		unchangedTable := utils.Relation{0, 1234, "public", "unchanged", "", ""}
+		modifiedTable := utils.Relation{0, 2345, "public", "modified", "", ""}
+		alteredTable := utils.Relation{0, 3456, "public", "altered", "", ""}
+		newTable := utils.Relation{0, 4567, "public", "new", "", ""}
+		heapTable := utils.Relation{0, 5678, "public", "heap", "", ""}
+		tables := []utils.Relation{unchangedTable, modifiedTable, alteredTable, newTable, heapTable}
+		baseManifest := &utils.Manifest{AOTableStates: map[string]utils.AOTableState{
+			"public.unchanged": {ModCount: 3, LastDDLTimestamp: "2017-01-01 01:01:01-08"},
+			"public.modified":  {ModCount: 3, LastDDLTimestamp: "2017-01-01 01:01:01-08"},
+			"public.altered":   {ModCount: 3, LastDDLTimestamp: "2017-01-01 01:01:01-08"},
+		}}
+		currentStates := map[string]utils.AOTableState{
+			"public.unchanged": {ModCount: 3, LastDDLTimestamp: "2017-01-01 01:01:01-08"},
+			"public.modified":  {ModCount: 4, LastDDLTimestamp: "2017-01-01 01:01:01-08"},
+			"public.altered":   {ModCount: 3, LastDDLTimestamp: "2017-01-02 01:01:01-08"},
+			"public.new":       {ModCount: 1, LastDDLTimestamp: "2017-01-02 01:01:01-08"},
+		}
+
+		It("only skips append-optimized tables whose state is unchanged since the base backup", func() {
+			changedTables, unchangedTables := backup.FilterUnchangedAOTables(tables, currentStates, baseManifest)
+			Expect(changedTables).To(Equal([]utils.Relation{modifiedTable, alteredTable, newTable, heapTable}))
+			Expect(unchangedTables).To(Equal([]utils.Relation{unchangedTable}))
+		})
+	})
+})
@@ -8,14 +8,12 @@ package backup
 
 import (
 	"fmt"
-	"io"
-	"sort"
 
 	"github.com/greenplum-db/gpbackup/utils"
 )
 
-func GetIndexesForAllTables(connection *utils.DBConn, tables []utils.Relation) []string {
-	indexes := make([]string, 0)
+func GetIndexesForAllTables(connection *utils.DBConn, tables []utils.Relation) []StatementWithType {
+	indexes := make([]StatementWithType, 0)
 	indexNameMap := ConstructImplicitIndexNames(connection)
 	for _, table := range tables {
 		indexList := GetIndexMetadata(connection, table.RelationOid, indexNameMap)
@@ -24,43 +22,45 @@ func GetIndexesForAllTables(connection *utils.DBConn, tables []utils.Relation) [
 			if index.Comment != "" {
 				indexStr += fmt.Sprintf("\nCOMMENT ON INDEX %s IS '%s';", utils.QuoteIdent(index.Name), index.Comment)
 			}
-			indexes = append(indexes, indexStr)
+			indexes = append(indexes, StatementWithType{table.SchemaName, index.Name, "INDEX", table.ToString(), indexStr})
 		}
 	}
 	return indexes
 }
 
-func GetRuleDefinitions(connection *utils.DBConn) []string {
-	rules := make([]string, 0)
+func GetRuleDefinitions(connection *utils.DBConn) []StatementWithType {
+	rules := make([]StatementWithType, 0)
 	ruleList := GetRuleMetadata(connection)
 	for _, rule := range ruleList {
+		tableFQN := utils.MakeFQN(rule.OwningSchema, rule.OwningTable)
 		ruleStr := fmt.Sprintf("\n\n%s", rule.Def)
 		if rule.Comment != "" {
-			tableFQN := utils.MakeFQN(rule.OwningSchema, rule.OwningTable)
 			ruleStr += fmt.Sprintf("\nCOMMENT ON RULE %s ON %s IS '%s';", utils.QuoteIdent(rule.Name), tableFQN, rule.Comment)
 		}
-		rules = append(rules, ruleStr)
+		rules = append(rules, StatementWithType{rule.OwningSchema, rule.Name, "RULE", tableFQN, ruleStr})
 	}
 	return rules
 }
 
-func GetTriggerDefinitions(connection *utils.DBConn) []string {
-	triggers := make([]string, 0)
+func GetTriggerDefinitions(connection *utils.DBConn) []StatementWithType {
+	triggers := make([]StatementWithType, 0)
 	triggerList := GetTriggerMetadata(connection)
 	for _, trigger := range triggerList {
+		tableFQN := utils.MakeFQN(trigger.OwningSchema, trigger.OwningTable)
 		triggerStr := fmt.Sprintf("\n\n%s;", trigger.Def)
 		if trigger.Comment != "" {
-			tableFQN := utils.MakeFQN(trigger.OwningSchema, trigger.OwningTable)
 			triggerStr += fmt.Sprintf("\nCOMMENT ON TRIGGER %s ON %s IS '%s';", utils.QuoteIdent(trigger.Name), tableFQN, trigger.Comment)
 		}
-		triggers = append(triggers, triggerStr)
+		triggers = append(triggers, StatementWithType{trigger.OwningSchema, trigger.Name, "TRIGGER", tableFQN, triggerStr})
 	}
 	return triggers
 }
 
-func PrintPostdataCreateStatements(postdataFile io.Writer, statements []string) {
-	sort.Strings(statements)
+func PrintPostdataCreateStatements(postdataFile *utils.FileWithByteCount, toc *utils.TOC, statements []StatementWithType) {
+	SortStatementsWithType(statements)
 	for _, statement := range statements {
-		utils.MustPrintln(postdataFile, statement)
+		start := postdataFile.ByteCount
+		utils.MustPrintln(postdataFile, statement.Statement)
+		toc.AddPostdataEntry(statement.Schema, statement.Name, statement.ObjectType, statement.ReferenceObject, start, postdataFile)
 	}
 }
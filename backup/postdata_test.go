@@ -42,7 +42,11 @@ var _ = Describe("backup/postdata tests", func() {
 				mock.ExpectQuery("SELECT (.*)").WillReturnRows(resultOne)
 				indexes := backup.GetIndexesForAllTables(connection, testTables)
 				Expect(len(indexes)).To(Equal(1))
-				Expect(indexes[0]).To(Equal("\n\nCREATE INDEX btree_idx1 ON table_one USING btree (i);"))
+				Expect(indexes[0].Statement).To(Equal("\n\nCREATE INDEX btree_idx1 ON table_one USING btree (i);"))
+				Expect(indexes[0].Schema).To(Equal("public"))
+				Expect(indexes[0].Name).To(Equal("btree_idx1"))
+				Expect(indexes[0].ObjectType).To(Equal("INDEX"))
+				Expect(indexes[0].ReferenceObject).To(Equal("public.table_one"))
 			})
 			It("returns a slice containing one CREATE INDEX statement for two tables", func() {
 				testTables := []utils.Relation{tableOne, tableTwo}
@@ -53,8 +57,8 @@ var _ = Describe("backup/postdata tests", func() {
 				mock.ExpectQuery("SELECT (.*)").WillReturnRows(resultTwo)
 				indexes := backup.GetIndexesForAllTables(connection, testTables)
 				Expect(len(indexes)).To(Equal(2))
-				Expect(indexes[0]).To(Equal("\n\nCREATE INDEX btree_idx1 ON table_one USING btree (i);"))
-				Expect(indexes[1]).To(Equal("\n\nCREATE INDEX btree_idx2 ON table_two USING btree (j);"))
+				Expect(indexes[0].Statement).To(Equal("\n\nCREATE INDEX btree_idx1 ON table_one USING btree (i);"))
+				Expect(indexes[1].Statement).To(Equal("\n\nCREATE INDEX btree_idx2 ON table_two USING btree (j);"))
 			})
 			It("returns a slice containing two CREATE INDEX statement for one table", func() {
 				testTables := []utils.Relation{tableOne, tableTwo}
@@ -65,9 +69,9 @@ var _ = Describe("backup/postdata tests", func() {
 				mock.ExpectQuery("SELECT (.*)").WillReturnRows(resultTwo)
 				indexes := backup.GetIndexesForAllTables(connection, testTables)
 				Expect(len(indexes)).To(Equal(3))
-				Expect(indexes[0]).To(Equal("\n\nCREATE INDEX btree_idx1 ON table_one USING btree (i);"))
-				Expect(indexes[1]).To(Equal("\n\nCREATE INDEX bitmap_idx1 ON table_one USING bitmap (i);"))
-				Expect(indexes[2]).To(Equal("\n\nCREATE INDEX btree_idx2 ON table_two USING btree (j);"))
+				Expect(indexes[0].Statement).To(Equal("\n\nCREATE INDEX btree_idx1 ON table_one USING btree (i);"))
+				Expect(indexes[1].Statement).To(Equal("\n\nCREATE INDEX bitmap_idx1 ON table_one USING bitmap (i);"))
+				Expect(indexes[2].Statement).To(Equal("\n\nCREATE INDEX btree_idx2 ON table_two USING btree (j);"))
 			})
 			It("returns a slice containing one CREATE INDEX statement when one table has an index and one does not", func() {
 				testTables := []utils.Relation{tableOne, tableWithout}
@@ -77,7 +81,7 @@ var _ = Describe("backup/postdata tests", func() {
 				mock.ExpectQuery("SELECT (.*)").WillReturnRows(resultEmpty)
 				indexes := backup.GetIndexesForAllTables(connection, testTables)
 				Expect(len(indexes)).To(Equal(1))
-				Expect(indexes[0]).To(Equal("\n\nCREATE INDEX btree_idx1 ON table_one USING btree (i);"))
+				Expect(indexes[0].Statement).To(Equal("\n\nCREATE INDEX btree_idx1 ON table_one USING btree (i);"))
 			})
 			It("returns a slice containing one CREATE INDEX statement and accompanying comment", func() {
 				testTables := []utils.Relation{tableOne}
@@ -86,7 +90,7 @@ var _ = Describe("backup/postdata tests", func() {
 				mock.ExpectQuery("SELECT (.*)").WillReturnRows(resultOne)
 				indexes := backup.GetIndexesForAllTables(connection, testTables)
 				Expect(len(indexes)).To(Equal(1))
-				Expect(indexes[0]).To(Equal(`
+				Expect(indexes[0].Statement).To(Equal(`
 
 CREATE INDEX btree_idx1 ON table_one USING btree (i);
 COMMENT ON INDEX btree_idx1 IS 'This is an index comment.';`))
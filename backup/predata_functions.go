@@ -13,8 +13,9 @@ import (
 	"github.com/greenplum-db/gpbackup/utils"
 )
 
-func PrintCreateFunctionStatements(predataFile io.Writer, funcDefs []QueryFunctionDefinition) {
+func PrintCreateFunctionStatements(predataFile *utils.FileWithByteCount, toc *utils.TOC, funcDefs []QueryFunctionDefinition) {
 	for _, funcDef := range funcDefs {
+		start := predataFile.ByteCount
 		funcFQN := utils.MakeFQN(funcDef.SchemaName, funcDef.FunctionName)
 		utils.MustPrintf(predataFile, "\n\nCREATE FUNCTION %s(%s) RETURNS ", funcFQN, funcDef.Arguments)
 		utils.MustPrintf(predataFile, "%s AS", funcDef.ResultType)
@@ -29,6 +30,8 @@ func PrintCreateFunctionStatements(predataFile io.Writer, funcDefs []QueryFuncti
 		if funcDef.Comment != "" {
 			utils.MustPrintf(predataFile, "\nCOMMENT ON FUNCTION %s(%s) IS '%s';\n", funcFQN, funcDef.IdentArgs, funcDef.Comment)
 		}
+		funcName := fmt.Sprintf("%s(%s)", funcDef.FunctionName, funcDef.IdentArgs)
+		toc.AddPredataEntry(funcDef.SchemaName, funcName, "FUNCTION", "", start, predataFile)
 	}
 }
 
@@ -86,8 +89,9 @@ func PrintFunctionModifiers(predataFile io.Writer, funcDef QueryFunctionDefiniti
 	}
 }
 
-func PrintCreateAggregateStatements(predataFile io.Writer, aggDefs []QueryAggregateDefinition, funcInfoMap map[uint32]FunctionInfo) {
+func PrintCreateAggregateStatements(predataFile *utils.FileWithByteCount, toc *utils.TOC, aggDefs []QueryAggregateDefinition, funcInfoMap map[uint32]FunctionInfo) {
 	for _, aggDef := range aggDefs {
+		start := predataFile.ByteCount
 		aggFQN := utils.MakeFQN(aggDef.SchemaName, aggDef.AggregateName)
 		orderedStr := ""
 		if aggDef.IsOrdered {
@@ -127,11 +131,14 @@ func PrintCreateAggregateStatements(predataFile io.Writer, aggDefs []QueryAggreg
 		if aggDef.Comment != "" {
 			utils.MustPrintf(predataFile, "\nCOMMENT ON AGGREGATE %s(%s) IS '%s';\n", aggFQN, identArgumentsStr, aggDef.Comment)
 		}
+		aggName := fmt.Sprintf("%s(%s)", aggDef.AggregateName, identArgumentsStr)
+		toc.AddPredataEntry(aggDef.SchemaName, aggName, "AGGREGATE", "", start, predataFile)
 	}
 }
 
-func PrintCreateCastStatements(predataFile io.Writer, castDefs []QueryCastDefinition) {
+func PrintCreateCastStatements(predataFile *utils.FileWithByteCount, toc *utils.TOC, castDefs []QueryCastDefinition) {
 	for _, castDef := range castDefs {
+		start := predataFile.ByteCount
 		/*
 		 * Because we use pg_catalog.format_type() in the query to get the cast definition,
 		 * castDef.SourceType and castDef.TargetType are already quoted appropriately.
@@ -155,5 +162,7 @@ func PrintCreateCastStatements(predataFile io.Writer, castDefs []QueryCastDefini
 		if castDef.Comment != "" {
 			utils.MustPrintf(predataFile, "\nCOMMENT ON %s IS '%s';\n", castStr, castDef.Comment)
 		}
+		castName := fmt.Sprintf("(%s AS %s)", castDef.SourceType, castDef.TargetType)
+		toc.AddPredataEntry("", castName, "CAST", "", start, predataFile)
 	}
 }
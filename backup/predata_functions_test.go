@@ -3,6 +3,7 @@ package backup_test
 import (
 	"github.com/greenplum-db/gpbackup/backup"
 	"github.com/greenplum-db/gpbackup/testutils"
+	"github.com/greenplum-db/gpbackup/utils"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -11,9 +12,13 @@ import (
 
 var _ = Describe("backup/predata tests", func() {
 	buffer := gbytes.NewBuffer()
+	var toc *utils.TOC
+	var backupfile *utils.FileWithByteCount
 
 	BeforeEach(func() {
 		buffer = gbytes.BufferWithBytes([]byte(""))
+		toc = &utils.TOC{}
+		backupfile = utils.NewFileWithByteCount(buffer)
 	})
 	Describe("Functions involved in printing CREATE FUNCTION statements", func() {
 		var funcDef backup.QueryFunctionDefinition
@@ -27,15 +32,19 @@ var _ = Describe("backup/predata tests", func() {
 
 		Describe("PrintCreateFunctionStatements", func() {
 			It("prints a function definition for an internal function without a binary path", func() {
-				backup.PrintCreateFunctionStatements(buffer, funcDefs)
+				backup.PrintCreateFunctionStatements(backupfile, toc, funcDefs)
 				testutils.ExpectRegexp(buffer, `CREATE FUNCTION public.func_name(integer, integer) RETURNS integer AS
 $$add_two_ints$$
 LANGUAGE internal;
 `)
 			})
+			It("adds an entry for the function with its argument types to the TOC", func() {
+				backup.PrintCreateFunctionStatements(backupfile, toc, funcDefs)
+				Expect(toc.PredataEntries).To(Equal([]utils.MetadataEntry{{"public", "func_name(integer, integer)", "FUNCTION", "", 0, backupfile.ByteCount}}))
+			})
 			It("prints a function definition for a function with an owner", func() {
 				funcDefs[0].Owner = "testrole"
-				backup.PrintCreateFunctionStatements(buffer, funcDefs)
+				backup.PrintCreateFunctionStatements(backupfile, toc, funcDefs)
 				testutils.ExpectRegexp(buffer, `CREATE FUNCTION public.func_name(integer, integer) RETURNS integer AS
 $$add_two_ints$$
 LANGUAGE internal;
@@ -46,7 +55,7 @@ ALTER FUNCTION public.func_name(integer, integer) OWNER TO testrole;
 			It("prints a function definition for a function that returns a set", func() {
 				funcDefs[0].ReturnsSet = true
 				funcDefs[0].ResultType = "SETOF integer"
-				backup.PrintCreateFunctionStatements(buffer, funcDefs)
+				backup.PrintCreateFunctionStatements(backupfile, toc, funcDefs)
 				testutils.ExpectRegexp(buffer, `CREATE FUNCTION public.func_name(integer, integer) RETURNS SETOF integer AS
 $$add_two_ints$$
 LANGUAGE internal;
@@ -54,7 +63,7 @@ LANGUAGE internal;
 			})
 			It("prints a function definition for a function with a comment", func() {
 				funcDefs[0].Comment = "This is a function comment."
-				backup.PrintCreateFunctionStatements(buffer, funcDefs)
+				backup.PrintCreateFunctionStatements(backupfile, toc, funcDefs)
 				testutils.ExpectRegexp(buffer, `CREATE FUNCTION public.func_name(integer, integer) RETURNS integer AS
 $$add_two_ints$$
 LANGUAGE internal;
@@ -65,7 +74,7 @@ COMMENT ON FUNCTION public.func_name(integer, integer) IS 'This is a function co
 			It("prints a function definition for a function with an owner and a comment", func() {
 				funcDefs[0].Owner = "testrole"
 				funcDefs[0].Comment = "This is a function comment."
-				backup.PrintCreateFunctionStatements(buffer, funcDefs)
+				backup.PrintCreateFunctionStatements(backupfile, toc, funcDefs)
 				testutils.ExpectRegexp(buffer, `CREATE FUNCTION public.func_name(integer, integer) RETURNS integer AS
 $$add_two_ints$$
 LANGUAGE internal;
@@ -262,7 +271,7 @@ $_$`)
 		})
 
 		It("prints an aggregate definition for an unordered aggregate with no optional specifications", func() {
-			backup.PrintCreateAggregateStatements(buffer, aggDefs, funcInfoMap)
+			backup.PrintCreateAggregateStatements(backupfile, toc, aggDefs, funcInfoMap)
 			testutils.ExpectRegexp(buffer, `CREATE AGGREGATE public.agg_name(integer, integer) (
 	SFUNC = public.mysfunc,
 	STYPE = integer
@@ -270,7 +279,7 @@ $_$`)
 		})
 		It("prints an aggregate definition for an ordered aggregate with no optional specifications", func() {
 			aggDefs[0].IsOrdered = true
-			backup.PrintCreateAggregateStatements(buffer, aggDefs, funcInfoMap)
+			backup.PrintCreateAggregateStatements(backupfile, toc, aggDefs, funcInfoMap)
 			testutils.ExpectRegexp(buffer, `CREATE ORDERED AGGREGATE public.agg_name(integer, integer) (
 	SFUNC = public.mysfunc,
 	STYPE = integer
@@ -279,7 +288,7 @@ $_$`)
 		It("prints an aggregate definition for an unordered aggregate with no arguments", func() {
 			aggDefs[0].Arguments = ""
 			aggDefs[0].IdentArgs = ""
-			backup.PrintCreateAggregateStatements(buffer, aggDefs, funcInfoMap)
+			backup.PrintCreateAggregateStatements(backupfile, toc, aggDefs, funcInfoMap)
 			testutils.ExpectRegexp(buffer, `CREATE AGGREGATE public.agg_name(*) (
 	SFUNC = public.mysfunc,
 	STYPE = integer
@@ -287,7 +296,7 @@ $_$`)
 		})
 		It("prints an aggregate with a preliminary function", func() {
 			aggDefs[0].PreliminaryFunction = 2
-			backup.PrintCreateAggregateStatements(buffer, aggDefs, funcInfoMap)
+			backup.PrintCreateAggregateStatements(backupfile, toc, aggDefs, funcInfoMap)
 			testutils.ExpectRegexp(buffer, `CREATE AGGREGATE public.agg_name(integer, integer) (
 	SFUNC = public.mysfunc,
 	STYPE = integer,
@@ -296,7 +305,7 @@ $_$`)
 		})
 		It("prints an aggregate with a final function", func() {
 			aggDefs[0].FinalFunction = 3
-			backup.PrintCreateAggregateStatements(buffer, aggDefs, funcInfoMap)
+			backup.PrintCreateAggregateStatements(backupfile, toc, aggDefs, funcInfoMap)
 			testutils.ExpectRegexp(buffer, `CREATE AGGREGATE public.agg_name(integer, integer) (
 	SFUNC = public.mysfunc,
 	STYPE = integer,
@@ -305,7 +314,7 @@ $_$`)
 		})
 		It("prints an aggregate with an initial condition", func() {
 			aggDefs[0].InitialValue = "0"
-			backup.PrintCreateAggregateStatements(buffer, aggDefs, funcInfoMap)
+			backup.PrintCreateAggregateStatements(backupfile, toc, aggDefs, funcInfoMap)
 			testutils.ExpectRegexp(buffer, `CREATE AGGREGATE public.agg_name(integer, integer) (
 	SFUNC = public.mysfunc,
 	STYPE = integer,
@@ -314,7 +323,7 @@ $_$`)
 		})
 		It("prints an aggregate with a sort operator", func() {
 			aggDefs[0].SortOperator = 4
-			backup.PrintCreateAggregateStatements(buffer, aggDefs, funcInfoMap)
+			backup.PrintCreateAggregateStatements(backupfile, toc, aggDefs, funcInfoMap)
 			testutils.ExpectRegexp(buffer, `CREATE AGGREGATE public.agg_name(integer, integer) (
 	SFUNC = public.mysfunc,
 	STYPE = integer,
@@ -324,7 +333,7 @@ $_$`)
 		It("prints an aggregate with multiple specifications", func() {
 			aggDefs[0].FinalFunction = 3
 			aggDefs[0].SortOperator = 4
-			backup.PrintCreateAggregateStatements(buffer, aggDefs, funcInfoMap)
+			backup.PrintCreateAggregateStatements(backupfile, toc, aggDefs, funcInfoMap)
 			testutils.ExpectRegexp(buffer, `CREATE AGGREGATE public.agg_name(integer, integer) (
 	SFUNC = public.mysfunc,
 	STYPE = integer,
@@ -334,7 +343,7 @@ $_$`)
 		})
 		It("prints an aggregate with owner", func() {
 			aggDefs[0].Owner = "testrole"
-			backup.PrintCreateAggregateStatements(buffer, aggDefs, funcInfoMap)
+			backup.PrintCreateAggregateStatements(backupfile, toc, aggDefs, funcInfoMap)
 			testutils.ExpectRegexp(buffer, `CREATE AGGREGATE public.agg_name(integer, integer) (
 	SFUNC = public.mysfunc,
 	STYPE = integer
@@ -345,7 +354,7 @@ ALTER AGGREGATE public.agg_name(integer, integer) OWNER TO testrole;
 		})
 		It("prints an aggregate with comment", func() {
 			aggDefs[0].Comment = "This is an aggregate comment"
-			backup.PrintCreateAggregateStatements(buffer, aggDefs, funcInfoMap)
+			backup.PrintCreateAggregateStatements(backupfile, toc, aggDefs, funcInfoMap)
 			testutils.ExpectRegexp(buffer, `CREATE AGGREGATE public.agg_name(integer, integer) (
 	SFUNC = public.mysfunc,
 	STYPE = integer
@@ -359,7 +368,7 @@ COMMENT ON AGGREGATE public.agg_name(integer, integer) IS 'This is an aggregate
 			aggDefs[0].IdentArgs = ""
 			aggDefs[0].Owner = "testrole"
 			aggDefs[0].Comment = "This is an aggregate comment"
-			backup.PrintCreateAggregateStatements(buffer, aggDefs, funcInfoMap)
+			backup.PrintCreateAggregateStatements(backupfile, toc, aggDefs, funcInfoMap)
 			testutils.ExpectRegexp(buffer, `CREATE AGGREGATE public.agg_name(*) (
 	SFUNC = public.mysfunc,
 	STYPE = integer
@@ -374,47 +383,47 @@ COMMENT ON AGGREGATE public.agg_name(*) IS 'This is an aggregate comment';
 	Describe("PrintCreateCastStatements", func() {
 		It("prints an explicit cast with a function", func() {
 			castDef := backup.QueryCastDefinition{"src", "dst", "public", "cast_func", "integer, integer", "e", ""}
-			backup.PrintCreateCastStatements(buffer, []backup.QueryCastDefinition{castDef})
+			backup.PrintCreateCastStatements(backupfile, toc, []backup.QueryCastDefinition{castDef})
 			testutils.ExpectRegexp(buffer, `CREATE CAST (src AS dst)
 	WITH FUNCTION public.cast_func(integer, integer);`)
 		})
 		It("prints an implicit cast with a function", func() {
 			castDef := backup.QueryCastDefinition{"src", "dst", "public", "cast_func", "integer, integer", "i", ""}
-			backup.PrintCreateCastStatements(buffer, []backup.QueryCastDefinition{castDef})
+			backup.PrintCreateCastStatements(backupfile, toc, []backup.QueryCastDefinition{castDef})
 			testutils.ExpectRegexp(buffer, `CREATE CAST (src AS dst)
 	WITH FUNCTION public.cast_func(integer, integer)
 AS IMPLICIT;`)
 		})
 		It("prints an assignment cast with a function", func() {
 			castDef := backup.QueryCastDefinition{"src", "dst", "public", "cast_func", "integer, integer", "a", ""}
-			backup.PrintCreateCastStatements(buffer, []backup.QueryCastDefinition{castDef})
+			backup.PrintCreateCastStatements(backupfile, toc, []backup.QueryCastDefinition{castDef})
 			testutils.ExpectRegexp(buffer, `CREATE CAST (src AS dst)
 	WITH FUNCTION public.cast_func(integer, integer)
 AS ASSIGNMENT;`)
 		})
 		It("prints an explicit cast without a function", func() {
 			castDef := backup.QueryCastDefinition{"src", "dst", "", "", "", "e", ""}
-			backup.PrintCreateCastStatements(buffer, []backup.QueryCastDefinition{castDef})
+			backup.PrintCreateCastStatements(backupfile, toc, []backup.QueryCastDefinition{castDef})
 			testutils.ExpectRegexp(buffer, `CREATE CAST (src AS dst)
 	WITHOUT FUNCTION;`)
 		})
 		It("prints an implicit cast without a function", func() {
 			castDef := backup.QueryCastDefinition{"src", "dst", "", "", "", "i", ""}
-			backup.PrintCreateCastStatements(buffer, []backup.QueryCastDefinition{castDef})
+			backup.PrintCreateCastStatements(backupfile, toc, []backup.QueryCastDefinition{castDef})
 			testutils.ExpectRegexp(buffer, `CREATE CAST (src AS dst)
 	WITHOUT FUNCTION
 AS IMPLICIT;`)
 		})
 		It("prints an assignment cast without a function", func() {
 			castDef := backup.QueryCastDefinition{"src", "dst", "", "", "", "a", ""}
-			backup.PrintCreateCastStatements(buffer, []backup.QueryCastDefinition{castDef})
+			backup.PrintCreateCastStatements(backupfile, toc, []backup.QueryCastDefinition{castDef})
 			testutils.ExpectRegexp(buffer, `CREATE CAST (src AS dst)
 	WITHOUT FUNCTION
 AS ASSIGNMENT;`)
 		})
 		It("prints a cast with a comment", func() {
 			castDef := backup.QueryCastDefinition{"src", "dst", "", "", "", "e", "This is a cast comment."}
-			backup.PrintCreateCastStatements(buffer, []backup.QueryCastDefinition{castDef})
+			backup.PrintCreateCastStatements(backupfile, toc, []backup.QueryCastDefinition{castDef})
 			testutils.ExpectRegexp(buffer, `CREATE CAST (src AS dst)
 	WITHOUT FUNCTION;
 
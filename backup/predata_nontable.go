@@ -20,6 +20,37 @@ type Sequence struct {
 	QuerySequenceDefinition
 }
 
+/*
+ * Statements that are constructed before being printed, such as those for
+ * constraints and indexes, are stored with the information identifying their
+ * object in the TOC.  ReferenceObject is the table the object belongs to.
+ */
+type StatementWithType struct {
+	Schema          string
+	Name            string
+	ObjectType      string
+	ReferenceObject string
+	Statement       string
+}
+
+type StatementsWithType []StatementWithType
+
+func (slice StatementsWithType) Len() int {
+	return len(slice)
+}
+
+func (slice StatementsWithType) Less(i int, j int) bool {
+	return slice[i].Statement < slice[j].Statement
+}
+
+func (slice StatementsWithType) Swap(i int, j int) {
+	slice[i], slice[j] = slice[j], slice[i]
+}
+
+func SortStatementsWithType(statements StatementsWithType) {
+	sort.Sort(statements)
+}
+
 /*
  * Functions to print to the predata file
  */
@@ -89,9 +120,9 @@ func PrintObjectMetadata(file io.Writer, obj utils.ObjectMetadata, objectName st
  * tables.  Two slices are needed because FOREIGN KEY constraints must be dumped
  * after PRIMARY KEY constraints, so they're separated out to be handled last.
  */
-func ConstructConstraintsForAllTables(connection *utils.DBConn, tables []utils.Relation) ([]string, []string) {
-	allConstraints := make([]string, 0)
-	allFkConstraints := make([]string, 0)
+func ConstructConstraintsForAllTables(connection *utils.DBConn, tables []utils.Relation) ([]StatementWithType, []StatementWithType) {
+	allConstraints := make([]StatementWithType, 0)
+	allFkConstraints := make([]StatementWithType, 0)
 	for _, table := range tables {
 		constraintList := GetConstraints(connection, table.RelationOid)
 		tableConstraints, tableFkConstraints := ProcessConstraints(table, constraintList)
@@ -105,38 +136,39 @@ func ConstructConstraintsForAllTables(connection *utils.DBConn, tables []utils.R
  * There's no built-in function to generate constraint definitions like there is for other types of
  * metadata, so this function constructs them.
  */
-func ProcessConstraints(table utils.Relation, constraints []QueryConstraint) ([]string, []string) {
+func ProcessConstraints(table utils.Relation, constraints []QueryConstraint) ([]StatementWithType, []StatementWithType) {
 	alterStr := fmt.Sprintf("\n\nALTER TABLE ONLY %s ADD CONSTRAINT %s %s;", table.ToString(), "%s", "%s")
 	commentStr := fmt.Sprintf("\n\nCOMMENT ON CONSTRAINT %s ON %s IS '%s';", "%s", table.ToString(), "%s")
-	cons := make([]string, 0)
-	fkCons := make([]string, 0)
+	cons := make([]StatementWithType, 0)
+	fkCons := make([]StatementWithType, 0)
 	for _, constraint := range constraints {
 		conStr := fmt.Sprintf(alterStr, utils.QuoteIdent(constraint.ConName), constraint.ConDef)
 		if constraint.ConComment != "" {
 			conStr += fmt.Sprintf(commentStr, utils.QuoteIdent(constraint.ConName), constraint.ConComment)
 		}
+		conStatement := StatementWithType{table.SchemaName, constraint.ConName, "CONSTRAINT", table.ToString(), conStr}
 		if constraint.ConType == "f" {
-			fkCons = append(fkCons, conStr)
+			fkCons = append(fkCons, conStatement)
 		} else {
-			cons = append(cons, conStr)
+			cons = append(cons, conStatement)
 		}
 	}
 	return cons, fkCons
 }
 
-func PrintConstraintStatements(predataFile io.Writer, constraints []string, fkConstraints []string) {
-	sort.Strings(constraints)
-	sort.Strings(fkConstraints)
-	for _, constraint := range constraints {
-		utils.MustPrintln(predataFile, constraint)
-	}
-	for _, constraint := range fkConstraints {
-		utils.MustPrintln(predataFile, constraint)
+func PrintConstraintStatements(predataFile *utils.FileWithByteCount, toc *utils.TOC, constraints []StatementWithType, fkConstraints []StatementWithType) {
+	SortStatementsWithType(constraints)
+	SortStatementsWithType(fkConstraints)
+	for _, constraint := range append(constraints, fkConstraints...) {
+		start := predataFile.ByteCount
+		utils.MustPrintln(predataFile, constraint.Statement)
+		toc.AddPredataEntry(constraint.Schema, constraint.Name, constraint.ObjectType, constraint.ReferenceObject, start, predataFile)
 	}
 }
 
-func PrintCreateSchemaStatements(predataFile io.Writer, schemas []utils.Schema) {
+func PrintCreateSchemaStatements(predataFile *utils.FileWithByteCount, toc *utils.TOC, schemas []utils.Schema) {
 	for _, schema := range schemas {
+		start := predataFile.ByteCount
 		utils.MustPrintln(predataFile)
 		if schema.SchemaName != "public" {
 			utils.MustPrintf(predataFile, "\nCREATE SCHEMA %s;", schema.ToString())
@@ -147,6 +179,7 @@ func PrintCreateSchemaStatements(predataFile io.Writer, schemas []utils.Schema)
 		if schema.Comment != "" {
 			utils.MustPrintf(predataFile, "\nCOMMENT ON SCHEMA %s IS '%s';", schema.ToString(), schema.Comment)
 		}
+		toc.AddPredataEntry(schema.SchemaName, schema.SchemaName, "SCHEMA", "", start, predataFile)
 	}
 }
 
@@ -165,10 +198,11 @@ func GetAllSequences(connection *utils.DBConn) []Sequence {
  * This function is largely derived from the dumpSequence() function in pg_dump.c.  The values of
  * minVal and maxVal come from SEQ_MINVALUE and SEQ_MAXVALUE, defined in include/commands/sequence.h.
  */
-func PrintCreateSequenceStatements(predataFile io.Writer, sequences []Sequence, sequenceOwners map[string]string) {
+func PrintCreateSequenceStatements(predataFile *utils.FileWithByteCount, toc *utils.TOC, sequences []Sequence, sequenceOwners map[string]QuerySequenceOwner) {
 	maxVal := int64(9223372036854775807)
 	minVal := int64(-9223372036854775807)
 	for _, sequence := range sequences {
+		start := predataFile.ByteCount
 		seqFQN := sequence.ToString()
 		utils.MustPrintln(predataFile, "\n\nCREATE SEQUENCE", seqFQN)
 		if !sequence.IsCalled {
@@ -197,19 +231,24 @@ func PrintCreateSequenceStatements(predataFile io.Writer, sequences []Sequence,
 		if sequence.Owner != "" {
 			utils.MustPrintf(predataFile, "\n\nALTER TABLE %s OWNER TO %s;\n", seqFQN, utils.QuoteIdent(sequence.Owner))
 		}
-		// owningColumn is quoted when the map is constructed in GetSequenceOwnerMap() and doesn't need to be quoted again
-		if owningColumn, hasOwner := sequenceOwners[seqFQN]; hasOwner {
+		owningTable := ""
+		if seqOwner, hasOwner := sequenceOwners[seqFQN]; hasOwner {
+			owningColumn := utils.MakeFQN(seqOwner.TableName, seqOwner.ColumnName)
 			utils.MustPrintf(predataFile, "\n\nALTER SEQUENCE %s OWNED BY %s;\n", seqFQN, owningColumn)
+			// An owned sequence is always in the same schema as its table
+			owningTable = utils.MakeFQN(sequence.SchemaName, seqOwner.TableName)
 		}
 
 		if sequence.Comment != "" {
 			utils.MustPrintf(predataFile, "\n\nCOMMENT ON SEQUENCE %s IS '%s';\n", seqFQN, sequence.Comment)
 		}
+		toc.AddPredataEntry(sequence.SchemaName, sequence.RelationName, "SEQUENCE", owningTable, start, predataFile)
 	}
 }
 
-func PrintCreateLanguageStatements(predataFile io.Writer, procLangs []QueryProceduralLanguage, funcInfoMap map[uint32]FunctionInfo) {
+func PrintCreateLanguageStatements(predataFile *utils.FileWithByteCount, toc *utils.TOC, procLangs []QueryProceduralLanguage, funcInfoMap map[uint32]FunctionInfo) {
 	for _, procLang := range procLangs {
+		start := predataFile.ByteCount
 		quotedOwner := utils.QuoteIdent(procLang.Owner)
 		quotedLanguage := utils.QuoteIdent(procLang.Name)
 		utils.MustPrintf(predataFile, "\n\nCREATE ")
@@ -244,20 +283,23 @@ func PrintCreateLanguageStatements(predataFile io.Writer, procLangs []QueryProce
 			utils.MustPrintf(predataFile, "\n\nCOMMENT ON LANGUAGE %s IS '%s';", quotedLanguage, procLang.Comment)
 		}
 		utils.MustPrintln(predataFile)
+		toc.AddPredataEntry("", procLang.Name, "PROCEDURAL LANGUAGE", "", start, predataFile)
 	}
 }
 
-func PrintCreateViewStatements(predataFile io.Writer, views []QueryViewDefinition) {
+func PrintCreateViewStatements(predataFile *utils.FileWithByteCount, toc *utils.TOC, views []QueryViewDefinition) {
 	for _, view := range views {
+		start := predataFile.ByteCount
 		viewFQN := utils.MakeFQN(view.SchemaName, view.ViewName)
 		utils.MustPrintf(predataFile, "\n\nCREATE VIEW %s AS %s\n", viewFQN, view.Definition)
 		if view.Comment != "" {
 			utils.MustPrintf(predataFile, "\nCOMMENT ON VIEW %s IS '%s';\n", viewFQN, view.Comment)
 		}
+		toc.AddPredataEntry(view.SchemaName, view.ViewName, "VIEW", "", start, predataFile)
 	}
 }
 
-func PrintCreateExternalProtocolStatements(predataFile io.Writer, protocols []QueryExtProtocol, funcInfoMap map[uint32]FunctionInfo) {
+func PrintCreateExternalProtocolStatements(predataFile *utils.FileWithByteCount, toc *utils.TOC, protocols []QueryExtProtocol, funcInfoMap map[uint32]FunctionInfo) {
 	for _, protocol := range protocols {
 
 		hasUserDefinedFunc := false
@@ -286,6 +328,7 @@ func PrintCreateExternalProtocolStatements(predataFile io.Writer, protocols []Qu
 			protocolFunctions = append(protocolFunctions, fmt.Sprintf("validatorfunc = %s", funcInfoMap[protocol.Validator].QualifiedName))
 		}
 
+		start := predataFile.ByteCount
 		utils.MustPrintf(predataFile, "\n\nCREATE ")
 		if protocol.Trusted {
 			utils.MustPrintf(predataFile, "TRUSTED ")
@@ -295,5 +338,6 @@ func PrintCreateExternalProtocolStatements(predataFile io.Writer, protocols []Qu
 		if protocol.Owner != "" {
 			utils.MustPrintf(predataFile, "\n\nALTER PROTOCOL %s OWNER TO %s;\n", utils.QuoteIdent(protocol.Name), utils.QuoteIdent(protocol.Owner))
 		}
+		toc.AddPredataEntry("", protocol.Name, "PROTOCOL", "", start, predataFile)
 	}
 }
@@ -12,9 +12,13 @@ import (
 
 var _ = Describe("backup/predata tests", func() {
 	buffer := gbytes.NewBuffer()
+	var toc *utils.TOC
+	var backupfile *utils.FileWithByteCount
 
 	BeforeEach(func() {
 		buffer = gbytes.BufferWithBytes([]byte(""))
+		toc = &utils.TOC{}
+		backupfile = utils.NewFileWithByteCount(buffer)
 	})
 	Describe("ProcessConstraints", func() {
 		testTable := utils.BasicRelation("public", "tablename")
@@ -40,79 +44,83 @@ var _ = Describe("backup/predata tests", func() {
 				cons, fkCons := backup.ProcessConstraints(testTable, constraints)
 				Expect(len(cons)).To(Equal(1))
 				Expect(len(fkCons)).To(Equal(0))
-				Expect(cons[0]).To(Equal("\n\nALTER TABLE ONLY public.tablename ADD CONSTRAINT tablename_i_key UNIQUE (i);"))
+				Expect(cons[0].Statement).To(Equal("\n\nALTER TABLE ONLY public.tablename ADD CONSTRAINT tablename_i_key UNIQUE (i);"))
+				Expect(cons[0].Schema).To(Equal("public"))
+				Expect(cons[0].Name).To(Equal("tablename_i_key"))
+				Expect(cons[0].ObjectType).To(Equal("CONSTRAINT"))
+				Expect(cons[0].ReferenceObject).To(Equal("public.tablename"))
 			})
 			It("returns a slice containing two UNIQUE constraints", func() {
 				constraints := []backup.QueryConstraint{uniqueOne, uniqueTwo}
 				cons, fkCons := backup.ProcessConstraints(testTable, constraints)
 				Expect(len(cons)).To(Equal(2))
 				Expect(len(fkCons)).To(Equal(0))
-				Expect(cons[0]).To(Equal("\n\nALTER TABLE ONLY public.tablename ADD CONSTRAINT tablename_i_key UNIQUE (i);"))
-				Expect(cons[1]).To(Equal("\n\nALTER TABLE ONLY public.tablename ADD CONSTRAINT tablename_j_key UNIQUE (j);"))
+				Expect(cons[0].Statement).To(Equal("\n\nALTER TABLE ONLY public.tablename ADD CONSTRAINT tablename_i_key UNIQUE (i);"))
+				Expect(cons[1].Statement).To(Equal("\n\nALTER TABLE ONLY public.tablename ADD CONSTRAINT tablename_j_key UNIQUE (j);"))
 			})
 			It("returns a slice containing PRIMARY KEY constraint on one column", func() {
 				constraints := []backup.QueryConstraint{primarySingle}
 				cons, fkCons := backup.ProcessConstraints(testTable, constraints)
 				Expect(len(cons)).To(Equal(1))
 				Expect(len(fkCons)).To(Equal(0))
-				Expect(cons[0]).To(Equal("\n\nALTER TABLE ONLY public.tablename ADD CONSTRAINT tablename_pkey PRIMARY KEY (i);"))
+				Expect(cons[0].Statement).To(Equal("\n\nALTER TABLE ONLY public.tablename ADD CONSTRAINT tablename_pkey PRIMARY KEY (i);"))
 			})
 			It("returns a slice containing composite PRIMARY KEY constraint on two columns", func() {
 				constraints := []backup.QueryConstraint{primaryComposite}
 				cons, fkCons := backup.ProcessConstraints(testTable, constraints)
 				Expect(len(cons)).To(Equal(1))
 				Expect(len(fkCons)).To(Equal(0))
-				Expect(cons[0]).To(Equal("\n\nALTER TABLE ONLY public.tablename ADD CONSTRAINT tablename_pkey PRIMARY KEY (i, j);"))
+				Expect(cons[0].Statement).To(Equal("\n\nALTER TABLE ONLY public.tablename ADD CONSTRAINT tablename_pkey PRIMARY KEY (i, j);"))
 			})
 			It("returns a slice containing one FOREIGN KEY constraint", func() {
 				constraints := []backup.QueryConstraint{foreignOne}
 				cons, fkCons := backup.ProcessConstraints(testTable, constraints)
 				Expect(len(cons)).To(Equal(0))
 				Expect(len(fkCons)).To(Equal(1))
-				Expect(fkCons[0]).To(Equal("\n\nALTER TABLE ONLY public.tablename ADD CONSTRAINT tablename_i_fkey FOREIGN KEY (i) REFERENCES other_tablename(a);"))
+				Expect(fkCons[0].Statement).To(Equal("\n\nALTER TABLE ONLY public.tablename ADD CONSTRAINT tablename_i_fkey FOREIGN KEY (i) REFERENCES other_tablename(a);"))
 			})
 			It("returns a slice containing two FOREIGN KEY constraints", func() {
 				constraints := []backup.QueryConstraint{foreignOne, foreignTwo}
 				cons, fkCons := backup.ProcessConstraints(testTable, constraints)
 				Expect(len(cons)).To(Equal(0))
 				Expect(len(fkCons)).To(Equal(2))
-				Expect(fkCons[0]).To(Equal("\n\nALTER TABLE ONLY public.tablename ADD CONSTRAINT tablename_i_fkey FOREIGN KEY (i) REFERENCES other_tablename(a);"))
-				Expect(fkCons[1]).To(Equal("\n\nALTER TABLE ONLY public.tablename ADD CONSTRAINT tablename_j_fkey FOREIGN KEY (j) REFERENCES other_tablename(b);"))
+				Expect(fkCons[0].Statement).To(Equal("\n\nALTER TABLE ONLY public.tablename ADD CONSTRAINT tablename_i_fkey FOREIGN KEY (i) REFERENCES other_tablename(a);"))
+				Expect(fkCons[1].Statement).To(Equal("\n\nALTER TABLE ONLY public.tablename ADD CONSTRAINT tablename_j_fkey FOREIGN KEY (j) REFERENCES other_tablename(b);"))
 			})
 			It("returns a slice containing one UNIQUE constraint and one FOREIGN KEY constraint", func() {
 				constraints := []backup.QueryConstraint{uniqueOne, foreignTwo}
 				cons, fkCons := backup.ProcessConstraints(testTable, constraints)
 				Expect(len(cons)).To(Equal(1))
 				Expect(len(fkCons)).To(Equal(1))
-				Expect(cons[0]).To(Equal("\n\nALTER TABLE ONLY public.tablename ADD CONSTRAINT tablename_i_key UNIQUE (i);"))
-				Expect(fkCons[0]).To(Equal("\n\nALTER TABLE ONLY public.tablename ADD CONSTRAINT tablename_j_fkey FOREIGN KEY (j) REFERENCES other_tablename(b);"))
+				Expect(cons[0].Statement).To(Equal("\n\nALTER TABLE ONLY public.tablename ADD CONSTRAINT tablename_i_key UNIQUE (i);"))
+				Expect(fkCons[0].Statement).To(Equal("\n\nALTER TABLE ONLY public.tablename ADD CONSTRAINT tablename_j_fkey FOREIGN KEY (j) REFERENCES other_tablename(b);"))
 			})
 			It("returns a slice containing one PRIMARY KEY constraint and one FOREIGN KEY constraint", func() {
 				constraints := []backup.QueryConstraint{primarySingle, foreignTwo}
 				cons, fkCons := backup.ProcessConstraints(testTable, constraints)
 				Expect(len(cons)).To(Equal(1))
 				Expect(len(fkCons)).To(Equal(1))
-				Expect(cons[0]).To(Equal("\n\nALTER TABLE ONLY public.tablename ADD CONSTRAINT tablename_pkey PRIMARY KEY (i);"))
-				Expect(fkCons[0]).To(Equal("\n\nALTER TABLE ONLY public.tablename ADD CONSTRAINT tablename_j_fkey FOREIGN KEY (j) REFERENCES other_tablename(b);"))
+				Expect(cons[0].Statement).To(Equal("\n\nALTER TABLE ONLY public.tablename ADD CONSTRAINT tablename_pkey PRIMARY KEY (i);"))
+				Expect(fkCons[0].Statement).To(Equal("\n\nALTER TABLE ONLY public.tablename ADD CONSTRAINT tablename_j_fkey FOREIGN KEY (j) REFERENCES other_tablename(b);"))
 			})
 			It("returns a slice containing a two-column composite PRIMARY KEY constraint and one FOREIGN KEY constraint", func() {
 				constraints := []backup.QueryConstraint{primaryComposite, foreignTwo}
 				cons, fkCons := backup.ProcessConstraints(testTable, constraints)
 				Expect(len(cons)).To(Equal(1))
 				Expect(len(fkCons)).To(Equal(1))
-				Expect(cons[0]).To(Equal("\n\nALTER TABLE ONLY public.tablename ADD CONSTRAINT tablename_pkey PRIMARY KEY (i, j);"))
-				Expect(fkCons[0]).To(Equal("\n\nALTER TABLE ONLY public.tablename ADD CONSTRAINT tablename_j_fkey FOREIGN KEY (j) REFERENCES other_tablename(b);"))
+				Expect(cons[0].Statement).To(Equal("\n\nALTER TABLE ONLY public.tablename ADD CONSTRAINT tablename_pkey PRIMARY KEY (i, j);"))
+				Expect(fkCons[0].Statement).To(Equal("\n\nALTER TABLE ONLY public.tablename ADD CONSTRAINT tablename_j_fkey FOREIGN KEY (j) REFERENCES other_tablename(b);"))
 			})
 			It("returns a slice containing one UNIQUE constraint with a comment and one without", func() {
 				constraints := []backup.QueryConstraint{commentOne, uniqueTwo}
 				cons, _ := backup.ProcessConstraints(testTable, constraints)
 				Expect(len(cons)).To(Equal(2))
-				Expect(cons[0]).To(Equal(`
+				Expect(cons[0].Statement).To(Equal(`
 
 ALTER TABLE ONLY public.tablename ADD CONSTRAINT tablename_i_key UNIQUE (i);
 
 COMMENT ON CONSTRAINT tablename_i_key ON public.tablename IS 'This is a constraint comment.';`))
-				Expect(cons[1]).To(Equal("\n\nALTER TABLE ONLY public.tablename ADD CONSTRAINT tablename_j_key UNIQUE (j);"))
+				Expect(cons[1].Statement).To(Equal("\n\nALTER TABLE ONLY public.tablename ADD CONSTRAINT tablename_j_key UNIQUE (j);"))
 			})
 		})
 		Context("ALTER TABLE statements involving the same column", func() {
@@ -121,24 +129,24 @@ COMMENT ON CONSTRAINT tablename_i_key ON public.tablename IS 'This is a constrai
 				cons, fkCons := backup.ProcessConstraints(testTable, constraints)
 				Expect(len(cons)).To(Equal(1))
 				Expect(len(fkCons)).To(Equal(1))
-				Expect(cons[0]).To(Equal("\n\nALTER TABLE ONLY public.tablename ADD CONSTRAINT tablename_i_key UNIQUE (i);"))
-				Expect(fkCons[0]).To(Equal("\n\nALTER TABLE ONLY public.tablename ADD CONSTRAINT tablename_i_fkey FOREIGN KEY (i) REFERENCES other_tablename(a);"))
+				Expect(cons[0].Statement).To(Equal("\n\nALTER TABLE ONLY public.tablename ADD CONSTRAINT tablename_i_key UNIQUE (i);"))
+				Expect(fkCons[0].Statement).To(Equal("\n\nALTER TABLE ONLY public.tablename ADD CONSTRAINT tablename_i_fkey FOREIGN KEY (i) REFERENCES other_tablename(a);"))
 			})
 			It("returns a slice containing one PRIMARY KEY constraint and one FOREIGN KEY constraint", func() {
 				constraints := []backup.QueryConstraint{primarySingle, foreignOne}
 				cons, fkCons := backup.ProcessConstraints(testTable, constraints)
 				Expect(len(cons)).To(Equal(1))
 				Expect(len(fkCons)).To(Equal(1))
-				Expect(cons[0]).To(Equal("\n\nALTER TABLE ONLY public.tablename ADD CONSTRAINT tablename_pkey PRIMARY KEY (i);"))
-				Expect(fkCons[0]).To(Equal("\n\nALTER TABLE ONLY public.tablename ADD CONSTRAINT tablename_i_fkey FOREIGN KEY (i) REFERENCES other_tablename(a);"))
+				Expect(cons[0].Statement).To(Equal("\n\nALTER TABLE ONLY public.tablename ADD CONSTRAINT tablename_pkey PRIMARY KEY (i);"))
+				Expect(fkCons[0].Statement).To(Equal("\n\nALTER TABLE ONLY public.tablename ADD CONSTRAINT tablename_i_fkey FOREIGN KEY (i) REFERENCES other_tablename(a);"))
 			})
 			It("returns a slice containing a two-column composite PRIMARY KEY constraint and one FOREIGN KEY constraint", func() {
 				constraints := []backup.QueryConstraint{primaryComposite, foreignOne}
 				cons, fkCons := backup.ProcessConstraints(testTable, constraints)
 				Expect(len(cons)).To(Equal(1))
 				Expect(len(fkCons)).To(Equal(1))
-				Expect(cons[0]).To(Equal("\n\nALTER TABLE ONLY public.tablename ADD CONSTRAINT tablename_pkey PRIMARY KEY (i, j);"))
-				Expect(fkCons[0]).To(Equal("\n\nALTER TABLE ONLY public.tablename ADD CONSTRAINT tablename_i_fkey FOREIGN KEY (i) REFERENCES other_tablename(a);"))
+				Expect(cons[0].Statement).To(Equal("\n\nALTER TABLE ONLY public.tablename ADD CONSTRAINT tablename_pkey PRIMARY KEY (i, j);"))
+				Expect(fkCons[0].Statement).To(Equal("\n\nALTER TABLE ONLY public.tablename ADD CONSTRAINT tablename_i_fkey FOREIGN KEY (i) REFERENCES other_tablename(a);"))
 			})
 		})
 	})
@@ -240,11 +248,11 @@ GRANT TRIGGER ON TABLE public.tablename TO trigger_role;`)
 		seqStart := backup.Sequence{baseSequence, backup.QuerySequenceDefinition{"seq_name", 7, 1, 9223372036854775807, 1, 5, 42, false, false}}
 		seqComment := backup.Sequence{commentSequence, backup.QuerySequenceDefinition{"seq_name", 7, 1, 9223372036854775807, 1, 5, 42, false, true}}
 		seqOwner := backup.Sequence{ownerSequence, backup.QuerySequenceDefinition{"seq_name", 7, 1, 9223372036854775807, 1, 5, 42, false, true}}
-		emptyOwnerMap := make(map[string]string, 0)
+		emptyOwnerMap := make(map[string]backup.QuerySequenceOwner, 0)
 
 		It("can print a sequence with all default options", func() {
 			sequences := []backup.Sequence{seqDefault}
-			backup.PrintCreateSequenceStatements(buffer, sequences, emptyOwnerMap)
+			backup.PrintCreateSequenceStatements(backupfile, toc, sequences, emptyOwnerMap)
 			testutils.ExpectRegexp(buffer, `CREATE SEQUENCE public.seq_name
 	INCREMENT BY 1
 	NO MAXVALUE
@@ -255,7 +263,7 @@ SELECT pg_catalog.setval('public.seq_name', 7, true);`)
 		})
 		It("can print a decreasing sequence", func() {
 			sequences := []backup.Sequence{seqNegIncr}
-			backup.PrintCreateSequenceStatements(buffer, sequences, emptyOwnerMap)
+			backup.PrintCreateSequenceStatements(backupfile, toc, sequences, emptyOwnerMap)
 			testutils.ExpectRegexp(buffer, `CREATE SEQUENCE public.seq_name
 	INCREMENT BY -1
 	NO MAXVALUE
@@ -266,7 +274,7 @@ SELECT pg_catalog.setval('public.seq_name', 7, true);`)
 		})
 		It("can print an increasing sequence with a maximum value", func() {
 			sequences := []backup.Sequence{seqMaxPos}
-			backup.PrintCreateSequenceStatements(buffer, sequences, emptyOwnerMap)
+			backup.PrintCreateSequenceStatements(backupfile, toc, sequences, emptyOwnerMap)
 			testutils.ExpectRegexp(buffer, `CREATE SEQUENCE public.seq_name
 	INCREMENT BY 1
 	MAXVALUE 100
@@ -277,7 +285,7 @@ SELECT pg_catalog.setval('public.seq_name', 7, true);`)
 		})
 		It("can print an increasing sequence with a minimum value", func() {
 			sequences := []backup.Sequence{seqMinPos}
-			backup.PrintCreateSequenceStatements(buffer, sequences, emptyOwnerMap)
+			backup.PrintCreateSequenceStatements(backupfile, toc, sequences, emptyOwnerMap)
 			testutils.ExpectRegexp(buffer, `CREATE SEQUENCE public.seq_name
 	INCREMENT BY 1
 	NO MAXVALUE
@@ -288,7 +296,7 @@ SELECT pg_catalog.setval('public.seq_name', 7, true);`)
 		})
 		It("can print a decreasing sequence with a maximum value", func() {
 			sequences := []backup.Sequence{seqMaxNeg}
-			backup.PrintCreateSequenceStatements(buffer, sequences, emptyOwnerMap)
+			backup.PrintCreateSequenceStatements(backupfile, toc, sequences, emptyOwnerMap)
 			testutils.ExpectRegexp(buffer, `CREATE SEQUENCE public.seq_name
 	INCREMENT BY -1
 	MAXVALUE -10
@@ -299,7 +307,7 @@ SELECT pg_catalog.setval('public.seq_name', 7, true);`)
 		})
 		It("can print a decreasing sequence with a minimum value", func() {
 			sequences := []backup.Sequence{seqMinNeg}
-			backup.PrintCreateSequenceStatements(buffer, sequences, emptyOwnerMap)
+			backup.PrintCreateSequenceStatements(backupfile, toc, sequences, emptyOwnerMap)
 			testutils.ExpectRegexp(buffer, `CREATE SEQUENCE public.seq_name
 	INCREMENT BY -1
 	NO MAXVALUE
@@ -310,7 +318,7 @@ SELECT pg_catalog.setval('public.seq_name', 7, true);`)
 		})
 		It("can print a sequence that cycles", func() {
 			sequences := []backup.Sequence{seqCycle}
-			backup.PrintCreateSequenceStatements(buffer, sequences, emptyOwnerMap)
+			backup.PrintCreateSequenceStatements(backupfile, toc, sequences, emptyOwnerMap)
 			testutils.ExpectRegexp(buffer, `CREATE SEQUENCE public.seq_name
 	INCREMENT BY 1
 	NO MAXVALUE
@@ -322,7 +330,7 @@ SELECT pg_catalog.setval('public.seq_name', 7, true);`)
 		})
 		It("can print a sequence with a start value", func() {
 			sequences := []backup.Sequence{seqStart}
-			backup.PrintCreateSequenceStatements(buffer, sequences, emptyOwnerMap)
+			backup.PrintCreateSequenceStatements(backupfile, toc, sequences, emptyOwnerMap)
 			testutils.ExpectRegexp(buffer, `CREATE SEQUENCE public.seq_name
 	START WITH 7
 	INCREMENT BY 1
@@ -334,7 +342,7 @@ SELECT pg_catalog.setval('public.seq_name', 7, false);`)
 		})
 		It("can print a sequence with a comment", func() {
 			sequences := []backup.Sequence{seqComment}
-			backup.PrintCreateSequenceStatements(buffer, sequences, emptyOwnerMap)
+			backup.PrintCreateSequenceStatements(backupfile, toc, sequences, emptyOwnerMap)
 			testutils.ExpectRegexp(buffer, `CREATE SEQUENCE public.seq_name
 	INCREMENT BY 1
 	NO MAXVALUE
@@ -348,7 +356,7 @@ COMMENT ON SEQUENCE public.seq_name IS 'This is a sequence comment.';`)
 		})
 		It("can print a sequence with an owner", func() {
 			sequences := []backup.Sequence{seqOwner}
-			backup.PrintCreateSequenceStatements(buffer, sequences, emptyOwnerMap)
+			backup.PrintCreateSequenceStatements(backupfile, toc, sequences, emptyOwnerMap)
 			testutils.ExpectRegexp(buffer, `CREATE SEQUENCE public.seq_name
 	INCREMENT BY 1
 	NO MAXVALUE
@@ -362,8 +370,8 @@ ALTER TABLE public.seq_name OWNER TO testrole;`)
 		})
 		It("can print a sequence with an owning column", func() {
 			sequences := []backup.Sequence{seqOwner}
-			ownerMap := map[string]string{"public.seq_name": "tablename.col_one"}
-			backup.PrintCreateSequenceStatements(buffer, sequences, ownerMap)
+			ownerMap := map[string]backup.QuerySequenceOwner{"public.seq_name": {TableName: "tablename", ColumnName: "col_one"}}
+			backup.PrintCreateSequenceStatements(backupfile, toc, sequences, ownerMap)
 			testutils.ExpectRegexp(buffer, `CREATE SEQUENCE public.seq_name
 	INCREMENT BY 1
 	NO MAXVALUE
@@ -378,21 +386,42 @@ ALTER TABLE public.seq_name OWNER TO testrole;
 
 ALTER SEQUENCE public.seq_name OWNED BY tablename.col_one`)
 		})
+		It("adds an entry referencing the owning table to the TOC for a sequence with an owning column", func() {
+			sequences := []backup.Sequence{seqOwner}
+			ownerMap := map[string]backup.QuerySequenceOwner{"public.seq_name": {TableName: "tablename", ColumnName: "col_one"}}
+			backup.PrintCreateSequenceStatements(backupfile, toc, sequences, ownerMap)
+			Expect(toc.PredataEntries).To(Equal([]utils.MetadataEntry{{"public", "seq_name", "SEQUENCE", "public.tablename", 0, backupfile.ByteCount}}))
+		})
+		It("quotes an owning table name containing a dot", func() {
+			sequences := []backup.Sequence{seqOwner}
+			ownerMap := map[string]backup.QuerySequenceOwner{"public.seq_name": {TableName: "table.name", ColumnName: "col_one"}}
+			backup.PrintCreateSequenceStatements(backupfile, toc, sequences, ownerMap)
+			testutils.ExpectRegexp(buffer, `ALTER SEQUENCE public.seq_name OWNED BY "table.name".col_one`)
+			Expect(toc.PredataEntries).To(Equal([]utils.MetadataEntry{{"public", "seq_name", "SEQUENCE", `public."table.name"`, 0, backupfile.ByteCount}}))
+		})
 	})
 	Describe("PrintCreateSchemaStatements", func() {
 		It("can print schema with comments", func() {
 			schemas := []utils.Schema{{0, "schema_with_comments", "This is a comment.", ""}}
 
-			backup.PrintCreateSchemaStatements(buffer, schemas)
+			backup.PrintCreateSchemaStatements(backupfile, toc, schemas)
 			testutils.ExpectRegexp(buffer, `CREATE SCHEMA schema_with_comments;
 COMMENT ON SCHEMA schema_with_comments IS 'This is a comment.';`)
 		})
 		It("can print schema with no comments", func() {
 			schemas := []utils.Schema{utils.BasicSchema("schema_with_no_comments")}
 
-			backup.PrintCreateSchemaStatements(buffer, schemas)
+			backup.PrintCreateSchemaStatements(backupfile, toc, schemas)
 			testutils.ExpectRegexp(buffer, `CREATE SCHEMA schema_with_no_comments;`)
 		})
+		It("adds an entry for each schema to the TOC", func() {
+			schemas := []utils.Schema{utils.BasicSchema("schema1"), utils.BasicSchema("schema2")}
+
+			backup.PrintCreateSchemaStatements(backupfile, toc, schemas)
+			Expect(len(toc.PredataEntries)).To(Equal(2))
+			Expect(toc.PredataEntries[0]).To(Equal(utils.MetadataEntry{"schema1", "schema1", "SCHEMA", "", 0, toc.PredataEntries[1].StartByte}))
+			Expect(toc.PredataEntries[1]).To(Equal(utils.MetadataEntry{"schema2", "schema2", "SCHEMA", "", toc.PredataEntries[0].EndByte, backupfile.ByteCount}))
+		})
 	})
 	Describe("PrintCreateLanguageStatements", func() {
 		plUntrustedHandlerOnly := backup.QueryProceduralLanguage{"plpythonu", "testrole", true, false, 4, 0, 0, "", ""}
@@ -408,7 +437,7 @@ COMMENT ON SCHEMA schema_with_comments IS 'This is a comment.';`)
 		It("prints untrusted language with a handler only", func() {
 			langs := []backup.QueryProceduralLanguage{plUntrustedHandlerOnly}
 
-			backup.PrintCreateLanguageStatements(buffer, langs, funcInfoMap)
+			backup.PrintCreateLanguageStatements(backupfile, toc, langs, funcInfoMap)
 			testutils.ExpectRegexp(buffer, `CREATE PROCEDURAL LANGUAGE plpythonu;
 ALTER FUNCTION pg_catalog.plpython_call_handler() OWNER TO testrole;
 ALTER LANGUAGE plpythonu OWNER TO testrole;`)
@@ -416,7 +445,7 @@ ALTER LANGUAGE plpythonu OWNER TO testrole;`)
 		It("prints trusted language with handler, inline, validator, and comments", func() {
 			langs := []backup.QueryProceduralLanguage{plAllFields}
 
-			backup.PrintCreateLanguageStatements(buffer, langs, funcInfoMap)
+			backup.PrintCreateLanguageStatements(backupfile, toc, langs, funcInfoMap)
 			testutils.ExpectRegexp(buffer, `CREATE TRUSTED PROCEDURAL LANGUAGE plpgsql;
 ALTER FUNCTION pg_catalog.plpgsql_call_handler() OWNER TO testrole;
 ALTER FUNCTION pg_catalog.plpgsql_inline_handler(internal) OWNER TO testrole;
@@ -426,7 +455,7 @@ ALTER LANGUAGE plpgsql OWNER TO testrole;`)
 		It("prints multiple create language statements", func() {
 			langs := []backup.QueryProceduralLanguage{plUntrustedHandlerOnly, plAllFields}
 
-			backup.PrintCreateLanguageStatements(buffer, langs, funcInfoMap)
+			backup.PrintCreateLanguageStatements(backupfile, toc, langs, funcInfoMap)
 			testutils.ExpectRegexp(buffer, `CREATE PROCEDURAL LANGUAGE plpythonu;
 ALTER FUNCTION pg_catalog.plpython_call_handler() OWNER TO testrole;
 ALTER LANGUAGE plpythonu OWNER TO testrole;
@@ -441,7 +470,7 @@ ALTER LANGUAGE plpgsql OWNER TO testrole;`)
 		It("prints language with comment", func() {
 			langs := []backup.QueryProceduralLanguage{plComment}
 
-			backup.PrintCreateLanguageStatements(buffer, langs, funcInfoMap)
+			backup.PrintCreateLanguageStatements(backupfile, toc, langs, funcInfoMap)
 			testutils.ExpectRegexp(buffer, `CREATE PROCEDURAL LANGUAGE plpythonu;
 ALTER FUNCTION pg_catalog.plpython_call_handler() OWNER TO testrole;
 ALTER LANGUAGE plpythonu OWNER TO testrole;
@@ -453,7 +482,7 @@ COMMENT ON LANGUAGE plpythonu IS 'language comment'`)
 		It("prints create view statement", func() {
 			viewOne := backup.QueryViewDefinition{"public", "WowZa", "SELECT rolname FROM pg_role;", ""}
 			viewTwo := backup.QueryViewDefinition{"shamwow", "shazam", "SELECT count(*) FROM pg_tables;", "this is a view comment"}
-			backup.PrintCreateViewStatements(buffer, []backup.QueryViewDefinition{viewOne, viewTwo})
+			backup.PrintCreateViewStatements(backupfile, toc, []backup.QueryViewDefinition{viewOne, viewTwo})
 			testutils.ExpectRegexp(buffer, `CREATE VIEW public."WowZa" AS SELECT rolname FROM pg_role;
 
 
@@ -485,7 +514,7 @@ COMMENT ON VIEW shamwow.shazam IS 'this is a view comment';
 		It("prints untrusted protocol with read and write function", func() {
 			protos := []backup.QueryExtProtocol{protocolUntrustedReadWrite}
 
-			backup.PrintCreateExternalProtocolStatements(buffer, protos, funcInfoMap)
+			backup.PrintCreateExternalProtocolStatements(backupfile, toc, protos, funcInfoMap)
 			testutils.ExpectRegexp(buffer, `CREATE PROTOCOL s3 (readfunc = public.read_fn_s3, writefunc = public.write_fn_s3);
 
 ALTER PROTOCOL s3 OWNER TO testrole;`)
@@ -493,7 +522,7 @@ ALTER PROTOCOL s3 OWNER TO testrole;`)
 		It("prints untrusted protocol with read and validator", func() {
 			protos := []backup.QueryExtProtocol{protocolUntrustedReadValidator}
 
-			backup.PrintCreateExternalProtocolStatements(buffer, protos, funcInfoMap)
+			backup.PrintCreateExternalProtocolStatements(backupfile, toc, protos, funcInfoMap)
 			testutils.ExpectRegexp(buffer, `CREATE PROTOCOL s3 (readfunc = public.read_fn_s3, validatorfunc = public.validator);
 
 ALTER PROTOCOL s3 OWNER TO testrole;`)
@@ -501,7 +530,7 @@ ALTER PROTOCOL s3 OWNER TO testrole;`)
 		It("prints untrusted protocol with write function only", func() {
 			protos := []backup.QueryExtProtocol{protocolUntrustedWriteOnly}
 
-			backup.PrintCreateExternalProtocolStatements(buffer, protos, funcInfoMap)
+			backup.PrintCreateExternalProtocolStatements(backupfile, toc, protos, funcInfoMap)
 			testutils.ExpectRegexp(buffer, `CREATE PROTOCOL s3 (writefunc = public.write_fn_s3);
 
 ALTER PROTOCOL s3 OWNER TO testrole;`)
@@ -509,7 +538,7 @@ ALTER PROTOCOL s3 OWNER TO testrole;`)
 		It("prints trusted protocol with read, write, and validator", func() {
 			protos := []backup.QueryExtProtocol{protocolTrustedReadWriteValidator}
 
-			backup.PrintCreateExternalProtocolStatements(buffer, protos, funcInfoMap)
+			backup.PrintCreateExternalProtocolStatements(backupfile, toc, protos, funcInfoMap)
 			testutils.ExpectRegexp(buffer, `CREATE TRUSTED PROTOCOL s3 (readfunc = public.read_fn_s3, writefunc = public.write_fn_s3, validatorfunc = public.validator);
 
 ALTER PROTOCOL s3 OWNER TO testrole;`)
@@ -517,7 +546,7 @@ ALTER PROTOCOL s3 OWNER TO testrole;`)
 		It("prints multiple protocols", func() {
 			protos := []backup.QueryExtProtocol{protocolUntrustedWriteOnly, protocolUntrustedReadOnly}
 
-			backup.PrintCreateExternalProtocolStatements(buffer, protos, funcInfoMap)
+			backup.PrintCreateExternalProtocolStatements(backupfile, toc, protos, funcInfoMap)
 			testutils.ExpectRegexp(buffer, `CREATE PROTOCOL s3 (writefunc = public.write_fn_s3);
 
 ALTER PROTOCOL s3 OWNER TO testrole;
@@ -530,7 +559,7 @@ ALTER PROTOCOL s4 OWNER TO testrole;`)
 		It("skips printing protocols where all functions are internal", func() {
 			protos := []backup.QueryExtProtocol{protocolInternal, protocolUntrustedReadOnly}
 
-			backup.PrintCreateExternalProtocolStatements(buffer, protos, funcInfoMap)
+			backup.PrintCreateExternalProtocolStatements(backupfile, toc, protos, funcInfoMap)
 			testutils.NotExpectRegexp(buffer, `CREATE PROTOCOL gphdfs`)
 			testutils.ExpectRegexp(buffer, `CREATE PROTOCOL s4 (readfunc = public.read_fn_s4);
 
@@ -539,7 +568,7 @@ ALTER PROTOCOL s4 OWNER TO testrole;`)
 		It("skips printing protocols without validator where all functions are internal", func() {
 			protos := []backup.QueryExtProtocol{protocolInternalReadWrite, protocolUntrustedReadOnly}
 
-			backup.PrintCreateExternalProtocolStatements(buffer, protos, funcInfoMap)
+			backup.PrintCreateExternalProtocolStatements(backupfile, toc, protos, funcInfoMap)
 			testutils.NotExpectRegexp(buffer, `CREATE PROTOCOL gphdfs`)
 			testutils.ExpectRegexp(buffer, `CREATE PROTOCOL s4 (readfunc = public.read_fn_s4);
 
@@ -103,13 +103,15 @@ func ConsolidateColumnInfo(atts []QueryTableAtts, defs []QueryTableDefault) []Co
  * the search_path; this will aid in later filtering to include or exclude certain tables during the
  * backup process, and allows customers to copy just the CREATE TABLE block in order to use it directly.
  */
-func PrintCreateTableStatement(predataFile io.Writer, table utils.Relation, tableDef TableDefinition, tableMetadata utils.ObjectMetadata) {
+func PrintCreateTableStatement(predataFile *utils.FileWithByteCount, toc *utils.TOC, table utils.Relation, tableDef TableDefinition, tableMetadata utils.ObjectMetadata) {
+	start := predataFile.ByteCount
 	if tableDef.IsExternal {
 		PrintExternalTableCreateStatement(predataFile, table, tableDef)
 	} else {
 		PrintRegularTableCreateStatement(predataFile, table, tableDef)
 	}
 	PrintPostCreateTableStatements(predataFile, table, tableDef, tableMetadata)
+	toc.AddPredataEntry(table.SchemaName, table.RelationName, "TABLE", "", start, predataFile)
 }
 
 func PrintRegularTableCreateStatement(predataFile io.Writer, table utils.Relation, tableDef TableDefinition) {
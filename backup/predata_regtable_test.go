@@ -12,6 +12,8 @@ import (
 
 var _ = Describe("backup/predata tests", func() {
 	buffer := gbytes.NewBuffer()
+	var toc *utils.TOC
+	var backupfile *utils.FileWithByteCount
 	testTable := utils.BasicRelation("public", "tablename")
 
 	distRandom := "DISTRIBUTED RANDOMLY"
@@ -54,20 +56,29 @@ SET SUBPARTITION TEMPLATE
 
 	Describe("PrintCreateTableStatement", func() {
 		tableDef := backup.TableDefinition{distRandom, partDefEmpty, partTemplateDefEmpty, heapOpts, colDefsEmpty, false, extTableEmpty}
+		BeforeEach(func() {
+			toc = &utils.TOC{}
+			backupfile = utils.NewFileWithByteCount(buffer)
+		})
 		It("calls PrintRegularTableCreateStatement for a regular table", func() {
 			tableDef.IsExternal = false
-			backup.PrintCreateTableStatement(buffer, testTable, tableDef, noMetadata)
+			backup.PrintCreateTableStatement(backupfile, toc, testTable, tableDef, noMetadata)
 			testutils.ExpectRegexp(buffer, `CREATE TABLE public.tablename (
 ) DISTRIBUTED RANDOMLY;`)
 		})
 		It("calls PrintExternalTableCreateStatement for an external table", func() {
 			tableDef.IsExternal = true
-			backup.PrintCreateTableStatement(buffer, testTable, tableDef, noMetadata)
+			backup.PrintCreateTableStatement(backupfile, toc, testTable, tableDef, noMetadata)
 			testutils.ExpectRegexp(buffer, `CREATE READABLE EXTERNAL WEB TABLE public.tablename (
 ) 
 FORMAT 'text'
 ENCODING 'UTF-8';`)
 		})
+		It("adds an entry for the table to the TOC", func() {
+			tableDef.IsExternal = false
+			backup.PrintCreateTableStatement(backupfile, toc, testTable, tableDef, noMetadata)
+			Expect(toc.PredataEntries).To(Equal([]utils.MetadataEntry{{"public", "tablename", "TABLE", "", 0, backupfile.ByteCount}}))
+		})
 	})
 	Describe("PrintRegularTableCreateStatement", func() {
 		rowDropped := backup.ColumnDefinition{2, "j", false, false, true, "character varying(20)", "", "", ""}
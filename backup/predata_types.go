@@ -7,7 +7,6 @@ package backup
 
 import (
 	"fmt"
-	"io"
 	"strings"
 
 	"github.com/greenplum-db/gpbackup/utils"
@@ -21,21 +20,24 @@ import (
  * Because only base types are dependent on functions, we only need to print
  * shell type statements for base types.
  */
-func PrintShellTypeStatements(predataFile io.Writer, types []TypeDefinition) {
+func PrintShellTypeStatements(predataFile *utils.FileWithByteCount, toc *utils.TOC, types []TypeDefinition) {
 	utils.MustPrintln(predataFile, "\n")
 	for _, typ := range types {
 		if typ.Type == "b" || typ.Type == "p" {
+			start := predataFile.ByteCount
 			typeFQN := utils.MakeFQN(typ.TypeSchema, typ.TypeName)
 			utils.MustPrintf(predataFile, "CREATE TYPE %s;\n", typeFQN)
+			toc.AddPredataEntry(typ.TypeSchema, typ.TypeName, "SHELL TYPE", "", start, predataFile)
 		}
 	}
 }
 
-func PrintCreateBaseTypeStatements(predataFile io.Writer, types []TypeDefinition) {
+func PrintCreateBaseTypeStatements(predataFile *utils.FileWithByteCount, toc *utils.TOC, types []TypeDefinition) {
 	i := 0
 	for i < len(types) {
 		typ := types[i]
 		if typ.Type == "b" {
+			start := predataFile.ByteCount
 			typeFQN := utils.MakeFQN(typ.TypeSchema, typ.TypeName)
 			utils.MustPrintf(predataFile, "\n\nCREATE TYPE %s (\n", typeFQN)
 
@@ -97,15 +99,17 @@ func PrintCreateBaseTypeStatements(predataFile io.Writer, types []TypeDefinition
 			if typ.Owner != "" {
 				utils.MustPrintf(predataFile, "\nALTER TYPE %s OWNER TO %s;\n", typeFQN, typ.Owner)
 			}
+			toc.AddPredataEntry(typ.TypeSchema, typ.TypeName, "TYPE", "", start, predataFile)
 		}
 		i++
 	}
 }
 
-func PrintCreateCompositeAndEnumTypeStatements(predataFile io.Writer, types []TypeDefinition) {
+func PrintCreateCompositeAndEnumTypeStatements(predataFile *utils.FileWithByteCount, toc *utils.TOC, types []TypeDefinition) {
 	i := 0
 	for i < len(types) {
 		typ := types[i]
+		start := predataFile.ByteCount
 		if typ.Type == "c" {
 			compositeTypes := make([]TypeDefinition, 0)
 			/*
@@ -140,6 +144,7 @@ func PrintCreateCompositeAndEnumTypeStatements(predataFile io.Writer, types []Ty
 			if composite.Owner != "" {
 				utils.MustPrintf(predataFile, "\nALTER TYPE %s OWNER TO %s;\n", typeFQN, utils.QuoteIdent(composite.Owner))
 			}
+			toc.AddPredataEntry(composite.TypeSchema, composite.TypeName, "TYPE", "", start, predataFile)
 		} else if typ.Type == "e" {
 			typeFQN := utils.MakeFQN(typ.TypeSchema, typ.TypeName)
 			utils.MustPrintf(predataFile, "\n\nCREATE TYPE %s AS ENUM (\n\t%s\n);\n", typeFQN, typ.EnumLabels)
@@ -149,6 +154,7 @@ func PrintCreateCompositeAndEnumTypeStatements(predataFile io.Writer, types []Ty
 			if typ.Owner != "" {
 				utils.MustPrintf(predataFile, "\nALTER TYPE %s OWNER TO %s;\n", typeFQN, utils.QuoteIdent(typ.Owner))
 			}
+			toc.AddPredataEntry(typ.TypeSchema, typ.TypeName, "TYPE", "", start, predataFile)
 			i++
 
 		} else {
@@ -3,6 +3,7 @@ package backup_test
 import (
 	"github.com/greenplum-db/gpbackup/backup"
 	"github.com/greenplum-db/gpbackup/testutils"
+	"github.com/greenplum-db/gpbackup/utils"
 
 	. "github.com/onsi/ginkgo"
 	"github.com/onsi/gomega/gbytes"
@@ -10,9 +11,13 @@ import (
 
 var _ = Describe("backup/predata tests", func() {
 	buffer := gbytes.NewBuffer()
+	var toc *utils.TOC
+	var backupfile *utils.FileWithByteCount
 
 	BeforeEach(func() {
 		buffer = gbytes.BufferWithBytes([]byte(""))
+		toc = &utils.TOC{}
+		backupfile = utils.NewFileWithByteCount(buffer)
 	})
 	Describe("PrintCreateCompositeAndEnumTypeStatements", func() {
 		compOne := backup.TypeDefinition{TypeSchema: "public", TypeName: "composite_type", Type: "c", AttName: "bar", AttType: "integer"}
@@ -26,13 +31,13 @@ var _ = Describe("backup/predata tests", func() {
 		enumTwo := backup.TypeDefinition{TypeSchema: "public", TypeName: "enum_type", Type: "e", EnumLabels: "'bar',\n\t'baz',\n\t'foo'", Comment: "This is an enum type comment", Owner: "testrole"}
 
 		It("prints a composite type with one attribute", func() {
-			backup.PrintCreateCompositeAndEnumTypeStatements(buffer, []backup.TypeDefinition{compOne})
+			backup.PrintCreateCompositeAndEnumTypeStatements(backupfile, toc, []backup.TypeDefinition{compOne})
 			testutils.ExpectRegexp(buffer, `CREATE TYPE public.composite_type AS (
 	bar integer
 );`)
 		})
 		It("prints a composite type with multiple attributes", func() {
-			backup.PrintCreateCompositeAndEnumTypeStatements(buffer, []backup.TypeDefinition{compOne, compTwo, compThree})
+			backup.PrintCreateCompositeAndEnumTypeStatements(backupfile, toc, []backup.TypeDefinition{compOne, compTwo, compThree})
 			testutils.ExpectRegexp(buffer, `CREATE TYPE public.composite_type AS (
 	bar integer,
 	baz text,
@@ -40,7 +45,7 @@ var _ = Describe("backup/predata tests", func() {
 );`)
 		})
 		It("prints a composite type with comment and owner", func() {
-			backup.PrintCreateCompositeAndEnumTypeStatements(buffer, []backup.TypeDefinition{compCommentOwnerOne, compCommentOwnerTwo})
+			backup.PrintCreateCompositeAndEnumTypeStatements(backupfile, toc, []backup.TypeDefinition{compCommentOwnerOne, compCommentOwnerTwo})
 			testutils.ExpectRegexp(buffer, `CREATE TYPE public.composite_type AS (
 	bar integer,
 	foo float
@@ -51,7 +56,7 @@ COMMENT ON TYPE public.composite_type IS 'This is a type comment.';
 ALTER TYPE public.composite_type OWNER TO testrole;`)
 		})
 		It("prints an enum type with multiple attributes", func() {
-			backup.PrintCreateCompositeAndEnumTypeStatements(buffer, []backup.TypeDefinition{enumOne})
+			backup.PrintCreateCompositeAndEnumTypeStatements(backupfile, toc, []backup.TypeDefinition{enumOne})
 			testutils.ExpectRegexp(buffer, `CREATE TYPE public.enum_type AS ENUM (
 	'bar',
 	'baz',
@@ -59,7 +64,7 @@ ALTER TYPE public.composite_type OWNER TO testrole;`)
 );`)
 		})
 		It("prints an enum type with comment and owner", func() {
-			backup.PrintCreateCompositeAndEnumTypeStatements(buffer, []backup.TypeDefinition{enumTwo})
+			backup.PrintCreateCompositeAndEnumTypeStatements(backupfile, toc, []backup.TypeDefinition{enumTwo})
 			testutils.ExpectRegexp(buffer, `CREATE TYPE public.enum_type AS ENUM (
 	'bar',
 	'baz',
@@ -71,7 +76,7 @@ COMMENT ON TYPE public.enum_type IS 'This is an enum type comment';
 ALTER TYPE public.enum_type OWNER TO testrole;`)
 		})
 		It("prints both an enum type and a composite type", func() {
-			backup.PrintCreateCompositeAndEnumTypeStatements(buffer, []backup.TypeDefinition{compOne, enumOne})
+			backup.PrintCreateCompositeAndEnumTypeStatements(backupfile, toc, []backup.TypeDefinition{compOne, enumOne})
 			testutils.ExpectRegexp(buffer, `CREATE TYPE public.composite_type AS (
 	bar integer
 );
@@ -99,14 +104,14 @@ CREATE TYPE public.enum_type AS ENUM (
 			"-", "-", "-", "-", -1, false, "c", "p", "", "-", "", "", "This is a type comment.", "testrole"}
 
 		It("prints a base type with no optional arguments", func() {
-			backup.PrintCreateBaseTypeStatements(buffer, []backup.TypeDefinition{baseSimple})
+			backup.PrintCreateBaseTypeStatements(backupfile, toc, []backup.TypeDefinition{baseSimple})
 			testutils.ExpectRegexp(buffer, `CREATE TYPE public.base_type (
 	INPUT = input_fn,
 	OUTPUT = output_fn
 );`)
 		})
 		It("prints a base type where all optional arguments have default values where possible", func() {
-			backup.PrintCreateBaseTypeStatements(buffer, []backup.TypeDefinition{basePartial})
+			backup.PrintCreateBaseTypeStatements(backupfile, toc, []backup.TypeDefinition{basePartial})
 			testutils.ExpectRegexp(buffer, `CREATE TYPE public.base_type (
 	INPUT = input_fn,
 	OUTPUT = output_fn,
@@ -120,7 +125,7 @@ CREATE TYPE public.enum_type AS ENUM (
 );`)
 		})
 		It("prints a base type with all optional arguments provided", func() {
-			backup.PrintCreateBaseTypeStatements(buffer, []backup.TypeDefinition{baseFull})
+			backup.PrintCreateBaseTypeStatements(backupfile, toc, []backup.TypeDefinition{baseFull})
 			testutils.ExpectRegexp(buffer, `CREATE TYPE public.base_type (
 	INPUT = input_fn,
 	OUTPUT = output_fn,
@@ -138,7 +143,7 @@ CREATE TYPE public.enum_type AS ENUM (
 );`)
 		})
 		It("prints a base type with double alignment and main storage", func() {
-			backup.PrintCreateBaseTypeStatements(buffer, []backup.TypeDefinition{basePermOne})
+			backup.PrintCreateBaseTypeStatements(backupfile, toc, []backup.TypeDefinition{basePermOne})
 			testutils.ExpectRegexp(buffer, `CREATE TYPE public.base_type (
 	INPUT = input_fn,
 	OUTPUT = output_fn,
@@ -147,7 +152,7 @@ CREATE TYPE public.enum_type AS ENUM (
 );`)
 		})
 		It("prints a base type with int4 alignment and external storage", func() {
-			backup.PrintCreateBaseTypeStatements(buffer, []backup.TypeDefinition{basePermTwo})
+			backup.PrintCreateBaseTypeStatements(backupfile, toc, []backup.TypeDefinition{basePermTwo})
 			testutils.ExpectRegexp(buffer, `CREATE TYPE public.base_type (
 	INPUT = input_fn,
 	OUTPUT = output_fn,
@@ -156,7 +161,7 @@ CREATE TYPE public.enum_type AS ENUM (
 );`)
 		})
 		It("prints a base type with comment and owner", func() {
-			backup.PrintCreateBaseTypeStatements(buffer, []backup.TypeDefinition{baseCommentOwner})
+			backup.PrintCreateBaseTypeStatements(backupfile, toc, []backup.TypeDefinition{baseCommentOwner})
 			testutils.ExpectRegexp(buffer, `CREATE TYPE public.base_type (
 	INPUT = input_fn,
 	OUTPUT = output_fn
@@ -176,7 +181,7 @@ ALTER TYPE public.base_type OWNER TO testrole;`)
 		compTwo := backup.TypeDefinition{TypeSchema: "public", TypeName: "composite_type2", Type: "c", AttName: "bar", AttType: "integer"}
 		enumOne := backup.TypeDefinition{TypeSchema: "public", TypeName: "enum_type", Type: "e", EnumLabels: "'bar',\n\t'baz',\n\t'foo'"}
 		It("prints shell type for only a base type", func() {
-			backup.PrintShellTypeStatements(buffer, []backup.TypeDefinition{baseOne, baseTwo, compOne, compTwo, enumOne})
+			backup.PrintShellTypeStatements(backupfile, toc, []backup.TypeDefinition{baseOne, baseTwo, compOne, compTwo, enumOne})
 			testutils.ExpectRegexp(buffer, `CREATE TYPE public.base_type1;
 CREATE TYPE public.base_type2;`)
 		})
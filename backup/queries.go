@@ -35,6 +35,80 @@ AND nspname NOT LIKE 'pg_toast%'
 AND nspname NOT IN ('gp_toolkit', 'information_schema', 'pg_aoseg', 'pg_bitmapindex', 'pg_catalog')`
 )
 
+/*
+ * Functions for building WHERE clauses that apply the schema and table filters
+ * passed on the command line, so that filtered-out objects are never queried
+ */
+
+// The clause uses the unqualified nspname column, so the query must join pg_namespace only once
+func SchemaFilterClause() string {
+	filterClauses := nonUserSchemaFilterClause
+	if len(includeSchemas) > 0 {
+		filterClauses += fmt.Sprintf("\nAND nspname IN (%s)", quoteSchemaList(includeSchemas))
+	}
+	if len(excludeSchemas) > 0 {
+		filterClauses += fmt.Sprintf("\nAND nspname NOT IN (%s)", quoteSchemaList(excludeSchemas))
+	}
+	return filterClauses
+}
+
+/*
+ * The clause expects the relation to be filtered to be aliased as "c" and its
+ * schema as "n".  It is used for views, rules, and triggers as well as for
+ * tables, so that the objects belonging to a filtered-out table are also
+ * filtered out.
+ */
+func TableFilterClause() string {
+	filterClauses := ""
+	if len(includeTables) > 0 {
+		filterClauses += fmt.Sprintf("\nAND (n.nspname, c.relname) IN (%s)", quoteTableList(includeTables))
+	}
+	if len(excludeTables) > 0 {
+		filterClauses += fmt.Sprintf("\nAND (n.nspname, c.relname) NOT IN (%s)", quoteTableList(excludeTables))
+	}
+	return filterClauses
+}
+
+/*
+ * A sequence owned by a table column (e.g. for a serial column) is backed up
+ * if and only if its table is, so the clause checks the owning table instead
+ * of the sequence itself.  The sequence must be aliased as "c".
+ */
+func SequenceFilterClause() string {
+	ownedByTablesQuery := `SELECT d.objid
+	FROM pg_depend d
+	JOIN pg_class t ON t.oid = d.refobjid
+	JOIN pg_namespace tn ON tn.oid = t.relnamespace
+	WHERE d.classid = 'pg_class'::regclass
+	AND d.refclassid = 'pg_class'::regclass
+	AND d.deptype = 'a'
+	AND (tn.nspname, t.relname) IN (%s)`
+	filterClauses := ""
+	if len(includeTables) > 0 {
+		filterClauses += fmt.Sprintf("\nAND c.oid IN (%s)", fmt.Sprintf(ownedByTablesQuery, quoteTableList(includeTables)))
+	}
+	if len(excludeTables) > 0 {
+		filterClauses += fmt.Sprintf("\nAND c.oid NOT IN (%s)", fmt.Sprintf(ownedByTablesQuery, quoteTableList(excludeTables)))
+	}
+	return filterClauses
+}
+
+func quoteSchemaList(schemas []utils.Schema) string {
+	quotedSchemas := make([]string, 0)
+	for _, schema := range schemas {
+		quotedSchemas = append(quotedSchemas, utils.QuoteLiteral(schema.SchemaName))
+	}
+	return strings.Join(quotedSchemas, ", ")
+}
+
+func quoteTableList(tables []utils.Relation) string {
+	quotedTables := make([]string, 0)
+	for _, table := range tables {
+		quotedTables = append(quotedTables, fmt.Sprintf("(%s, %s)", utils.QuoteLiteral(table.SchemaName), utils.QuoteLiteral(table.RelationName)))
+	}
+	return strings.Join(quotedTables, ", ")
+}
+
 /*
  * Queries requiring their own structs
  */
@@ -53,7 +127,7 @@ SELECT
 	pg_get_userbyid(nspowner) AS owner
 FROM pg_namespace
 WHERE %s
-ORDER BY schemaname;`, nonUserSchemaFilterClause)
+ORDER BY schemaname;`, SchemaFilterClause())
 	results := make([]utils.Schema, 0)
 
 	err := connection.Select(&results, query)
@@ -63,7 +137,7 @@ ORDER BY schemaname;`, nonUserSchemaFilterClause)
 
 func GetAllUserTables(connection *utils.DBConn) []utils.Relation {
 	// This query is adapted from the getTables() function in pg_dump.c.
-	query := `
+	query := fmt.Sprintf(`
 SELECT
 	n.oid AS schemaoid,
 	c.oid AS relationoid,
@@ -86,7 +160,8 @@ JOIN pg_exttable e
 WHERE e.reloid IS NULL)
 AND (c.relnamespace > 16384
 OR n.nspname = 'public')
-ORDER BY schemaname, relationname;`
+AND %s%s
+ORDER BY schemaname, relationname;`, SchemaFilterClause(), TableFilterClause())
 
 	results := make([]utils.Relation, 0)
 
@@ -95,6 +170,94 @@ ORDER BY schemaname, relationname;`
 	return results
 }
 
+/*
+ * Modes are given as they are in a LOCK TABLE statement, and the modes they
+ * conflict with as they appear in pg_locks.
+ */
+var lockConflicts = map[string][]string{
+	"ACCESS SHARE":           {"AccessExclusiveLock"},
+	"ROW SHARE":              {"ExclusiveLock", "AccessExclusiveLock"},
+	"ROW EXCLUSIVE":          {"ShareLock", "ShareRowExclusiveLock", "ExclusiveLock", "AccessExclusiveLock"},
+	"SHARE UPDATE EXCLUSIVE": {"ShareUpdateExclusiveLock", "ShareLock", "ShareRowExclusiveLock", "ExclusiveLock", "AccessExclusiveLock"},
+	"SHARE":                  {"RowExclusiveLock", "ShareUpdateExclusiveLock", "ShareRowExclusiveLock", "ExclusiveLock", "AccessExclusiveLock"},
+	"SHARE ROW EXCLUSIVE":    {"RowExclusiveLock", "ShareUpdateExclusiveLock", "ShareLock", "ShareRowExclusiveLock", "ExclusiveLock", "AccessExclusiveLock"},
+	"EXCLUSIVE":              {"RowShareLock", "RowExclusiveLock", "ShareUpdateExclusiveLock", "ShareLock", "ShareRowExclusiveLock", "ExclusiveLock", "AccessExclusiveLock"},
+	"ACCESS EXCLUSIVE":       {"AccessShareLock", "RowShareLock", "RowExclusiveLock", "ShareUpdateExclusiveLock", "ShareLock", "ShareRowExclusiveLock", "ExclusiveLock", "AccessExclusiveLock"},
+}
+
+type QueryLockHolder struct {
+	Pid      int
+	UserName string
+	Mode     string
+	Query    string
+}
+
+/*
+ * Returns the sessions other than this one holding locks on the table that
+ * conflict with the given lock mode.  A session holding a lock on several
+ * segments is only listed once for each lock mode.
+ */
+func GetLockHolders(connection *utils.DBConn, table utils.Relation, lockMode string) []QueryLockHolder {
+	query := fmt.Sprintf(`
+SELECT DISTINCT
+	l.pid,
+	a.usename AS username,
+	l.mode,
+	a.current_query AS query
+FROM pg_locks l
+JOIN pg_stat_activity a
+	ON l.pid = a.procpid
+WHERE l.relation = %d
+AND l.granted
+AND l.pid <> pg_backend_pid()
+AND l.mode IN ('%s')
+ORDER BY l.pid, l.mode;`, table.RelationOid, strings.Join(lockConflicts[lockMode], "', '"))
+
+	results := make([]QueryLockHolder, 0)
+	err := connection.Select(&results, query)
+	utils.CheckError(err)
+	return results
+}
+
+type QueryTableSize struct {
+	Oid  uint32
+	Size int64
+}
+
+/*
+ * The size of a partitioned table is the sum of the sizes of all of its partitions,
+ * since the data of every partition is dumped along with the parent table.
+ */
+func GetTableSizes(connection *utils.DBConn, tables []utils.Relation) map[uint32]int64 {
+	tableSizes := make(map[uint32]int64, 0)
+	if len(tables) == 0 {
+		return tableSizes
+	}
+	oidList := make([]string, 0)
+	for _, table := range tables {
+		oidList = append(oidList, fmt.Sprintf("%d", table.RelationOid))
+	}
+	query := fmt.Sprintf(`
+SELECT
+	c.oid,
+	(pg_relation_size(c.oid) + coalesce((SELECT
+		sum(pg_relation_size(pr.parchildrelid))
+	FROM pg_partition_rule pr
+	JOIN pg_partition p
+		ON pr.paroid = p.oid
+	WHERE p.parrelid = c.oid), 0))::bigint AS size
+FROM pg_class c
+WHERE c.oid IN (%s);`, strings.Join(oidList, ", "))
+
+	results := make([]QueryTableSize, 0)
+	err := connection.Select(&results, query)
+	utils.CheckError(err)
+	for _, result := range results {
+		tableSizes[result.Oid] = result.Size
+	}
+	return tableSizes
+}
+
 type QueryTableAtts struct {
 	AttNum        int
 	AttName       string
@@ -205,7 +368,7 @@ WHERE a.attrelid = %d;`, oid)
 }
 
 func GetAllSequenceRelations(connection *utils.DBConn) []utils.Relation {
-	query := `SELECT
+	query := fmt.Sprintf(`SELECT
 	n.oid AS schemaoid,
 	c.oid AS relationoid,
 	n.nspname AS schemaname,
@@ -216,7 +379,8 @@ FROM pg_class c
 LEFT JOIN pg_namespace n
 	ON c.relnamespace = n.oid
 WHERE relkind = 'S'
-ORDER BY schemaname, relationname;`
+AND %s%s
+ORDER BY schemaname, relationname;`, SchemaFilterClause(), SequenceFilterClause())
 
 	results := make([]utils.Relation, 0)
 	err := connection.Select(&results, query)
@@ -251,7 +415,12 @@ type QuerySequenceOwner struct {
 	ColumnName   string `db:"attname"`
 }
 
-func GetSequenceOwnerMap(connection *utils.DBConn) map[string]string {
+/*
+ * Returns a map of each owned sequence's FQN to its owning table and column,
+ * which are kept separate and unquoted so that identifiers containing dots
+ * can be told apart from the separator between them.
+ */
+func GetSequenceOwnerMap(connection *utils.DBConn) map[string]QuerySequenceOwner {
 	query := `SELECT
 	n.nspname,
 	s.relname AS sequencename,
@@ -269,13 +438,12 @@ JOIN pg_namespace n
 WHERE s.relkind = 'S';`
 
 	results := make([]QuerySequenceOwner, 0)
-	sequenceOwners := make(map[string]string, 0)
+	sequenceOwners := make(map[string]QuerySequenceOwner, 0)
 	err := connection.Select(&results, query)
 	utils.CheckError(err)
 	for _, seqOwner := range results {
 		seqFQN := utils.MakeFQN(seqOwner.SchemaName, seqOwner.SequenceName)
-		columnFQN := utils.MakeFQN(seqOwner.TableName, seqOwner.ColumnName)
-		sequenceOwners[seqFQN] = columnFQN
+		sequenceOwners[seqFQN] = seqOwner
 	}
 	return sequenceOwners
 }
@@ -385,7 +553,7 @@ ORDER BY name;`, oid)
  * built-in rules and we don't want to dump them.
  */
 func GetRuleMetadata(connection *utils.DBConn) []QuerySimpleDefinition {
-	query := `
+	query := fmt.Sprintf(`
 SELECT
 	r.rulename AS name,
 	n.nspname AS owningschema,
@@ -397,9 +565,10 @@ JOIN pg_class c
 	ON (c.oid = r.ev_class)
 JOIN pg_namespace n
 	ON (c.relnamespace = n.oid)
-WHERE rulename NOT LIKE '%RETURN'
-AND rulename NOT LIKE 'pg_%'
-ORDER BY rulename;`
+WHERE rulename NOT LIKE '%%RETURN'
+AND rulename NOT LIKE 'pg_%%'
+AND %s%s
+ORDER BY rulename;`, SchemaFilterClause(), TableFilterClause())
 
 	results := make([]QuerySimpleDefinition, 0)
 	err := connection.Select(&results, query)
@@ -408,7 +577,7 @@ ORDER BY rulename;`
 }
 
 func GetTriggerMetadata(connection *utils.DBConn) []QuerySimpleDefinition {
-	query := `
+	query := fmt.Sprintf(`
 SELECT
 	t.tgname AS name,
 	n.nspname AS owningschema,
@@ -420,9 +589,10 @@ JOIN pg_class c
 	ON (c.oid = t.tgrelid)
 JOIN pg_namespace n
 	ON (c.relnamespace = n.oid)
-WHERE tgname NOT LIKE 'pg_%'
+WHERE tgname NOT LIKE 'pg_%%'
 AND tgisconstraint = 'f'
-ORDER BY tgname;`
+AND %s%s
+ORDER BY tgname;`, SchemaFilterClause(), TableFilterClause())
 
 	results := make([]QuerySimpleDefinition, 0)
 	err := connection.Select(&results, query)
@@ -484,7 +654,7 @@ LEFT JOIN pg_namespace n
 	ON p.pronamespace = n.oid
 WHERE %s
 AND proisagg = 'f'
-ORDER BY nspname, proname, identargs;`, nonUserSchemaFilterClause)
+ORDER BY nspname, proname, identargs;`, SchemaFilterClause())
 
 	results := make([]QueryFunctionDefinition, 0)
 	err := connection.Select(&results, query)
@@ -528,7 +698,7 @@ FROM pg_aggregate a
 LEFT JOIN pg_proc p ON a.aggfnoid = p.oid
 LEFT JOIN pg_type t ON a.aggtranstype = t.oid
 LEFT JOIN pg_namespace n ON p.pronamespace = n.oid
-WHERE %s;`, nonUserSchemaFilterClause)
+WHERE %s;`, SchemaFilterClause())
 
 	results := make([]QueryAggregateDefinition, 0)
 	err := connection.Select(&results, query)
@@ -602,7 +772,7 @@ LEFT JOIN pg_proc p ON c.castfunc = p.oid
 LEFT JOIN pg_description d ON c.oid = d.objoid
 JOIN pg_namespace n ON p.pronamespace = n.oid
 WHERE %s
-ORDER BY 1, 2;`, nonUserSchemaFilterClause)
+ORDER BY 1, 2;`, SchemaFilterClause())
 
 	results := make([]QueryCastDefinition, 0)
 	err := connection.Select(&results, query)
@@ -678,7 +848,7 @@ AND (t.typtype = 'c' OR t.typtype = 'b' OR t.typtype='e' OR t.typtype='p')
 AND (n.nspname || '.' || t.typname) NOT IN (SELECT nspname || '._' || relname FROM pg_namespace n join pg_class c ON n.oid = c.relnamespace WHERE c.relkind = 'r' OR c.relkind = 'S' OR c.relkind = 'v')
 AND (n.nspname || '.' || t.typname) NOT IN (SELECT nspname || '.' || relname FROM pg_namespace n join pg_class c ON n.oid = c.relnamespace WHERE c.relkind = 'r' OR c.relkind = 'S' OR c.relkind = 'v')
 AND (n.nspname || '.' || t.typname) NOT IN (SELECT nspname || '._' || typname FROM pg_namespace n join pg_type t ON n.oid = t.typnamespace)
-ORDER BY n.nspname, t.typname, a.attname;`, nonUserSchemaFilterClause)
+ORDER BY n.nspname, t.typname, a.attname;`, SchemaFilterClause())
 
 	results := make([]TypeDefinition, 0)
 	err := connection.Select(&results, query)
@@ -744,6 +914,118 @@ ORDER BY o.oid, privileges;
 	return metadataMap
 }
 
+type QueryAORelation struct {
+	Oid           uint32
+	RelStorage    string
+	AOSegTableFQN string
+}
+
+type QueryLastDDLTimestamp struct {
+	Oid              uint32
+	LastDDLTimestamp string
+}
+
+/*
+ * Returns the state of each of the given tables that is append-optimized,
+ * keyed by the table's FQN.  A partitioned table is only considered to be
+ * append-optimized if it and all of its partitions are, as the modification
+ * counts of heap partitions are not tracked.  The modification count of an
+ * append-optimized relation is stored in its aoseg table, which has to be
+ * queried separately for each relation.
+ */
+func GetAOTableStates(connection *utils.DBConn, tables []utils.Relation) map[string]utils.AOTableState {
+	aoTableStates := make(map[string]utils.AOTableState, 0)
+	if len(tables) == 0 {
+		return aoTableStates
+	}
+	oidList := make([]string, 0)
+	for _, table := range tables {
+		oidList = append(oidList, fmt.Sprintf("%d", table.RelationOid))
+	}
+	relationQuery := fmt.Sprintf(`
+SELECT
+	coalesce(p.parrelid, c.oid) AS oid,
+	c.relstorage,
+	coalesce(quote_ident(sn.nspname) || '.' || quote_ident(s.relname), '') AS aosegtablefqn
+FROM pg_class c
+LEFT JOIN pg_appendonly a
+	ON c.oid = a.relid
+LEFT JOIN pg_class s
+	ON a.segrelid = s.oid
+LEFT JOIN pg_namespace sn
+	ON s.relnamespace = sn.oid
+LEFT JOIN pg_partition_rule pr
+	ON c.oid = pr.parchildrelid
+LEFT JOIN pg_partition p
+	ON pr.paroid = p.oid
+WHERE c.relkind = 'r'
+AND coalesce(p.parrelid, c.oid) IN (%s);`, strings.Join(oidList, ", "))
+	relations := make([]QueryAORelation, 0)
+	err := connection.Select(&relations, relationQuery)
+	utils.CheckError(err)
+
+	ddlQuery := fmt.Sprintf(`
+SELECT
+	coalesce(p.parrelid, c.oid) AS oid,
+	max(lo.statime)::text AS lastddltimestamp
+FROM pg_stat_last_operation lo
+JOIN pg_class c
+	ON lo.objid = c.oid
+LEFT JOIN pg_partition_rule pr
+	ON c.oid = pr.parchildrelid
+LEFT JOIN pg_partition p
+	ON pr.paroid = p.oid
+WHERE lo.classid = 'pg_class'::regclass
+AND lo.staactionname IN ('CREATE', 'ALTER', 'TRUNCATE')
+AND coalesce(p.parrelid, c.oid) IN (%s)
+GROUP BY coalesce(p.parrelid, c.oid);`, strings.Join(oidList, ", "))
+	ddlTimestamps := make([]QueryLastDDLTimestamp, 0)
+	err = connection.Select(&ddlTimestamps, ddlQuery)
+	utils.CheckError(err)
+	ddlTimestampMap := make(map[uint32]string, 0)
+	for _, ddlTimestamp := range ddlTimestamps {
+		ddlTimestampMap[ddlTimestamp.Oid] = ddlTimestamp.LastDDLTimestamp
+	}
+
+	aoSegTables := make(map[uint32][]string, 0)
+	isAppendOptimized := make(map[uint32]bool, 0)
+	for _, relation := range relations {
+		if _, ok := isAppendOptimized[relation.Oid]; !ok {
+			isAppendOptimized[relation.Oid] = true
+		}
+		if (relation.RelStorage != "a" && relation.RelStorage != "c") || relation.AOSegTableFQN == "" {
+			isAppendOptimized[relation.Oid] = false
+			continue
+		}
+		aoSegTables[relation.Oid] = append(aoSegTables[relation.Oid], relation.AOSegTableFQN)
+	}
+	for _, table := range tables {
+		if !isAppendOptimized[table.RelationOid] {
+			continue
+		}
+		aoTableStates[table.ToString()] = utils.AOTableState{
+			ModCount:         getModCount(connection, aoSegTables[table.RelationOid]),
+			LastDDLTimestamp: ddlTimestampMap[table.RelationOid],
+		}
+	}
+	return aoTableStates
+}
+
+func getModCount(connection *utils.DBConn, aoSegTableFQNs []string) int64 {
+	selectList := make([]string, 0)
+	for _, aoSegTableFQN := range aoSegTableFQNs {
+		selectList = append(selectList, fmt.Sprintf("SELECT modcount FROM %s", aoSegTableFQN))
+	}
+	query := fmt.Sprintf("SELECT coalesce(sum(modcount), 0)::bigint AS modcount FROM (%s) AS modcounts;", strings.Join(selectList, " UNION ALL "))
+	results := make([]struct{ ModCount int64 }, 0)
+	err := connection.Select(&results, query)
+	utils.CheckError(err)
+	if len(results) == 0 {
+		return 0
+	}
+	return results[0].ModCount
+}
+
 func GetExternalTablesMap(connection *utils.DBConn) map[string]bool {
 	extTableMap := make(map[string]bool)
 	query := `
@@ -807,15 +1089,26 @@ func GetDatabaseGUCs(connection *utils.DBConn) []string {
 	query := fmt.Sprintf(`
 SELECT ('SET ' || option_name || ' TO ' || option_value) AS string
 FROM pg_options_to_table(
-	(SELECT datconfig FROM pg_database WHERE datname = '%s')
-);`, connection.DBName)
+	(SELECT datconfig FROM pg_database WHERE datname = %s)
+);`, utils.QuoteLiteral(connection.DBName))
 	return SelectStringSlice(connection, query)
 }
 
 func GetDatabaseOwner(connection *utils.DBConn) string {
 	query := fmt.Sprintf(`SELECT pg_catalog.pg_get_userbyid(datdba) AS string
 FROM pg_database
-WHERE datname = '%s';`, connection.DBName)
+WHERE datname = %s;`, utils.QuoteLiteral(connection.DBName))
+	return SelectString(connection, query)
+}
+
+func GetDatabaseVersion(connection *utils.DBConn) string {
+	return SelectString(connection, "SELECT version() AS string;")
+}
+
+func GetDatabaseEncoding(connection *utils.DBConn) string {
+	query := fmt.Sprintf(`SELECT pg_catalog.pg_encoding_to_char(encoding) AS string
+FROM pg_database
+WHERE datname = %s;`, utils.QuoteLiteral(connection.DBName))
 	return SelectString(connection, query)
 }
 
@@ -846,7 +1139,7 @@ WHERE oid = %d AND reloptions IS NOT NULL;`, oid)
 func GetDatabaseComment(connection *utils.DBConn) string {
 	query := fmt.Sprintf(`SELECT description AS string FROM pg_shdescription
 JOIN pg_database ON objoid = pg_database.oid
-WHERE datname = '%s';`, connection.DBName)
+WHERE datname = %s;`, utils.QuoteLiteral(connection.DBName))
 	return SelectString(connection, query)
 }
 
@@ -899,7 +1192,8 @@ SELECT n.nspname AS schemaname,
 	coalesce(obj_description(c.oid, 'pg_class'), '') AS comment
 FROM pg_class c
 LEFT JOIN pg_namespace n ON n.oid = c.relnamespace
-WHERE c.relkind = 'v'::"char" AND %s;`, nonUserSchemaFilterClause)
+WHERE c.relkind = 'v'::"char"
+AND %s%s;`, SchemaFilterClause(), TableFilterClause())
 	err := connection.Select(&results, query)
 	utils.CheckError(err)
 	return results
@@ -44,6 +44,41 @@ var _ = Describe("backup/queries tests", func() {
 			backup.SelectString(connection, "SELECT foo FROM bar")
 		})
 	})
+	Describe("GetAOTableStates", func() {
+		aoTable := utils.Relation{0, 1234, "public", "ao_table", "", ""}
+		partitionTable := utils.Relation{0, 2345, "public", "part_table", "", ""}
+		mixedTable := utils.Relation{0, 3456, "public", "mixed_table", "", ""}
+		heapTable := utils.Relation{0, 4567, "public", "heap_table", "", ""}
+		tables := []utils.Relation{aoTable, partitionTable, mixedTable, heapTable}
+
+		It("returns the combined state of each table that is entirely append-optimized", func() {
+			relationRows := sqlmock.NewRows([]string{"oid", "relstorage", "aosegtablefqn"}).
+				AddRow(1234, "a", "pg_aoseg.pg_aoseg_1234").
+				AddRow(2345, "a", "pg_aoseg.pg_aoseg_2345").
+				AddRow(2345, "c", "pg_aoseg.pg_aocsseg_2346").
+				AddRow(3456, "a", "pg_aoseg.pg_aoseg_3456").
+				AddRow(3456, "h", "").
+				AddRow(4567, "h", "")
+			mock.ExpectQuery("SELECT (.*) FROM pg_class c").WillReturnRows(relationRows)
+			ddlRows := sqlmock.NewRows([]string{"oid", "lastddltimestamp"}).
+				AddRow(1234, "2017-01-01 01:01:01-08").
+				AddRow(2345, "2017-01-02 01:01:01-08")
+			mock.ExpectQuery("SELECT (.*) FROM pg_stat_last_operation lo").WillReturnRows(ddlRows)
+			mock.ExpectQuery(`FROM \(SELECT modcount FROM pg_aoseg.pg_aoseg_1234\)`).WillReturnRows(sqlmock.NewRows([]string{"modcount"}).AddRow(3))
+			mock.ExpectQuery(`FROM \(SELECT modcount FROM pg_aoseg.pg_aoseg_2345 UNION ALL SELECT modcount FROM pg_aoseg.pg_aocsseg_2346\)`).WillReturnRows(sqlmock.NewRows([]string{"modcount"}).AddRow(7))
+
+			states := backup.GetAOTableStates(connection, tables)
+			Expect(states).To(Equal(map[string]utils.AOTableState{
+				"public.ao_table":   {ModCount: 3, LastDDLTimestamp: "2017-01-01 01:01:01-08"},
+				"public.part_table": {ModCount: 7, LastDDLTimestamp: "2017-01-02 01:01:01-08"},
+			}))
+			Expect(mock.ExpectationsWereMet()).To(Succeed())
+		})
+		It("does not query the database if there are no tables", func() {
+			Expect(backup.GetAOTableStates(connection, []utils.Relation{})).To(BeEmpty())
+			Expect(mock.ExpectationsWereMet()).To(Succeed())
+		})
+	})
 	Describe("SelectStringSlice", func() {
 		header := []string{"string"}
 		rowOne := []driver.Value{"one"}
@@ -71,4 +106,79 @@ var _ = Describe("backup/queries tests", func() {
 			Expect(results[1]).To(Equal("two"))
 		})
 	})
+	Describe("Filter clauses", func() {
+		nonUserSchemaClause := `nspname NOT LIKE 'pg_temp_%'
+AND nspname NOT LIKE 'pg_toast%'
+AND nspname NOT IN ('gp_toolkit', 'information_schema', 'pg_aoseg', 'pg_bitmapindex', 'pg_catalog')`
+		AfterEach(func() {
+			backup.SetFilters([]string{}, []string{}, []string{}, []string{})
+		})
+		Context("SchemaFilterClause", func() {
+			It("filters out only non-user schemas if no schemas are included or excluded", func() {
+				backup.SetFilters([]string{}, []string{}, []string{}, []string{})
+				Expect(backup.SchemaFilterClause()).To(Equal(nonUserSchemaClause))
+			})
+			It("filters for included schemas", func() {
+				backup.SetFilters([]string{"foo", `"Bar's"`}, []string{}, []string{}, []string{})
+				Expect(backup.SchemaFilterClause()).To(Equal(nonUserSchemaClause + "\nAND nspname IN (E'foo', E'Bar''s')"))
+			})
+			It("filters out excluded schemas", func() {
+				backup.SetFilters([]string{}, []string{"foo", `"back\\slash"`}, []string{}, []string{})
+				Expect(backup.SchemaFilterClause()).To(Equal(nonUserSchemaClause + `
+AND nspname NOT IN (E'foo', E'back\\slash')`))
+			})
+			It("ignores included and excluded tables", func() {
+				backup.SetFilters([]string{}, []string{}, []string{"public.foo"}, []string{"public.bar"})
+				Expect(backup.SchemaFilterClause()).To(Equal(nonUserSchemaClause))
+			})
+			It("panics if a schema name is invalid", func() {
+				defer testutils.ShouldPanicWithMessage(`"FOO" is not a valid identifier`)
+				backup.SetFilters([]string{"FOO"}, []string{}, []string{}, []string{})
+			})
+		})
+		Context("TableFilterClause", func() {
+			It("returns an empty clause if no tables are included or excluded", func() {
+				backup.SetFilters([]string{"foo"}, []string{"bar"}, []string{}, []string{})
+				Expect(backup.TableFilterClause()).To(Equal(""))
+			})
+			It("filters for included tables", func() {
+				backup.SetFilters([]string{}, []string{}, []string{"public.foo", `"my schema"."My Table"`}, []string{})
+				Expect(backup.TableFilterClause()).To(Equal("\nAND (n.nspname, c.relname) IN ((E'public', E'foo'), (E'my schema', E'My Table'))"))
+			})
+			It("filters out excluded tables", func() {
+				backup.SetFilters([]string{}, []string{}, []string{}, []string{"public.foo"})
+				Expect(backup.TableFilterClause()).To(Equal("\nAND (n.nspname, c.relname) NOT IN ((E'public', E'foo'))"))
+			})
+			It("filters for included tables and out excluded tables together", func() {
+				backup.SetFilters([]string{}, []string{}, []string{"public.foo"}, []string{"public.bar"})
+				Expect(backup.TableFilterClause()).To(Equal("\nAND (n.nspname, c.relname) IN ((E'public', E'foo'))\nAND (n.nspname, c.relname) NOT IN ((E'public', E'bar'))"))
+			})
+			It("panics if a table name is not fully qualified", func() {
+				defer testutils.ShouldPanicWithMessage(`"foo" is not a valid fully-qualified table expression`)
+				backup.SetFilters([]string{}, []string{}, []string{"foo"}, []string{})
+			})
+		})
+		Context("SequenceFilterClause", func() {
+			It("returns an empty clause if no tables are included or excluded", func() {
+				Expect(backup.SequenceFilterClause()).To(Equal(""))
+			})
+			It("filters for sequences owned by included tables", func() {
+				backup.SetFilters([]string{}, []string{}, []string{"public.foo"}, []string{})
+				Expect(backup.SequenceFilterClause()).To(Equal(`
+AND c.oid IN (SELECT d.objid
+	FROM pg_depend d
+	JOIN pg_class t ON t.oid = d.refobjid
+	JOIN pg_namespace tn ON tn.oid = t.relnamespace
+	WHERE d.classid = 'pg_class'::regclass
+	AND d.refclassid = 'pg_class'::regclass
+	AND d.deptype = 'a'
+	AND (tn.nspname, t.relname) IN ((E'public', E'foo')))`))
+			})
+			It("filters out sequences owned by excluded tables", func() {
+				backup.SetFilters([]string{}, []string{}, []string{}, []string{"public.foo"})
+				Expect(backup.SequenceFilterClause()).To(HavePrefix("\nAND c.oid NOT IN (SELECT d.objid"))
+				Expect(backup.SequenceFilterClause()).To(HaveSuffix("AND (tn.nspname, t.relname) IN ((E'public', E'foo')))"))
+			})
+		})
+	})
 })
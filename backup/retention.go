@@ -0,0 +1,258 @@
+package backup
+
+/*
+ * This file contains structs and functions related to deleting backups, either
+ * individually or when they expire under a retention policy.
+ */
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/greenplum-db/gpbackup/utils"
+
+	"github.com/pkg/errors"
+)
+
+/*
+ * A backup is kept if any part of the policy keeps it.  KeepLast keeps the most
+ * recent backups and KeepDays keeps the backups taken in the last KeepDays days.
+ * KeepDaily, KeepWeekly, and KeepMonthly keep the most recent backup from each
+ * of that many of the most recent days, weeks, and months in which backups were
+ * taken.  Each part of the policy applies to the backups of each database
+ * separately, and only complete backups count toward it.
+ */
+type RetentionPolicy struct {
+	KeepLast    int
+	KeepDays    int
+	KeepDaily   int
+	KeepWeekly  int
+	KeepMonthly int
+}
+
+func (policy RetentionPolicy) IsSet() bool {
+	return policy.KeepLast > 0 || policy.KeepDays > 0 || policy.KeepDaily > 0 || policy.KeepWeekly > 0 || policy.KeepMonthly > 0
+}
+
+/*
+ * A backup whose process was killed is left in progress, so a backup that has
+ * been in progress for more than this many days is assumed to have failed.
+ */
+const STALE_BACKUP_DAYS = 7
+
+func isStaleBackup(manifest *utils.Manifest, now time.Time) bool {
+	cutoff := now.AddDate(0, 0, -STALE_BACKUP_DAYS).Format("20060102150405")
+	return manifest.Status == utils.BACKUP_STATUS_IN_PROGRESS && manifest.StartTime < cutoff
+}
+
+func parseTimestamp(timestamp string) time.Time {
+	parsedTime, _ := time.ParseInLocation("20060102150405", timestamp, time.Local)
+	return parsedTime
+}
+
+/*
+ * Keeps the most recent backup in each of the first numPeriods periods that
+ * have backups, where backups are in the same period if getPeriod returns the
+ * same value for them.  The backups must be sorted from newest to oldest.
+ */
+func keepLatestPerPeriod(backupsToKeep map[string]bool, manifests []*utils.Manifest, numPeriods int, getPeriod func(time.Time) string) {
+	periodsKept := make(map[string]bool, 0)
+	for _, manifest := range manifests {
+		if len(periodsKept) >= numPeriods {
+			return
+		}
+		period := getPeriod(parseTimestamp(manifest.StartTime))
+		if !periodsKept[period] {
+			periodsKept[period] = true
+			backupsToKeep[manifest.StartTime] = true
+		}
+	}
+}
+
+/*
+ * Returns the timestamps of the backups to keep under the policy.  Backups that
+ * are still in progress are always kept unless they are stale, as are the base
+ * backups of any kept incremental backups, since those cannot be restored
+ * without them.
+ */
+func GetBackupsToKeep(manifests []*utils.Manifest, policy RetentionPolicy, now time.Time) map[string]bool {
+	backupsToKeep := make(map[string]bool, 0)
+	completeBackups := make(map[string][]*utils.Manifest, 0)
+	for _, manifest := range manifests {
+		if manifest.Status == utils.BACKUP_STATUS_IN_PROGRESS && !isStaleBackup(manifest, now) {
+			backupsToKeep[manifest.StartTime] = true
+		} else if manifest.Status == utils.BACKUP_STATUS_COMPLETE {
+			completeBackups[manifest.DatabaseName] = append(completeBackups[manifest.DatabaseName], manifest)
+		}
+	}
+
+	cutoff := now.AddDate(0, 0, -policy.KeepDays).Format("20060102150405")
+	for _, dbBackups := range completeBackups {
+		sort.Slice(dbBackups, func(i int, j int) bool { return dbBackups[i].StartTime > dbBackups[j].StartTime })
+		for i, manifest := range dbBackups {
+			if i < policy.KeepLast || (policy.KeepDays > 0 && manifest.StartTime >= cutoff) {
+				backupsToKeep[manifest.StartTime] = true
+			}
+		}
+		keepLatestPerPeriod(backupsToKeep, dbBackups, policy.KeepDaily, func(t time.Time) string { return t.Format("20060102") })
+		keepLatestPerPeriod(backupsToKeep, dbBackups, policy.KeepWeekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-%02d", year, week)
+		})
+		keepLatestPerPeriod(backupsToKeep, dbBackups, policy.KeepMonthly, func(t time.Time) string { return t.Format("200601") })
+	}
+
+	for _, manifest := range manifests {
+		if backupsToKeep[manifest.StartTime] && manifest.BaseTimestamp != "" {
+			backupsToKeep[manifest.BaseTimestamp] = true
+		}
+	}
+	return backupsToKeep
+}
+
+/*
+ * Returns the backups that have expired under the policy, from newest to
+ * oldest, so that incremental backups are deleted before their base backups.
+ */
+func GetExpiredBackups(manifests []*utils.Manifest, policy RetentionPolicy, now time.Time) []*utils.Manifest {
+	backupsToKeep := GetBackupsToKeep(manifests, policy, now)
+	expiredBackups := make([]*utils.Manifest, 0)
+	for _, manifest := range manifests {
+		if !backupsToKeep[manifest.StartTime] {
+			expiredBackups = append(expiredBackups, manifest)
+		}
+	}
+	sort.Slice(expiredBackups, func(i int, j int) bool { return expiredBackups[i].StartTime > expiredBackups[j].StartTime })
+	return expiredBackups
+}
+
+// Returns the timestamps of the incremental backups based on the given backup
+func GetDependentBackups(manifests []*utils.Manifest, timestamp string) []string {
+	dependentBackups := make([]string, 0)
+	for _, manifest := range manifests {
+		if manifest.BaseTimestamp == timestamp {
+			dependentBackups = append(dependentBackups, manifest.StartTime)
+		}
+	}
+	sort.Strings(dependentBackups)
+	return dependentBackups
+}
+
+/*
+ * The backup directories on the segments are removed on their hosts over SSH,
+ * instead of from within a database transaction, which a failed backup may
+ * have aborted.  The directory for the date of the backup is also removed if
+ * no other backups are left in it.  A segment directory that is the master
+ * directory, as when a backup to a custom base directory is taken on a single
+ * host, is left alone, so that the master directory is only changed on the
+ * master and the manifest of a failed backup is kept.
+ */
+func DeleteSegmentBackupDirectories(timestamp string) {
+	masterDir := utils.GetMasterDirForTimestamp(timestamp)
+	masterHost := utils.GetHostForContent(-1)
+	commandMap := make(map[int]string, 0)
+	for _, contentID := range utils.GetContentList() {
+		segDir := utils.GetDirForContentAndTimestamp(contentID, timestamp)
+		if contentID < 0 || (segDir == masterDir && utils.GetHostForContent(contentID) == masterHost) {
+			continue
+		}
+		commandMap[contentID] = fmt.Sprintf("rm -rf %s && (rmdir %s 2>/dev/null; true)", utils.ShellQuote(segDir), utils.ShellQuote(path.Dir(segDir)))
+	}
+	output := utils.ExecuteClusterCommand(commandMap)
+	utils.CheckClusterError(output, "Unable to remove backup directories", func(contentID int) string {
+		return fmt.Sprintf("Cannot remove directory %s on host %s", utils.GetDirForContentAndTimestamp(contentID, timestamp), utils.GetHostForContent(contentID))
+	})
+}
+
+func DeleteBackupDirectories(timestamp string) {
+	DeleteSegmentBackupDirectories(timestamp)
+	masterDir := utils.GetMasterDirForTimestamp(timestamp)
+	err := utils.System.RemoveAll(masterDir)
+	if err != nil {
+		logger.Fatal(err, "Unable to remove backup directory %s", masterDir)
+	}
+	_ = utils.System.Remove(path.Dir(masterDir))
+}
+
+/*
+ * Removes every file of the current backup from its directory on the master
+ * except the manifest, which records that the backup failed so that the
+ * directory is never mistaken for a usable backup.
+ */
+func DeleteFailedBackupFiles() {
+	filenames, err := utils.System.Glob(fmt.Sprintf("%s/*", utils.GetDirForContent(-1)))
+	utils.CheckError(err)
+	manifestName := path.Base(utils.GetManifestFilePath())
+	for _, filename := range filenames {
+		if path.Base(filename) == manifestName {
+			continue
+		}
+		err = utils.System.Remove(filename)
+		if err != nil {
+			logger.Fatal(err, "Unable to remove file %s", filename)
+		}
+	}
+}
+
+/*
+ * The backup is marked deleted in the history file, so that the history does
+ * not list it as a backup that can still be restored.
+ */
+func deleteBackup(manifest *utils.Manifest) {
+	logger.Info("Deleting backup %s of database %s", manifest.StartTime, manifest.DatabaseName)
+	if isStaleBackup(manifest, utils.System.Now()) {
+		logger.Warn("Backup %s has been in progress for more than %d days and is assumed to have failed", manifest.StartTime, STALE_BACKUP_DAYS)
+	}
+	if manifest.Plugin != "" {
+		logger.Warn("Backup %s was sent to plugin %s, and its files in the plugin's storage are not deleted", manifest.StartTime, manifest.Plugin)
+	}
+	DeleteBackupDirectories(manifest.StartTime)
+	historyEntry := utils.NewHistoryEntry(manifest)
+	historyEntry.Status = utils.HISTORY_STATUS_DELETED
+	utils.AppendHistoryEntry(utils.GetHistoryFilePath(), historyEntry)
+}
+
+/*
+ * A backup cannot be deleted while it is in progress, unless it is stale, or
+ * while an incremental backup based on it exists, since that backup could not
+ * be restored without it.
+ */
+func DeleteBackup(timestamp string) {
+	manifests := utils.GetBackupManifests()
+	var backupManifest *utils.Manifest
+	for _, manifest := range manifests {
+		if manifest.StartTime == timestamp {
+			backupManifest = manifest
+		}
+	}
+	if backupManifest == nil {
+		logger.Fatal(errors.Errorf("Backup %s was not found", timestamp), "")
+	}
+	if backupManifest.Status == utils.BACKUP_STATUS_IN_PROGRESS && !isStaleBackup(backupManifest, utils.System.Now()) {
+		logger.Fatal(errors.Errorf("Backup %s is in progress and cannot be deleted", timestamp), "")
+	}
+	if dependentBackups := GetDependentBackups(manifests, timestamp); len(dependentBackups) > 0 {
+		logger.Fatal(errors.Errorf("Backup %s cannot be deleted because incremental backups %v are based on it", timestamp, dependentBackups), "")
+	}
+	deleteBackup(backupManifest)
+}
+
+/*
+ * If dbname is not empty, only the backups of that database are considered,
+ * and backups of other databases are left alone.
+ */
+func ApplyRetentionPolicy(policy RetentionPolicy, dbname string) {
+	manifests := make([]*utils.Manifest, 0)
+	for _, manifest := range utils.GetBackupManifests() {
+		if dbname == "" || manifest.DatabaseName == dbname {
+			manifests = append(manifests, manifest)
+		}
+	}
+	expiredBackups := GetExpiredBackups(manifests, policy, utils.System.Now())
+	logger.Info("%d of %d backups have expired under the retention policy", len(expiredBackups), len(manifests))
+	for _, manifest := range expiredBackups {
+		deleteBackup(manifest)
+	}
+}
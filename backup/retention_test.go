@@ -0,0 +1,198 @@
+package backup_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/greenplum-db/gpbackup/backup"
+	"github.com/greenplum-db/gpbackup/testutils"
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+/*
+ * Records the script run on each host instead of running it, and returns the
+ * output of a script in which every command succeeded without printing anything.
+ */
+type recordingExecutor struct {
+	mutex   sync.Mutex
+	scripts map[string]string
+}
+
+func (executor *recordingExecutor) ExecuteScript(host string, script string) (string, error) {
+	executor.mutex.Lock()
+	defer executor.mutex.Unlock()
+	executor.scripts[host] = script
+	output := ""
+	for _, match := range regexp.MustCompile(`GPBACKUP_SEGMENT_DONE (\d+)`).FindAllStringSubmatch(script, -1) {
+		output += fmt.Sprintf("\nGPBACKUP_SEGMENT_DONE %s 0\n", match[1])
+	}
+	return output, nil
+}
+
+var _ = Describe("backup/retention tests", func() {
+	now := time.Date(2017, time.March, 15, 12, 0, 0, 0, time.Local)
+	newBackup := func(timestamp string) *utils.Manifest {
+		return &utils.Manifest{DatabaseName: "testdb", StartTime: timestamp, Status: utils.BACKUP_STATUS_COMPLETE}
+	}
+	getTimestamps := func(manifests []*utils.Manifest) []string {
+		timestamps := make([]string, 0)
+		for _, manifest := range manifests {
+			timestamps = append(timestamps, manifest.StartTime)
+		}
+		return timestamps
+	}
+	BeforeEach(func() {
+		testutils.SetupTestLogger()
+	})
+
+	Describe("GetExpiredBackups", func() {
+		It("keeps the most recent backups", func() {
+			manifests := []*utils.Manifest{newBackup("20170313010101"), newBackup("20170315010101"), newBackup("20170314010101")}
+			expired := backup.GetExpiredBackups(manifests, backup.RetentionPolicy{KeepLast: 2}, now)
+			Expect(getTimestamps(expired)).To(Equal([]string{"20170313010101"}))
+		})
+		It("keeps the backups taken in the given number of days", func() {
+			manifests := []*utils.Manifest{newBackup("20170310010101"), newBackup("20170313130000"), newBackup("20170315010101")}
+			expired := backup.GetExpiredBackups(manifests, backup.RetentionPolicy{KeepDays: 2}, now)
+			Expect(getTimestamps(expired)).To(Equal([]string{"20170310010101"}))
+		})
+		It("keeps the most recent backup from each of the given number of days", func() {
+			manifests := []*utils.Manifest{newBackup("20170315010101"), newBackup("20170315020202"), newBackup("20170314010101"), newBackup("20170312010101")}
+			expired := backup.GetExpiredBackups(manifests, backup.RetentionPolicy{KeepDaily: 2}, now)
+			Expect(getTimestamps(expired)).To(Equal([]string{"20170315010101", "20170312010101"}))
+		})
+		It("keeps the most recent backup from each of the given number of weeks and months", func() {
+			manifests := []*utils.Manifest{
+				newBackup("20170315010101"), // Week 11 of March
+				newBackup("20170313010101"), // Week 11 of March
+				newBackup("20170308010101"), // Week 10 of March
+				newBackup("20170220010101"), // Week 8 of February
+				newBackup("20170115010101"), // Week 2 of January
+			}
+			expired := backup.GetExpiredBackups(manifests, backup.RetentionPolicy{KeepWeekly: 2, KeepMonthly: 2}, now)
+			Expect(getTimestamps(expired)).To(Equal([]string{"20170313010101", "20170115010101"}))
+		})
+		It("applies the policy to each database separately", func() {
+			otherBackup := newBackup("20170301010101")
+			otherBackup.DatabaseName = "otherdb"
+			manifests := []*utils.Manifest{newBackup("20170315010101"), newBackup("20170314010101"), otherBackup}
+			expired := backup.GetExpiredBackups(manifests, backup.RetentionPolicy{KeepLast: 1}, now)
+			Expect(getTimestamps(expired)).To(Equal([]string{"20170314010101"}))
+		})
+		It("expires backups that did not complete but never backups in progress", func() {
+			failedBackup := newBackup("20170315020202")
+			failedBackup.Status = utils.BACKUP_STATUS_FAILED
+			runningBackup := newBackup("20170315030303")
+			runningBackup.Status = utils.BACKUP_STATUS_IN_PROGRESS
+			manifests := []*utils.Manifest{newBackup("20170315010101"), failedBackup, runningBackup}
+			expired := backup.GetExpiredBackups(manifests, backup.RetentionPolicy{KeepLast: 1}, now)
+			Expect(getTimestamps(expired)).To(Equal([]string{"20170315020202"}))
+		})
+		It("expires backups that have been in progress for too long to still be running", func() {
+			runningBackup := newBackup("20170310010101")
+			runningBackup.Status = utils.BACKUP_STATUS_IN_PROGRESS
+			staleBackup := newBackup("20170301010101")
+			staleBackup.Status = utils.BACKUP_STATUS_IN_PROGRESS
+			manifests := []*utils.Manifest{newBackup("20170315010101"), runningBackup, staleBackup}
+			expired := backup.GetExpiredBackups(manifests, backup.RetentionPolicy{KeepLast: 1}, now)
+			Expect(getTimestamps(expired)).To(Equal([]string{"20170301010101"}))
+		})
+		It("keeps the base backup of a kept incremental backup", func() {
+			incrementalBackup := newBackup("20170315010101")
+			incrementalBackup.Incremental = true
+			incrementalBackup.BaseTimestamp = "20170310010101"
+			manifests := []*utils.Manifest{incrementalBackup, newBackup("20170312010101"), newBackup("20170310010101")}
+			expired := backup.GetExpiredBackups(manifests, backup.RetentionPolicy{KeepLast: 1}, now)
+			Expect(getTimestamps(expired)).To(Equal([]string{"20170312010101"}))
+		})
+		It("returns expired backups from newest to oldest", func() {
+			manifests := []*utils.Manifest{newBackup("20170301010101"), newBackup("20170315010101"), newBackup("20170302010101"), newBackup("20170303010101")}
+			expired := backup.GetExpiredBackups(manifests, backup.RetentionPolicy{KeepLast: 1}, now)
+			Expect(getTimestamps(expired)).To(Equal([]string{"20170303010101", "20170302010101", "20170301010101"}))
+		})
+	})
+	Describe("GetDependentBackups", func() {
+		It("returns the incremental backups based on a backup", func() {
+			incrementalOne := &utils.Manifest{StartTime: "20170312010101", BaseTimestamp: "20170310010101"}
+			incrementalTwo := &utils.Manifest{StartTime: "20170311010101", BaseTimestamp: "20170310010101"}
+			manifests := []*utils.Manifest{newBackup("20170310010101"), incrementalOne, incrementalTwo}
+			Expect(backup.GetDependentBackups(manifests, "20170310010101")).To(Equal([]string{"20170311010101", "20170312010101"}))
+			Expect(backup.GetDependentBackups(manifests, "20170312010101")).To(BeEmpty())
+		})
+	})
+	Describe("DeleteFailedBackupFiles", func() {
+		AfterEach(func() {
+			utils.System.Glob = filepath.Glob
+			utils.System.Remove = os.Remove
+		})
+		It("removes every file in the master backup directory except the manifest", func() {
+			testutils.SetDefaultSegmentConfiguration()
+			masterDir := "/data/gpseg-1/backups/20170101/20170101010101"
+			utils.System.Glob = func(pattern string) ([]string, error) {
+				Expect(pattern).To(Equal(masterDir + "/*"))
+				return []string{masterDir + "/global.sql", masterDir + "/gpbackup_20170101010101_manifest.json", masterDir + "/predata.sql"}, nil
+			}
+			removedFiles := make([]string, 0)
+			utils.System.Remove = func(name string) error { removedFiles = append(removedFiles, name); return nil }
+			backup.DeleteFailedBackupFiles()
+			Expect(removedFiles).To(Equal([]string{masterDir + "/global.sql", masterDir + "/predata.sql"}))
+		})
+	})
+	Describe("DeleteSegmentBackupDirectories and DeleteBackupDirectories", func() {
+		var executor *recordingExecutor
+		BeforeEach(func() {
+			executor = &recordingExecutor{scripts: make(map[string]string, 0)}
+			utils.ClusterExecutor = executor
+			utils.DumpTimestamp = "20170101010101"
+			configMaster := utils.QuerySegConfig{-1, "mdw", "/data/gpseg-1"}
+			configSegOne := utils.QuerySegConfig{0, "sdw1", "/data/gpseg0"}
+			configSegTwo := utils.QuerySegConfig{1, "sdw2", "/data/gpseg1"}
+			utils.SetupSegmentConfiguration([]utils.QuerySegConfig{configMaster, configSegOne, configSegTwo})
+		})
+		AfterEach(func() {
+			utils.ClusterExecutor = &utils.SSHExecutor{}
+			utils.System.RemoveAll = os.RemoveAll
+			utils.System.Remove = os.Remove
+			testutils.SetDefaultSegmentConfiguration()
+		})
+		It("removes the backup directory of each segment on its host", func() {
+			backup.DeleteSegmentBackupDirectories("20161231010101")
+			Expect(executor.scripts).To(HaveLen(2))
+			Expect(executor.scripts["sdw1"]).To(ContainSubstring("rm -rf '/data/gpseg0/backups/20161231/20161231010101' && (rmdir '/data/gpseg0/backups/20161231' 2>/dev/null; true)"))
+			Expect(executor.scripts["sdw2"]).To(ContainSubstring("rm -rf '/data/gpseg1/backups/20161231/20161231010101' && (rmdir '/data/gpseg1/backups/20161231' 2>/dev/null; true)"))
+		})
+		It("quotes backup directories containing spaces or shell metacharacters", func() {
+			utils.BaseDumpDir = "/tmp/my backups; echo"
+			configMaster := utils.QuerySegConfig{-1, "mdw", "/data/gpseg-1"}
+			configSegOne := utils.QuerySegConfig{0, "sdw1", "/data/gpseg0"}
+			utils.SetupSegmentConfiguration([]utils.QuerySegConfig{configMaster, configSegOne})
+			backup.DeleteSegmentBackupDirectories("20170101010101")
+			Expect(executor.scripts["sdw1"]).To(ContainSubstring("rm -rf '/tmp/my backups; echo/backups/20170101/20170101010101' && (rmdir '/tmp/my backups; echo/backups/20170101' 2>/dev/null; true)"))
+		})
+		It("leaves alone a segment directory that is the master directory", func() {
+			utils.BaseDumpDir = "/tmp/backups"
+			configMaster := utils.QuerySegConfig{-1, "localhost", "/data/gpseg-1"}
+			configSegOne := utils.QuerySegConfig{0, "localhost", "/data/gpseg0"}
+			configSegTwo := utils.QuerySegConfig{1, "sdw2", "/data/gpseg1"}
+			utils.SetupSegmentConfiguration([]utils.QuerySegConfig{configMaster, configSegOne, configSegTwo})
+			backup.DeleteSegmentBackupDirectories("20170101010101")
+			Expect(executor.scripts).To(HaveLen(1))
+			Expect(executor.scripts["sdw2"]).To(ContainSubstring("rm -rf '/tmp/backups/backups/20170101/20170101010101' "))
+		})
+		It("removes the backup directories on the segments and on the master", func() {
+			removedDirs := make([]string, 0)
+			utils.System.RemoveAll = func(path string) error { removedDirs = append(removedDirs, path); return nil }
+			utils.System.Remove = func(name string) error { removedDirs = append(removedDirs, name); return nil }
+			backup.DeleteBackupDirectories("20161231010101")
+			Expect(executor.scripts).To(HaveLen(2))
+			Expect(removedDirs).To(Equal([]string{"/data/gpseg-1/backups/20161231/20161231010101", "/data/gpseg-1/backups/20161231"}))
+		})
+	})
+})
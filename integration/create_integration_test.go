@@ -17,16 +17,20 @@ import (
 
 var _ = Describe("backup integration create statement tests", func() {
 	var buffer *bytes.Buffer
+	var toc *utils.TOC
+	var backupfile *utils.FileWithByteCount
 
 	BeforeEach(func() {
 		buffer = bytes.NewBuffer([]byte(""))
+		toc = &utils.TOC{}
+		backupfile = utils.NewFileWithByteCount(buffer)
 		testutils.SetupTestLogger()
 	})
 	Describe("PrintCreateSchemaStatements", func() {
 		It("creates a non public schema", func() {
 			schemas := []utils.Schema{{0, "test_schema", "test comment", "testrole"}}
 
-			backup.PrintCreateSchemaStatements(buffer, schemas)
+			backup.PrintCreateSchemaStatements(backupfile, toc, schemas)
 
 			testutils.AssertQueryRuns(connection, buffer.String())
 			defer testutils.AssertQueryRuns(connection, "DROP SCHEMA test_schema")
@@ -43,7 +47,7 @@ var _ = Describe("backup integration create statement tests", func() {
 		It("modifies the public schema", func() {
 			schemas := []utils.Schema{{2200, "public", "test comment", "testrole"}}
 
-			backup.PrintCreateSchemaStatements(buffer, schemas)
+			backup.PrintCreateSchemaStatements(backupfile, toc, schemas)
 
 			testutils.AssertQueryRuns(connection, buffer.String())
 			defer testutils.AssertQueryRuns(connection, "ALTER SCHEMA public OWNER TO gpadmin")
@@ -87,7 +91,7 @@ var _ = Describe("backup integration create statement tests", func() {
 		})
 
 		It("creates shell types for base and shell types only", func() {
-			backup.PrintShellTypeStatements(buffer, types)
+			backup.PrintShellTypeStatements(backupfile, toc, types)
 
 			testutils.AssertQueryRuns(connection, buffer.String())
 			defer testutils.AssertQueryRuns(connection, "DROP TYPE shell_type")
@@ -101,7 +105,7 @@ var _ = Describe("backup integration create statement tests", func() {
 		})
 
 		It("creates composite and enum types", func() {
-			backup.PrintCreateCompositeAndEnumTypeStatements(buffer, types)
+			backup.PrintCreateCompositeAndEnumTypeStatements(backupfile, toc, types)
 
 			testutils.AssertQueryRuns(connection, buffer.String())
 			defer testutils.AssertQueryRuns(connection, "DROP TYPE composite_type")
@@ -116,7 +120,7 @@ var _ = Describe("backup integration create statement tests", func() {
 		})
 
 		It("creates base types", func() {
-			backup.PrintCreateBaseTypeStatements(buffer, types)
+			backup.PrintCreateBaseTypeStatements(backupfile, toc, types)
 
 			//Run queries to set up the database state so we can successfully create base types
 			testutils.AssertQueryRuns(connection, "CREATE TYPE base_type")
@@ -137,7 +141,7 @@ var _ = Describe("backup integration create statement tests", func() {
 		It("creates a view with a comment", func() {
 			viewDef := backup.QueryViewDefinition{"public", "simpleview", "SELECT pg_roles.rolname FROM pg_roles;", "this is a view comment"}
 
-			backup.PrintCreateViewStatements(buffer, []backup.QueryViewDefinition{viewDef})
+			backup.PrintCreateViewStatements(backupfile, toc, []backup.QueryViewDefinition{viewDef})
 
 			testutils.AssertQueryRuns(connection, buffer.String())
 			defer testutils.AssertQueryRuns(connection, "DROP VIEW simpleview")
@@ -164,7 +168,7 @@ var _ = Describe("backup integration create statement tests", func() {
 			plpythonuInfo := backup.QueryProceduralLanguage{"plpythonu", "testrole", true, false, 4, 5, 0, "", "this is a language comment"}
 			procLangs := []backup.QueryProceduralLanguage{plpgsqlInfo, plpythonuInfo}
 
-			backup.PrintCreateLanguageStatements(buffer, procLangs, funcInfoMap)
+			backup.PrintCreateLanguageStatements(backupfile, toc, procLangs, funcInfoMap)
 
 			testutils.AssertQueryRuns(connection, buffer.String())
 			defer testutils.AssertQueryRuns(connection, "DROP LANGUAGE plpythonu")
@@ -185,7 +189,7 @@ var _ = Describe("backup integration create statement tests", func() {
 				Language: "sql", Comment: "", Owner: "testrole",
 			}
 
-			backup.PrintCreateFunctionStatements(buffer, []backup.QueryFunctionDefinition{addFunction})
+			backup.PrintCreateFunctionStatements(backupfile, toc, []backup.QueryFunctionDefinition{addFunction})
 
 			testutils.AssertQueryRuns(connection, buffer.String())
 			defer testutils.AssertQueryRuns(connection, "DROP FUNCTION add(integer, integer)")
@@ -203,7 +207,7 @@ var _ = Describe("backup integration create statement tests", func() {
 				NumRows: 200, DataAccess: "m", Language: "sql", Comment: "this is a function comment", Owner: "testrole",
 			}
 
-			backup.PrintCreateFunctionStatements(buffer, []backup.QueryFunctionDefinition{appendFunction})
+			backup.PrintCreateFunctionStatements(backupfile, toc, []backup.QueryFunctionDefinition{appendFunction})
 
 			testutils.AssertQueryRuns(connection, buffer.String())
 			defer testutils.AssertQueryRuns(connection, "DROP FUNCTION append(integer, integer)")
@@ -221,7 +225,7 @@ var _ = Describe("backup integration create statement tests", func() {
 				Language: "sql", Comment: "", Owner: "testrole",
 			}
 
-			backup.PrintCreateFunctionStatements(buffer, []backup.QueryFunctionDefinition{dupFunction})
+			backup.PrintCreateFunctionStatements(backupfile, toc, []backup.QueryFunctionDefinition{dupFunction})
 
 			testutils.AssertQueryRuns(connection, buffer.String())
 			defer testutils.AssertQueryRuns(connection, "DROP FUNCTION dup(integer)")
@@ -245,7 +249,7 @@ var _ = Describe("backup integration create statement tests", func() {
 				2: {QualifiedName: "public.mypre_accum", Arguments: "numeric, numeric"},
 			}
 
-			backup.PrintCreateAggregateStatements(buffer, []backup.QueryAggregateDefinition{aggregateDef}, funcInfoMap)
+			backup.PrintCreateAggregateStatements(backupfile, toc, []backup.QueryAggregateDefinition{aggregateDef}, funcInfoMap)
 
 			//Run queries to set up the database state so we can successfully create an aggregate
 			testutils.AssertQueryRuns(connection, `
@@ -282,8 +286,8 @@ var _ = Describe("backup integration create statement tests", func() {
 			pkConstraint     backup.QueryConstraint
 			fkConstraint     backup.QueryConstraint
 			checkConstraint  backup.QueryConstraint
-			constraints      []string
-			fkConstraints    []string
+			constraints      []backup.StatementWithType
+			fkConstraints    []backup.StatementWithType
 		)
 		BeforeEach(func() {
 			testTable = utils.BasicRelation("public", "testtable")
@@ -299,7 +303,7 @@ var _ = Describe("backup integration create statement tests", func() {
 		})
 		It("creates a unique constraint", func() {
 			constraints, fkConstraints = backup.ProcessConstraints(testTable, []backup.QueryConstraint{uniqueConstraint})
-			backup.PrintConstraintStatements(buffer, constraints, fkConstraints)
+			backup.PrintConstraintStatements(backupfile, toc, constraints, fkConstraints)
 
 			testutils.AssertQueryRuns(connection, buffer.String())
 
@@ -310,7 +314,7 @@ var _ = Describe("backup integration create statement tests", func() {
 		})
 		It("creates a primary key constraint", func() {
 			constraints, fkConstraints = backup.ProcessConstraints(testTable, []backup.QueryConstraint{pkConstraint})
-			backup.PrintConstraintStatements(buffer, constraints, fkConstraints)
+			backup.PrintConstraintStatements(backupfile, toc, constraints, fkConstraints)
 
 			testutils.AssertQueryRuns(connection, buffer.String())
 
@@ -321,7 +325,7 @@ var _ = Describe("backup integration create statement tests", func() {
 		})
 		It("creates a fk constraint", func() {
 			constraints, fkConstraints = backup.ProcessConstraints(testTable, []backup.QueryConstraint{fkConstraint})
-			backup.PrintConstraintStatements(buffer, constraints, fkConstraints)
+			backup.PrintConstraintStatements(backupfile, toc, constraints, fkConstraints)
 
 			testutils.AssertQueryRuns(connection, "CREATE TABLE constraints_other_table(b text PRIMARY KEY)")
 			defer testutils.AssertQueryRuns(connection, "DROP TABLE constraints_other_table CASCADE")
@@ -334,7 +338,7 @@ var _ = Describe("backup integration create statement tests", func() {
 		})
 		It("creates a check constraint", func() {
 			constraints, fkConstraints = backup.ProcessConstraints(testTable, []backup.QueryConstraint{checkConstraint})
-			backup.PrintConstraintStatements(buffer, constraints, fkConstraints)
+			backup.PrintConstraintStatements(backupfile, toc, constraints, fkConstraints)
 
 			testutils.AssertQueryRuns(connection, buffer.String())
 
@@ -345,7 +349,7 @@ var _ = Describe("backup integration create statement tests", func() {
 		})
 		It("creates multiple constraints on one table", func() {
 			constraints, fkConstraints = backup.ProcessConstraints(testTable, []backup.QueryConstraint{checkConstraint, pkConstraint, uniqueConstraint, fkConstraint})
-			backup.PrintConstraintStatements(buffer, constraints, fkConstraints)
+			backup.PrintConstraintStatements(backupfile, toc, constraints, fkConstraints)
 
 			testutils.AssertQueryRuns(connection, "CREATE TABLE constraints_other_table(b text PRIMARY KEY)")
 			defer testutils.AssertQueryRuns(connection, "DROP TABLE constraints_other_table CASCADE")
@@ -362,18 +366,18 @@ var _ = Describe("backup integration create statement tests", func() {
 	})
 	Describe("PrintCreateSequenceStatements", func() {
 		var (
-			ownerMap    map[string]string
+			ownerMap    map[string]backup.QuerySequenceOwner
 			sequence    utils.Relation
 			sequenceDef backup.Sequence
 		)
 		BeforeEach(func() {
 			sequence = utils.Relation{SchemaName: "public", RelationName: "my_sequence", Owner: "testrole"}
 			sequenceDef = backup.Sequence{Relation: sequence}
-			ownerMap = map[string]string{}
+			ownerMap = map[string]backup.QuerySequenceOwner{}
 		})
 		It("creates a basic sequence", func() {
 			sequenceDef.QuerySequenceDefinition = backup.QuerySequenceDefinition{Name: "my_sequence", LastVal: 1, Increment: 1, MaxVal: 9223372036854775807, MinVal: 1, CacheVal: 1}
-			backup.PrintCreateSequenceStatements(buffer, []backup.Sequence{sequenceDef}, ownerMap)
+			backup.PrintCreateSequenceStatements(backupfile, toc, []backup.Sequence{sequenceDef}, ownerMap)
 
 			testutils.AssertQueryRuns(connection, buffer.String())
 			defer testutils.AssertQueryRuns(connection, "DROP SEQUENCE my_sequence")
@@ -386,7 +390,7 @@ var _ = Describe("backup integration create statement tests", func() {
 		})
 		It("creates a complex sequence", func() {
 			sequenceDef.QuerySequenceDefinition = backup.QuerySequenceDefinition{Name: "my_sequence", LastVal: 105, Increment: 5, MaxVal: 1000, MinVal: 20, CacheVal: 1, LogCnt: 0, IsCycled: false, IsCalled: true}
-			backup.PrintCreateSequenceStatements(buffer, []backup.Sequence{sequenceDef}, ownerMap)
+			backup.PrintCreateSequenceStatements(backupfile, toc, []backup.Sequence{sequenceDef}, ownerMap)
 
 			testutils.AssertQueryRuns(connection, buffer.String())
 			defer testutils.AssertQueryRuns(connection, "DROP SEQUENCE my_sequence")
@@ -400,8 +404,8 @@ var _ = Describe("backup integration create statement tests", func() {
 		It("creates a sequence owned by a table column", func() {
 			sequenceDef.QuerySequenceDefinition = backup.QuerySequenceDefinition{Name: "my_sequence",
 				LastVal: 1, Increment: 1, MaxVal: 9223372036854775807, MinVal: 1, CacheVal: 1}
-			ownerMap["public.my_sequence"] = "sequence_table.a"
-			backup.PrintCreateSequenceStatements(buffer, []backup.Sequence{sequenceDef}, ownerMap)
+			ownerMap["public.my_sequence"] = backup.QuerySequenceOwner{TableName: "sequence_table", ColumnName: "a"}
+			backup.PrintCreateSequenceStatements(backupfile, toc, []backup.Sequence{sequenceDef}, ownerMap)
 
 			//Create table that sequence can be owned by
 			testutils.AssertQueryRuns(connection, "CREATE TABLE sequence_table(a int)")
@@ -433,7 +437,7 @@ var _ = Describe("backup integration create statement tests", func() {
 			btree := "\n\nCREATE INDEX simple_table_idx1 ON index_table USING btree (a);"
 			bitmap := "\n\nCREATE INDEX simple_table_idx2 ON index_table USING bitmap (b);\nCOMMENT ON INDEX simple_table_idx2 IS 'this is a index comment';"
 
-			backup.PrintPostdataCreateStatements(buffer, []string{btree, bitmap})
+			backup.PrintPostdataCreateStatements(backupfile, toc, []backup.StatementWithType{{Statement: btree}, {Statement: bitmap}})
 
 			//Create table whose columns we can index
 			testutils.AssertQueryRuns(connection, "CREATE TABLE index_table(a int, b text)")
@@ -443,14 +447,14 @@ var _ = Describe("backup integration create statement tests", func() {
 			testutils.AssertQueryRuns(connection, buffer.String())
 			resultIndexes := backup.GetIndexesForAllTables(connection, []utils.Relation{testTable})
 			Expect(len(resultIndexes)).To(Equal(2))
-			Expect(resultIndexes[0]).To(Equal(btree))
-			Expect(resultIndexes[1]).To(Equal(bitmap))
+			Expect(resultIndexes[0].Statement).To(Equal(btree))
+			Expect(resultIndexes[1].Statement).To(Equal(bitmap))
 		})
 		It("creates all rules for all tables", func() {
 			insert := "\n\nCREATE RULE double_insert AS ON INSERT TO rule_table1 DO INSERT INTO rule_table2 DEFAULT VALUES;"
 			update := "\n\nCREATE RULE update_notify AS ON UPDATE TO rule_table1 DO NOTIFY rule_table1;\nCOMMENT ON RULE update_notify ON public.rule_table1 IS 'This is a rule comment.';"
 
-			backup.PrintPostdataCreateStatements(buffer, []string{insert, update})
+			backup.PrintPostdataCreateStatements(backupfile, toc, []backup.StatementWithType{{Statement: insert}, {Statement: update}})
 
 			testutils.AssertQueryRuns(connection, "CREATE TABLE rule_table1(i int)")
 			defer testutils.AssertQueryRuns(connection, "DROP TABLE rule_table1")
@@ -462,14 +466,14 @@ var _ = Describe("backup integration create statement tests", func() {
 			testutils.AssertQueryRuns(connection, buffer.String())
 			resultRules := backup.GetRuleDefinitions(connection)
 			Expect(len(resultRules)).To(Equal(2))
-			Expect(resultRules[0]).To(Equal(insert))
-			Expect(resultRules[1]).To(Equal(update))
+			Expect(resultRules[0].Statement).To(Equal(insert))
+			Expect(resultRules[1].Statement).To(Equal(update))
 		})
 		It("creates all triggers for all tables", func() {
 			sync1 := "\n\nCREATE TRIGGER sync_trigger_table1 AFTER INSERT OR DELETE OR UPDATE ON trigger_table1 FOR EACH STATEMENT EXECUTE PROCEDURE flatfile_update_trigger();"
 			sync2 := "\n\nCREATE TRIGGER sync_trigger_table2 AFTER INSERT OR DELETE OR UPDATE ON trigger_table2 FOR EACH STATEMENT EXECUTE PROCEDURE flatfile_update_trigger();\nCOMMENT ON TRIGGER sync_trigger_table2 ON public.trigger_table2 IS 'This is a trigger comment.';"
 
-			backup.PrintPostdataCreateStatements(buffer, []string{sync1, sync2})
+			backup.PrintPostdataCreateStatements(backupfile, toc, []backup.StatementWithType{{Statement: sync1}, {Statement: sync2}})
 
 			testutils.AssertQueryRuns(connection, "CREATE TABLE trigger_table1(i int)")
 			defer testutils.AssertQueryRuns(connection, "DROP TABLE trigger_table1")
@@ -481,8 +485,8 @@ var _ = Describe("backup integration create statement tests", func() {
 			testutils.AssertQueryRuns(connection, buffer.String())
 			resultTriggers := backup.GetTriggerDefinitions(connection)
 			Expect(len(resultTriggers)).To(Equal(2))
-			Expect(resultTriggers[0]).To(Equal(sync1))
-			Expect(resultTriggers[1]).To(Equal(sync2))
+			Expect(resultTriggers[0].Statement).To(Equal(sync1))
+			Expect(resultTriggers[1].Statement).To(Equal(sync2))
 		})
 	})
 	Describe("PrintCreateCastStatements", func() {
@@ -493,7 +497,7 @@ var _ = Describe("backup integration create statement tests", func() {
 			testutils.AssertQueryRuns(connection, "CREATE FUNCTION casttoint(text) RETURNS integer STRICT IMMUTABLE LANGUAGE SQL AS 'SELECT cast($1 as integer);'")
 			defer testutils.AssertQueryRuns(connection, "DROP FUNCTION casttoint(text)")
 
-			backup.PrintCreateCastStatements(buffer, []backup.QueryCastDefinition{castDef})
+			backup.PrintCreateCastStatements(backupfile, toc, []backup.QueryCastDefinition{castDef})
 			defer testutils.AssertQueryRuns(connection, "DROP CAST (text AS integer)")
 
 			testutils.AssertQueryRuns(connection, buffer.String())
@@ -742,7 +746,7 @@ SET SUBPARTITION TEMPLATE  ` + `
 		It("creates a trusted protocol with a read function", func() {
 			externalProtocols := []backup.QueryExtProtocol{protocolReadOnly}
 
-			backup.PrintCreateExternalProtocolStatements(buffer, externalProtocols, funcInfoMap)
+			backup.PrintCreateExternalProtocolStatements(backupfile, toc, externalProtocols, funcInfoMap)
 
 			testutils.AssertQueryRuns(connection, "CREATE OR REPLACE FUNCTION read_from_s3() RETURNS integer AS '$libdir/gps3ext.so', 's3_import' LANGUAGE C STABLE;")
 			defer testutils.AssertQueryRuns(connection, "DROP FUNCTION read_from_s3()")
@@ -758,7 +762,7 @@ SET SUBPARTITION TEMPLATE  ` + `
 		It("creates a protocol with a write function", func() {
 			externalProtocols := []backup.QueryExtProtocol{protocolWriteOnly}
 
-			backup.PrintCreateExternalProtocolStatements(buffer, externalProtocols, funcInfoMap)
+			backup.PrintCreateExternalProtocolStatements(backupfile, toc, externalProtocols, funcInfoMap)
 
 			testutils.AssertQueryRuns(connection, "CREATE OR REPLACE FUNCTION write_to_s3() RETURNS integer AS '$libdir/gps3ext.so', 's3_export' LANGUAGE C STABLE;")
 			defer testutils.AssertQueryRuns(connection, "DROP FUNCTION write_to_s3()")
@@ -774,7 +778,7 @@ SET SUBPARTITION TEMPLATE  ` + `
 		It("creates a protocol with a read and write function", func() {
 			externalProtocols := []backup.QueryExtProtocol{protocolReadWrite}
 
-			backup.PrintCreateExternalProtocolStatements(buffer, externalProtocols, funcInfoMap)
+			backup.PrintCreateExternalProtocolStatements(backupfile, toc, externalProtocols, funcInfoMap)
 
 			testutils.AssertQueryRuns(connection, "CREATE OR REPLACE FUNCTION read_from_s3() RETURNS integer AS '$libdir/gps3ext.so', 's3_import' LANGUAGE C STABLE;")
 			defer testutils.AssertQueryRuns(connection, "DROP FUNCTION read_from_s3()")
@@ -795,7 +799,7 @@ SET SUBPARTITION TEMPLATE  ` + `
 		It("creates a basic resource queue with a comment", func() {
 			basicQueue := backup.QueryResourceQueue{"basicQueue", -1, "32.80", false, "0.00", "medium", "-1", "this is a resource queue comment"}
 
-			backup.PrintCreateResourceQueueStatements(buffer, []backup.QueryResourceQueue{basicQueue})
+			backup.PrintCreateResourceQueueStatements(backupfile, toc, []backup.QueryResourceQueue{basicQueue})
 
 			// CREATE RESOURCE QUEUE statements can not be part of a multi-command statement, so
 			// feed the CREATE RESOURCE QUEUE and COMMENT ON statements separately.
@@ -816,7 +820,7 @@ SET SUBPARTITION TEMPLATE  ` + `
 		It("creates a resource queue with all attributes", func() {
 			everythingQueue := backup.QueryResourceQueue{"everythingQueue", 7, "32.80", true, "22.80", "low", "2GB", ""}
 
-			backup.PrintCreateResourceQueueStatements(buffer, []backup.QueryResourceQueue{everythingQueue})
+			backup.PrintCreateResourceQueueStatements(backupfile, toc, []backup.QueryResourceQueue{everythingQueue})
 
 			testutils.AssertQueryRuns(connection, buffer.String())
 			defer testutils.AssertQueryRuns(connection, `DROP RESOURCE QUEUE "everythingQueue"`)
@@ -855,7 +859,7 @@ SET SUBPARTITION TEMPLATE  ` + `
 				TimeConstraints: nil,
 			}
 
-			backup.PrintCreateRoleStatements(buffer, []backup.QueryRole{role1})
+			backup.PrintCreateRoleStatements(backupfile, toc, []backup.QueryRole{role1})
 
 			testutils.AssertQueryRuns(connection, buffer.String())
 			defer testutils.AssertQueryRuns(connection, `DROP ROLE "role1"`)
@@ -906,7 +910,7 @@ SET SUBPARTITION TEMPLATE  ` + `
 				},
 			}
 
-			backup.PrintCreateRoleStatements(buffer, []backup.QueryRole{role1})
+			backup.PrintCreateRoleStatements(backupfile, toc, []backup.QueryRole{role1})
 
 			testutils.AssertQueryRuns(connection, buffer.String())
 			defer testutils.AssertQueryRuns(connection, `DROP ROLE "role1"`)
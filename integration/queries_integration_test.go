@@ -1,6 +1,8 @@
 package integration
 
 import (
+	"time"
+
 	"github.com/greenplum-db/gpbackup/backup"
 	"github.com/greenplum-db/gpbackup/testutils"
 	"github.com/greenplum-db/gpbackup/utils"
@@ -63,6 +65,186 @@ PARTITION BY LIST (gender)
 			testutils.ExpectStructsToMatchExcluding(&tableRank, &tables[0], "SchemaOid", "RelationOid")
 		})
 	})
+	Describe("GetAllUserTables with filters", func() {
+		BeforeEach(func() {
+			testutils.AssertQueryRuns(connection, "CREATE TABLE foo(i int)")
+			testutils.AssertQueryRuns(connection, "CREATE SCHEMA testschema")
+			testutils.AssertQueryRuns(connection, "CREATE TABLE testschema.foo(i int)")
+			testutils.AssertQueryRuns(connection, "CREATE TABLE testschema.bar(i int)")
+		})
+		AfterEach(func() {
+			backup.SetFilters([]string{}, []string{}, []string{}, []string{})
+			testutils.AssertQueryRuns(connection, "DROP TABLE foo")
+			testutils.AssertQueryRuns(connection, "DROP SCHEMA testschema CASCADE")
+		})
+		It("returns only tables in included schemas", func() {
+			backup.SetFilters([]string{"testschema"}, []string{}, []string{}, []string{})
+			tables := backup.GetAllUserTables(connection)
+
+			Expect(len(tables)).To(Equal(2))
+			Expect(tables[0].ToString()).To(Equal("testschema.bar"))
+			Expect(tables[1].ToString()).To(Equal("testschema.foo"))
+		})
+		It("does not return tables in excluded schemas", func() {
+			backup.SetFilters([]string{}, []string{"testschema"}, []string{}, []string{})
+			tables := backup.GetAllUserTables(connection)
+
+			Expect(len(tables)).To(Equal(1))
+			Expect(tables[0].ToString()).To(Equal("public.foo"))
+		})
+		It("returns only included tables", func() {
+			backup.SetFilters([]string{}, []string{}, []string{"testschema.foo", "public.foo"}, []string{})
+			tables := backup.GetAllUserTables(connection)
+
+			Expect(len(tables)).To(Equal(2))
+			Expect(tables[0].ToString()).To(Equal("public.foo"))
+			Expect(tables[1].ToString()).To(Equal("testschema.foo"))
+		})
+		It("does not return excluded tables", func() {
+			backup.SetFilters([]string{}, []string{}, []string{}, []string{"testschema.foo"})
+			tables := backup.GetAllUserTables(connection)
+
+			Expect(len(tables)).To(Equal(2))
+			Expect(tables[0].ToString()).To(Equal("public.foo"))
+			Expect(tables[1].ToString()).To(Equal("testschema.bar"))
+		})
+	})
+	Describe("GetAOTableStates", func() {
+		It("returns a state for an append-optimized table that changes when its data changes", func() {
+			testutils.AssertQueryRuns(connection, "CREATE TABLE foo(i int) WITH (appendonly=true)")
+			defer testutils.AssertQueryRuns(connection, "DROP TABLE foo")
+			testutils.AssertQueryRuns(connection, "CREATE TABLE bar(i int)")
+			defer testutils.AssertQueryRuns(connection, "DROP TABLE bar")
+			tableFoo := utils.BasicRelation("public", "foo")
+			tableFoo.RelationOid = testutils.OidFromRelationName(connection, "public.foo")
+			tableBar := utils.BasicRelation("public", "bar")
+			tableBar.RelationOid = testutils.OidFromRelationName(connection, "public.bar")
+
+			states := backup.GetAOTableStates(connection, []utils.Relation{tableFoo, tableBar})
+			Expect(len(states)).To(Equal(1))
+			Expect(states["public.foo"].LastDDLTimestamp).ToNot(Equal(""))
+
+			testutils.AssertQueryRuns(connection, "INSERT INTO foo SELECT generate_series(1, 1000)")
+			newStates := backup.GetAOTableStates(connection, []utils.Relation{tableFoo, tableBar})
+			Expect(newStates["public.foo"].ModCount).To(BeNumerically(">", states["public.foo"].ModCount))
+			Expect(newStates["public.foo"].LastDDLTimestamp).To(Equal(states["public.foo"].LastDDLTimestamp))
+		})
+	})
+	Describe("GetTableSizes", func() {
+		It("returns the size of a heap table", func() {
+			testutils.AssertQueryRuns(connection, "CREATE TABLE foo(i int)")
+			defer testutils.AssertQueryRuns(connection, "DROP TABLE foo")
+			testutils.AssertQueryRuns(connection, "INSERT INTO foo SELECT generate_series(1, 1000)")
+			oid := testutils.OidFromRelationName(connection, "public.foo")
+			tableFoo := utils.BasicRelation("public", "foo")
+			tableFoo.RelationOid = oid
+
+			sizes := backup.GetTableSizes(connection, []utils.Relation{tableFoo})
+
+			Expect(len(sizes)).To(Equal(1))
+			Expect(sizes[oid]).To(BeNumerically(">", 0))
+		})
+		It("includes the sizes of the child partitions of a partition table", func() {
+			createStmt := `CREATE TABLE rank (id int, gender char(1))
+DISTRIBUTED BY (id)
+PARTITION BY LIST (gender)
+( PARTITION girls VALUES ('F'),
+  PARTITION boys VALUES ('M'),
+  DEFAULT PARTITION other );`
+			testutils.AssertQueryRuns(connection, createStmt)
+			defer testutils.AssertQueryRuns(connection, "DROP TABLE rank")
+			testutils.AssertQueryRuns(connection, "INSERT INTO rank SELECT generate_series(1, 1000), 'F'")
+			oid := testutils.OidFromRelationName(connection, "public.rank")
+			tableRank := utils.BasicRelation("public", "rank")
+			tableRank.RelationOid = oid
+
+			sizes := backup.GetTableSizes(connection, []utils.Relation{tableRank})
+
+			Expect(sizes[oid]).To(BeNumerically(">", 0))
+		})
+	})
+	Describe("GetLockHolders and LockTablesWithTimeout", func() {
+		It("locks every table when no timeout is set", func() {
+			testutils.AssertQueryRuns(connection, "CREATE TABLE foo(i int)")
+			defer testutils.AssertQueryRuns(connection, "DROP TABLE foo")
+			testutils.AssertQueryRuns(connection, "CREATE TABLE bar(i int)")
+			defer testutils.AssertQueryRuns(connection, "DROP TABLE bar")
+			tables := []utils.Relation{utils.BasicRelation("public", "foo"), utils.BasicRelation("public", "bar")}
+
+			connection.Begin()
+			defer connection.Commit()
+			lockErrors := backup.LockTablesWithTimeout(connection, tables, "ACCESS SHARE", 0)
+			lockCount := backup.SelectString(connection, "SELECT count(DISTINCT relation)::text AS string FROM pg_locks WHERE relation IN ('public.foo'::regclass, 'public.bar'::regclass) AND pid = pg_backend_pid() AND mode = 'AccessShareLock' AND granted")
+
+			Expect(lockErrors).To(BeEmpty())
+			Expect(lockCount).To(Equal("2"))
+		})
+		It("reports the session holding a conflicting lock on a table that cannot be locked", func() {
+			testutils.AssertQueryRuns(connection, "CREATE TABLE foo(i int)")
+			defer testutils.AssertQueryRuns(connection, "DROP TABLE foo")
+			testutils.AssertQueryRuns(connection, "CREATE TABLE bar(i int)")
+			defer testutils.AssertQueryRuns(connection, "DROP TABLE bar")
+			tableFoo := utils.BasicRelation("public", "foo")
+			tableFoo.RelationOid = testutils.OidFromRelationName(connection, "public.foo")
+			tableBar := utils.BasicRelation("public", "bar")
+
+			blockingConn := utils.NewDBConn("testdb")
+			blockingConn.Connect()
+			defer blockingConn.Close()
+			blockingConn.Begin()
+			testutils.AssertQueryRuns(blockingConn, "LOCK TABLE public.foo IN ACCESS EXCLUSIVE MODE")
+			defer blockingConn.Commit()
+
+			connection.Begin()
+			defer connection.Commit()
+			lockErrors := backup.LockTablesWithTimeout(connection, []utils.Relation{tableFoo, tableBar}, "ACCESS SHARE", 1)
+			holders := backup.GetLockHolders(connection, tableFoo, "ACCESS SHARE")
+
+			Expect(len(lockErrors)).To(Equal(1))
+			Expect(lockErrors).To(HaveKey("public.foo"))
+			Expect(len(holders)).To(Equal(1))
+			Expect(holders[0].Mode).To(Equal("AccessExclusiveLock"))
+			Expect(holders[0].Pid).To(BeNumerically(">", 0))
+		})
+	})
+	Describe("LockTablesForSnapshot", func() {
+		It("gives up instead of waiting forever when a session is queued to drop a table locked by another connection", func() {
+			testutils.AssertQueryRuns(connection, "CREATE TABLE foo(i int)")
+			defer connection.Exec("DROP TABLE IF EXISTS foo")
+			tableFoo := utils.BasicRelation("public", "foo")
+
+			lockConn := utils.NewDBConn("testdb")
+			lockConn.Connect()
+			defer lockConn.Close()
+			lockConn.Begin()
+			testutils.AssertQueryRuns(lockConn, "LOCK TABLE public.foo IN EXCLUSIVE MODE")
+
+			dropConn := utils.NewDBConn("testdb")
+			dropConn.Connect()
+			defer dropConn.Close()
+			dropDone := make(chan error)
+			go func() {
+				_, err := dropConn.Exec("DROP TABLE public.foo")
+				dropDone <- err
+			}()
+			Eventually(func() string {
+				return backup.SelectString(connection, "SELECT count(*)::text AS string FROM pg_locks WHERE relation = 'public.foo'::regclass AND NOT granted")
+			}, 5*time.Second).Should(Equal("1"))
+
+			workerConn := utils.NewDBConn("testdb")
+			workerConn.Connect()
+			defer workerConn.Close()
+			workerConn.Begin()
+			func() {
+				defer testutils.ShouldPanicWithMessage("Worker 0 was unable to lock 1 of 1 tables within 1 seconds")
+				backup.LockTablesForSnapshot(workerConn, []utils.Relation{tableFoo}, "Worker 0", 1)
+			}()
+			workerConn.Commit()
+
+			lockConn.Commit()
+			Expect(<-dropDone).ToNot(HaveOccurred())
+		})
+	})
 	Describe("GetTableAttributes", func() {
 		It("returns table attribute information for a heap table", func() {
 			testutils.AssertQueryRuns(connection, "CREATE TABLE atttable(a float, b text, c text NOT NULL, d int DEFAULT(5))")
@@ -277,6 +459,37 @@ PARTITION BY LIST (gender)
 			testutils.ExpectStructsToMatchExcluding(&mySequence2, &sequences[1], "SchemaOid", "RelationOid")
 		})
 	})
+	Describe("GetAllSequenceRelations with filters", func() {
+		AfterEach(func() {
+			backup.SetFilters([]string{}, []string{}, []string{}, []string{})
+		})
+		It("returns only sequences owned by included tables", func() {
+			testutils.AssertQueryRuns(connection, "CREATE TABLE foo(i serial)")
+			defer testutils.AssertQueryRuns(connection, "DROP TABLE foo")
+			testutils.AssertQueryRuns(connection, "CREATE TABLE bar(i serial)")
+			defer testutils.AssertQueryRuns(connection, "DROP TABLE bar")
+			testutils.AssertQueryRuns(connection, "CREATE SEQUENCE unowned_seq")
+			defer testutils.AssertQueryRuns(connection, "DROP SEQUENCE unowned_seq")
+			backup.SetFilters([]string{}, []string{}, []string{"public.foo"}, []string{})
+
+			sequences := backup.GetAllSequenceRelations(connection)
+
+			Expect(len(sequences)).To(Equal(1))
+			Expect(sequences[0].ToString()).To(Equal("public.foo_i_seq"))
+		})
+		It("does not return sequences owned by excluded tables", func() {
+			testutils.AssertQueryRuns(connection, "CREATE TABLE foo(i serial)")
+			defer testutils.AssertQueryRuns(connection, "DROP TABLE foo")
+			testutils.AssertQueryRuns(connection, "CREATE SEQUENCE unowned_seq")
+			defer testutils.AssertQueryRuns(connection, "DROP SEQUENCE unowned_seq")
+			backup.SetFilters([]string{}, []string{}, []string{}, []string{"public.foo"})
+
+			sequences := backup.GetAllSequenceRelations(connection)
+
+			Expect(len(sequences)).To(Equal(1))
+			Expect(sequences[0].ToString()).To(Equal("public.unowned_seq"))
+		})
+	})
 	Describe("GetSequenceDefinition", func() {
 		It("returns sequence information for sequence with default values", func() {
 			testutils.AssertQueryRuns(connection, "CREATE SEQUENCE my_sequence")
@@ -316,7 +529,20 @@ PARTITION BY LIST (gender)
 			sequenceMap := backup.GetSequenceOwnerMap(connection)
 
 			Expect(len(sequenceMap)).To(Equal(1))
-			Expect(sequenceMap["public.my_sequence"]).To(Equal("with_sequence.a"))
+			Expect(sequenceMap["public.my_sequence"].TableName).To(Equal("with_sequence"))
+			Expect(sequenceMap["public.my_sequence"].ColumnName).To(Equal("a"))
+		})
+		It("returns the owning table and column separately when the table name contains a dot", func() {
+			testutils.AssertQueryRuns(connection, `CREATE TABLE "with.sequence"(a int, b char(20));`)
+			defer testutils.AssertQueryRuns(connection, `DROP TABLE "with.sequence"`)
+			testutils.AssertQueryRuns(connection, `CREATE SEQUENCE my_sequence OWNED BY "with.sequence".a;`)
+			defer testutils.AssertQueryRuns(connection, "DROP SEQUENCE my_sequence")
+
+			sequenceMap := backup.GetSequenceOwnerMap(connection)
+
+			Expect(len(sequenceMap)).To(Equal(1))
+			Expect(sequenceMap["public.my_sequence"].TableName).To(Equal("with.sequence"))
+			Expect(sequenceMap["public.my_sequence"].ColumnName).To(Equal("a"))
 		})
 	})
 	Describe("GetDistributionPolicy", func() {
@@ -845,6 +1071,18 @@ SEGMENT REJECT LIMIT 10 PERCENT
 			Expect(result).To(Equal("gpadmin"))
 		})
 	})
+	Describe("GetDatabaseVersion", func() {
+		It("returns the version string of the database", func() {
+			result := backup.GetDatabaseVersion(connection)
+			Expect(result).To(ContainSubstring("Greenplum Database"))
+		})
+	})
+	Describe("GetDatabaseEncoding", func() {
+		It("returns the encoding of the database", func() {
+			result := backup.GetDatabaseEncoding(connection)
+			Expect(result).To(Equal("UTF8"))
+		})
+	})
 	Describe("GetPartitionDefinition", func() {
 		It("returns empty string when no partition exists", func() {
 			testutils.AssertQueryRuns(connection, "CREATE TABLE simple_table(i int)")
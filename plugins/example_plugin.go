@@ -0,0 +1,131 @@
+package main
+
+/*
+ * This is a reference implementation of the gpbackup storage plugin protocol,
+ * which stores backup files under the directory given by the "directory"
+ * option in its config file instead of in external storage, so that plugins
+ * can be tested without network access.  Each file is stored under its full
+ * local path inside that directory.
+ */
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const apiVersion = "0.1.0"
+
+type pluginConfig struct {
+	ExecutablePath string            `json:"executablepath"`
+	Options        map[string]string `json:"options"`
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		exitWithError(fmt.Errorf("Usage: %s <command> <config file> [<arguments>]", os.Args[0]))
+	}
+	command := os.Args[1]
+	if command == "plugin_api_version" {
+		fmt.Println(apiVersion)
+		return
+	}
+	if len(os.Args) != 4 {
+		exitWithError(fmt.Errorf("Command %s requires a config file and one argument", command))
+	}
+	directory, err := readStorageDirectory(os.Args[2])
+	if err != nil {
+		exitWithError(err)
+	}
+	err = runCommand(command, directory, os.Args[3], os.Stdin, os.Stdout)
+	if err != nil {
+		exitWithError(err)
+	}
+}
+
+func exitWithError(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
+
+func readStorageDirectory(configFile string) (string, error) {
+	contents, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return "", err
+	}
+	config := pluginConfig{}
+	err = json.Unmarshal(contents, &config)
+	if err != nil {
+		return "", fmt.Errorf("Unable to parse plugin config file %s: %v", configFile, err)
+	}
+	directory := config.Options["directory"]
+	if directory == "" {
+		return "", fmt.Errorf("Plugin config file %s does not set the directory option", configFile)
+	}
+	return directory, nil
+}
+
+func getStoragePath(directory string, filename string) string {
+	return filepath.Join(directory, filename)
+}
+
+/*
+ * The setup and cleanup commands have nothing to do beyond checking that the
+ * storage directory can be used, since files are stored as they are sent.
+ */
+func runCommand(command string, directory string, argument string, stdin io.Reader, stdout io.Writer) error {
+	switch command {
+	case "setup_plugin_for_backup", "setup_plugin_for_restore":
+		return os.MkdirAll(directory, 0700)
+	case "cleanup_plugin_for_backup", "cleanup_plugin_for_restore":
+		return nil
+	case "backup_file":
+		return copyFile(argument, getStoragePath(directory, argument))
+	case "restore_file":
+		return copyFile(getStoragePath(directory, argument), argument)
+	case "backup_data":
+		return writeFile(getStoragePath(directory, argument), stdin)
+	case "restore_data":
+		return readFile(getStoragePath(directory, argument), stdout)
+	}
+	return fmt.Errorf("Unknown command %s", command)
+}
+
+func copyFile(source string, destination string) error {
+	sourceFile, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer sourceFile.Close()
+	return writeFile(destination, sourceFile)
+}
+
+func writeFile(filename string, contents io.Reader) error {
+	err := os.MkdirAll(filepath.Dir(filename), 0700)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, contents)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func readFile(filename string, output io.Writer) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(output, file)
+	return err
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("plugins/example_plugin tests", func() {
+	var tempDir, storageDir, localDir string
+	BeforeEach(func() {
+		tempDir, _ = ioutil.TempDir("", "example_plugin")
+		storageDir = filepath.Join(tempDir, "storage")
+		localDir = filepath.Join(tempDir, "local")
+		os.MkdirAll(localDir, 0700)
+	})
+	AfterEach(func() {
+		os.RemoveAll(tempDir)
+	})
+
+	Describe("readStorageDirectory", func() {
+		It("reads the directory option from the config file", func() {
+			configFile := filepath.Join(tempDir, "config.json")
+			ioutil.WriteFile(configFile, []byte(`{"executablepath": "/bin/example_plugin", "options": {"directory": "/tmp/storage"}}`), 0600)
+			directory, err := readStorageDirectory(configFile)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(directory).To(Equal("/tmp/storage"))
+		})
+		It("returns an error if the directory option is not set", func() {
+			configFile := filepath.Join(tempDir, "config.json")
+			ioutil.WriteFile(configFile, []byte(`{"executablepath": "/bin/example_plugin"}`), 0600)
+			_, err := readStorageDirectory(configFile)
+			Expect(err).To(MatchError("Plugin config file " + configFile + " does not set the directory option"))
+		})
+	})
+	Describe("runCommand", func() {
+		It("stores a file and restores it to its local path", func() {
+			localFile := filepath.Join(localDir, "predata.sql")
+			ioutil.WriteFile(localFile, []byte("CREATE TABLE foo(i int);\n"), 0600)
+			Expect(runCommand("setup_plugin_for_backup", storageDir, localDir, nil, nil)).To(Succeed())
+			Expect(runCommand("backup_file", storageDir, localFile, nil, nil)).To(Succeed())
+			Expect(filepath.Join(storageDir, localFile)).To(BeAnExistingFile())
+
+			os.Remove(localFile)
+			Expect(runCommand("restore_file", storageDir, localFile, nil, nil)).To(Succeed())
+			contents, _ := ioutil.ReadFile(localFile)
+			Expect(string(contents)).To(Equal("CREATE TABLE foo(i int);\n"))
+		})
+		It("stores data read from stdin and writes it back to stdout", func() {
+			dataFile := filepath.Join(localDir, "gpbackup_0_20170101010101_1234")
+			Expect(runCommand("backup_data", storageDir, dataFile, bytes.NewBufferString("1,2\n3,4\n"), nil)).To(Succeed())
+			output := &bytes.Buffer{}
+			Expect(runCommand("restore_data", storageDir, dataFile, nil, output)).To(Succeed())
+			Expect(output.String()).To(Equal("1,2\n3,4\n"))
+		})
+		It("returns an error if a file to restore was never stored", func() {
+			Expect(runCommand("restore_file", storageDir, filepath.Join(localDir, "missing"), nil, nil)).ToNot(Succeed())
+		})
+		It("returns an error for an unknown command", func() {
+			Expect(runCommand("delete_backup", storageDir, localDir, nil, nil)).To(MatchError("Unknown command delete_backup"))
+		})
+	})
+})
@@ -0,0 +1,290 @@
+package restore
+
+/*
+ * This file contains structs and functions related to restoring data on the segments.
+ */
+
+import (
+	"bufio"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/greenplum-db/gpbackup/utils"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	tableDelim = ","
+)
+
+/*
+ * BaseTimestamp is set for tables in an incremental backup whose data was not
+ * dumped because it was unchanged since the base backup, and is the timestamp
+ * of the backup containing the table's data files.
+ */
+type TableMapEntry struct {
+	utils.Relation
+	Size          int64
+	BaseTimestamp string
+}
+
+/*
+ * The table map file contains one "schema.table: oid size" line for each table
+ * whose data was backed up, where the oid is the one used to name that table's
+ * data files on the segments, followed by the timestamp of the base backup for
+ * tables whose data files are in that backup.  Older backups record only the
+ * oid, in which case the size is left at 0.  The Relations only have their
+ * names and RelationOid set.
+ */
+func ReadTableMapFile(filename string) []TableMapEntry {
+	tableMapFile := utils.MustOpenFileForReading(filename)
+	entries := make([]TableMapEntry, 0)
+	scanner := bufio.NewScanner(tableMapFile)
+	for scanner.Scan() {
+		line := scanner.Text()
+		// Neither the oid nor the size contains ": ", so the last occurrence separates them from the table name
+		delimIndex := strings.LastIndex(line, ": ")
+		if delimIndex == -1 {
+			logger.Fatal(errors.Errorf("Invalid line in table map file: %s", line), "")
+		}
+		entry := TableMapEntry{Relation: utils.RelationFromString(line[:delimIndex])}
+		fields := strings.Fields(line[delimIndex+2:])
+		if len(fields) < 1 || len(fields) > 3 {
+			logger.Fatal(errors.Errorf("Invalid line in table map file: %s", line), "")
+		}
+		oid, err := strconv.ParseUint(fields[0], 10, 32)
+		if err != nil {
+			logger.Fatal(errors.Errorf("Invalid oid in table map file line: %s", line), "")
+		}
+		entry.RelationOid = uint32(oid)
+		if len(fields) >= 2 {
+			entry.Size, err = strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				logger.Fatal(errors.Errorf("Invalid size in table map file line: %s", line), "")
+			}
+		}
+		if len(fields) == 3 {
+			if !utils.IsValidTimestamp(fields[2]) {
+				logger.Fatal(errors.Errorf("Invalid base backup timestamp in table map file line: %s", line), "")
+			}
+			entry.BaseTimestamp = fields[2]
+		}
+		entries = append(entries, entry)
+	}
+	utils.CheckError(scanner.Err())
+	return entries
+}
+
+/*
+ * The row count file contains one "schema.table: oid rows" line for each table
+ * whose data was dumped in the backup.  The returned map is keyed by oid.
+ */
+func ReadRowCountFile(filename string) map[uint32]int64 {
+	rowCountFile := utils.MustOpenFileForReading(filename)
+	rowCounts := make(map[uint32]int64, 0)
+	scanner := bufio.NewScanner(rowCountFile)
+	for scanner.Scan() {
+		line := scanner.Text()
+		delimIndex := strings.LastIndex(line, ": ")
+		if delimIndex == -1 {
+			logger.Fatal(errors.Errorf("Invalid line in row count file: %s", line), "")
+		}
+		fields := strings.Fields(line[delimIndex+2:])
+		if len(fields) != 2 {
+			logger.Fatal(errors.Errorf("Invalid line in row count file: %s", line), "")
+		}
+		oid, oidErr := strconv.ParseUint(fields[0], 10, 32)
+		rowCount, rowCountErr := strconv.ParseInt(fields[1], 10, 64)
+		if oidErr != nil || rowCountErr != nil {
+			logger.Fatal(errors.Errorf("Invalid line in row count file: %s", line), "")
+		}
+		rowCounts[uint32(oid)] = rowCount
+	}
+	utils.CheckError(scanner.Err())
+	return rowCounts
+}
+
+/*
+ * The error is returned instead of being handled here because this function
+ * is called from worker goroutines, where a panic could not be recovered by
+ * DoTeardown.  Compressed data files are decompressed on each segment by the
+ * program for the compression type of the backup.  The number of rows loaded
+ * across all segments is returned on success.
+ */
+func CopyTableIn(connection *utils.DBConn, tableName string, backupFile string) (int64, error) {
+	query := fmt.Sprintf("COPY %s FROM %s WITH CSV DELIMITER '%s' ON SEGMENT;", tableName, utils.GetCopyFromSource(backupFile), tableDelim)
+	result, err := connection.Exec(query)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func GetTableMapEntryFilePath(entry TableMapEntry) string {
+	if entry.BaseTimestamp != "" {
+		return utils.GetTableBackupFilePathForTimestamp(entry.RelationOid, entry.BaseTimestamp)
+	}
+	return utils.GetTableBackupFilePath(entry.RelationOid)
+}
+
+/*
+ * Returns the timestamps of the earlier backups whose data files are needed
+ * to restore the given tables, in sorted order.
+ */
+func GetBaseTimestamps(entries []TableMapEntry) []string {
+	timestampSet := make(map[string]bool, 0)
+	for _, entry := range entries {
+		if entry.BaseTimestamp != "" {
+			timestampSet[entry.BaseTimestamp] = true
+		}
+	}
+	timestamps := make([]string, 0)
+	for timestamp := range timestampSet {
+		timestamps = append(timestamps, timestamp)
+	}
+	sort.Strings(timestamps)
+	return timestamps
+}
+
+/*
+ * Functions for loading data in parallel
+ */
+
+type TableMapEntries []TableMapEntry
+
+func (slice TableMapEntries) Len() int {
+	return len(slice)
+}
+
+// Sort by descending size, so the largest tables are loaded first
+func (slice TableMapEntries) Less(i int, j int) bool {
+	return slice[i].Size > slice[j].Size
+}
+
+func (slice TableMapEntries) Swap(i int, j int) {
+	slice[i], slice[j] = slice[j], slice[i]
+}
+
+/*
+ * Scheduling the largest tables first keeps one large table started near the
+ * end from holding up the whole restore after every other table has loaded.
+ */
+func SortTableMapEntriesBySize(entries TableMapEntries) {
+	sort.Stable(entries)
+}
+
+type DataRestoreResults struct {
+	Loaded  []string
+	Failed  map[string]error
+	Skipped []string
+}
+
+/*
+ * Tables are handed out to the connections from a shared queue in the order given.
+ * Since restore does not run in a transaction, a connection can keep loading other
+ * tables after a failed COPY.  If stopOnError is true, no new tables are started
+ * once any COPY has failed, and the tables never started are reported as skipped.
+ * No new tables are started after a signal is received either.
+ * A table whose number of rows loaded differs from its number of rows in
+ * expectedRowCounts, keyed by FQN, is reported as failed; tables with no
+ * expected row count are not checked.  Progress is reported using the table
+ * sizes recorded in the table map.
+ */
+func CopyAllTablesIn(connections []*utils.DBConn, entries []TableMapEntry, expectedRowCounts map[string]int64, stopOnError bool) DataRestoreResults {
+	tableQueue := make(chan TableMapEntry, len(entries))
+	for _, entry := range entries {
+		tableQueue <- entry
+	}
+	close(tableQueue)
+
+	totalSize := int64(0)
+	for _, entry := range entries {
+		totalSize += entry.Size
+	}
+	progress := utils.NewProgressReporter("Restoring data", len(entries), totalSize)
+	progress.Start()
+
+	results := DataRestoreResults{Loaded: []string{}, Failed: map[string]error{}, Skipped: []string{}}
+	var mutex sync.Mutex
+	var waitGroup sync.WaitGroup
+	for _, conn := range connections {
+		waitGroup.Add(1)
+		go func(conn *utils.DBConn) {
+			defer waitGroup.Done()
+			for entry := range tableQueue {
+				tableName := entry.ToString()
+				mutex.Lock()
+				shouldSkip := (stopOnError && len(results.Failed) > 0) || utils.WasSignalReceived()
+				if shouldSkip {
+					results.Skipped = append(results.Skipped, tableName)
+				}
+				mutex.Unlock()
+				if shouldSkip {
+					continue
+				}
+				logger.Verbose("Reading data for table %s from file", tableName)
+				progress.StartTable(tableName, entry.Size)
+				rowCount, err := CopyTableIn(conn, tableName, GetTableMapEntryFilePath(entry))
+				progress.FinishTable(tableName)
+				if expectedRowCount, ok := expectedRowCounts[tableName]; ok && err == nil && rowCount != expectedRowCount {
+					err = errors.Errorf("Loaded %d rows, but %d rows were backed up", rowCount, expectedRowCount)
+				}
+				mutex.Lock()
+				if err != nil {
+					results.Failed[tableName] = err
+				} else {
+					results.Loaded = append(results.Loaded, tableName)
+				}
+				mutex.Unlock()
+			}
+		}(conn)
+	}
+	waitGroup.Wait()
+	progress.Stop()
+	return results
+}
+
+/*
+ * Logs which tables were loaded, failed, or skipped and returns the exit code
+ * corresponding to the outcome of the data restore.  Failures take precedence
+ * over skipped tables, since a failure is what causes the remaining tables to
+ * be skipped unless on-error-continue is set.
+ */
+func ReportDataRestoreResults(results DataRestoreResults) int {
+	numTables := len(results.Loaded) + len(results.Failed) + len(results.Skipped)
+	logger.Info("Data restore summary: %d of %d tables loaded, %d failed, %d skipped", len(results.Loaded), numTables, len(results.Failed), len(results.Skipped))
+	for _, tableName := range results.Loaded {
+		logger.Verbose("Loaded data for table %s", tableName)
+	}
+	failedTables := make([]string, 0)
+	for tableName := range results.Failed {
+		failedTables = append(failedTables, tableName)
+	}
+	sort.Strings(failedTables)
+	for _, tableName := range failedTables {
+		logger.Error("Unable to restore data for table %s: %v", tableName, results.Failed[tableName])
+	}
+	for _, tableName := range results.Skipped {
+		logger.Warn("Skipped restoring data for table %s", tableName)
+	}
+	if len(results.Failed) > 0 {
+		return EXIT_TABLES_FAILED
+	} else if len(results.Skipped) > 0 {
+		return EXIT_TABLES_SKIPPED
+	}
+	return EXIT_SUCCESS
+}
+
+/*
+ * The post-data metadata is not restored once the data restore has stopped
+ * partway, which it does after a failure when stopping on error, or after a
+ * signal, in which case tables are skipped.  The restore then ends without a
+ * fatal error, so that it exits with the code from ReportDataRestoreResults.
+ */
+func ShouldStopAfterDataRestore(results DataRestoreResults, stopOnError bool) bool {
+	return len(results.Skipped) > 0 || (stopOnError && len(results.Failed) > 0)
+}
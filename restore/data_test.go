@@ -0,0 +1,327 @@
+package restore_test
+
+import (
+	"errors"
+	"os"
+	"regexp"
+
+	"github.com/greenplum-db/gpbackup/restore"
+	"github.com/greenplum-db/gpbackup/testutils"
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+var _ = Describe("restore/data tests", func() {
+	var connection *utils.DBConn
+	var mock sqlmock.Sqlmock
+	var logfile *gbytes.Buffer
+	BeforeEach(func() {
+		connection, mock = testutils.CreateAndConnectMockDB()
+		var testLogger *utils.Logger
+		testLogger, _, _, logfile = testutils.SetupTestLogger()
+		restore.SetLogger(testLogger)
+		utils.SetDumpTimestamp("20170101010101")
+		utils.BaseDumpDir = utils.DefaultSegmentDir
+	})
+	Describe("CopyTableIn", func() {
+		It("will restore a table from its own file", func() {
+			execStr := "COPY public.foo FROM '<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456' WITH CSV DELIMITER ',' ON SEGMENT;"
+			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
+			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456"
+			rowCount, err := restore.CopyTableIn(connection, "public.foo", filename)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rowCount).To(Equal(int64(0)))
+		})
+		DescribeTable("will restore a table from its own file through the decompression program", func(compressionType string, execStr string) {
+			utils.SetCompression(compressionType, 0)
+			defer utils.SetCompression("none", 0)
+			mock.ExpectExec(regexp.QuoteMeta(execStr)).WillReturnResult(sqlmock.NewResult(10, 0))
+			_, err := restore.CopyTableIn(connection, "public.foo", utils.GetTableBackupFilePath(3456))
+			Expect(err).ToNot(HaveOccurred())
+		},
+			Entry("with gzip", "gzip", "COPY public.foo FROM PROGRAM 'gzip -d -c <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.gz' WITH CSV DELIMITER ',' ON SEGMENT;"),
+			Entry("with zstd", "zstd", "COPY public.foo FROM PROGRAM 'zstd -q -d -c <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.zst' WITH CSV DELIMITER ',' ON SEGMENT;"),
+			Entry("with lz4", "lz4", "COPY public.foo FROM PROGRAM 'lz4 -d -c <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.lz4' WITH CSV DELIMITER ',' ON SEGMENT;"),
+			Entry("with no compression", "none", "COPY public.foo FROM '<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456' WITH CSV DELIMITER ',' ON SEGMENT;"),
+		)
+		It("returns the number of rows loaded", func() {
+			mock.ExpectExec("COPY public.foo FROM").WillReturnResult(sqlmock.NewResult(0, 42))
+			rowCount, err := restore.CopyTableIn(connection, "public.foo", "file")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rowCount).To(Equal(int64(42)))
+		})
+		It("returns an error if the COPY fails", func() {
+			mock.ExpectExec("COPY public.foo FROM").WillReturnError(errors.New("relation does not exist"))
+			_, err := restore.CopyTableIn(connection, "public.foo", "file")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("relation does not exist"))
+		})
+	})
+	Describe("ReadTableMapFile", func() {
+		mockTableMapFile := func(contents string) {
+			r, w, _ := os.Pipe()
+			w.WriteString(contents)
+			w.Close()
+			utils.System.OpenFile = func(name string, flag int, perm os.FileMode) (*os.File, error) { return r, nil }
+		}
+		AfterEach(func() {
+			utils.System.OpenFile = os.OpenFile
+		})
+
+		It("reads a map file containing one table", func() {
+			mockTableMapFile("public.foo: 1234\n")
+			tables := restore.ReadTableMapFile("table_map")
+			Expect(len(tables)).To(Equal(1))
+			Expect(tables[0].ToString()).To(Equal("public.foo"))
+			Expect(tables[0].RelationOid).To(Equal(uint32(1234)))
+		})
+		It("reads a map file containing multiple tables with special characters", func() {
+			mockTableMapFile("public.foo: 1234\npublic.\"foo|bar\": 2345\n\"my: schema\".\"my: table\": 3456\n")
+			tables := restore.ReadTableMapFile("table_map")
+			Expect(len(tables)).To(Equal(3))
+			Expect(tables[0].ToString()).To(Equal("public.foo"))
+			Expect(tables[0].RelationOid).To(Equal(uint32(1234)))
+			Expect(tables[1].RelationName).To(Equal("foo|bar"))
+			Expect(tables[1].RelationOid).To(Equal(uint32(2345)))
+			Expect(tables[2].SchemaName).To(Equal("my: schema"))
+			Expect(tables[2].RelationName).To(Equal("my: table"))
+			Expect(tables[2].RelationOid).To(Equal(uint32(3456)))
+		})
+		It("reads a map file containing table sizes", func() {
+			mockTableMapFile("public.foo: 1234 8192\npublic.\"foo|bar\": 2345 0\n")
+			tables := restore.ReadTableMapFile("table_map")
+			Expect(len(tables)).To(Equal(2))
+			Expect(tables[0].ToString()).To(Equal("public.foo"))
+			Expect(tables[0].RelationOid).To(Equal(uint32(1234)))
+			Expect(tables[0].Size).To(Equal(int64(8192)))
+			Expect(tables[1].RelationName).To(Equal("foo|bar"))
+			Expect(tables[1].RelationOid).To(Equal(uint32(2345)))
+			Expect(tables[1].Size).To(Equal(int64(0)))
+		})
+		It("sets the size to 0 if a line has no size", func() {
+			mockTableMapFile("public.foo: 1234\n")
+			tables := restore.ReadTableMapFile("table_map")
+			Expect(tables[0].Size).To(Equal(int64(0)))
+		})
+		It("panics if a line has no oid", func() {
+			mockTableMapFile("public.foo\n")
+			defer testutils.ShouldPanicWithMessage("Invalid line in table map file: public.foo")
+			restore.ReadTableMapFile("table_map")
+		})
+		It("panics if a line has an invalid oid", func() {
+			mockTableMapFile("public.foo: bar\n")
+			defer testutils.ShouldPanicWithMessage("Invalid oid in table map file line: public.foo: bar")
+			restore.ReadTableMapFile("table_map")
+		})
+		It("panics if a line has an invalid size", func() {
+			mockTableMapFile("public.foo: 1234 bar\n")
+			defer testutils.ShouldPanicWithMessage("Invalid size in table map file line: public.foo: 1234 bar")
+			restore.ReadTableMapFile("table_map")
+		})
+		It("reads the timestamp of the base backup for tables whose data is in that backup", func() {
+			mockTableMapFile("public.foo: 1234 8192\npublic.bar: 2345 0 20161231010101\n")
+			tables := restore.ReadTableMapFile("table_map")
+			Expect(tables[0].BaseTimestamp).To(Equal(""))
+			Expect(tables[1].BaseTimestamp).To(Equal("20161231010101"))
+		})
+		It("panics if a line has an invalid base backup timestamp", func() {
+			mockTableMapFile("public.foo: 1234 0 bar\n")
+			defer testutils.ShouldPanicWithMessage("Invalid base backup timestamp in table map file line: public.foo: 1234 0 bar")
+			restore.ReadTableMapFile("table_map")
+		})
+	})
+	Describe("GetTableMapEntryFilePath", func() {
+		It("returns the path of the data file in the backup being restored", func() {
+			entry := restore.TableMapEntry{Relation: utils.Relation{RelationOid: 1234}}
+			Expect(restore.GetTableMapEntryFilePath(entry)).To(Equal("<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_1234"))
+		})
+		It("returns the path of the data file in the base backup for a table whose data is in that backup", func() {
+			entry := restore.TableMapEntry{Relation: utils.Relation{RelationOid: 1234}, BaseTimestamp: "20161231010101"}
+			Expect(restore.GetTableMapEntryFilePath(entry)).To(Equal("<SEG_DATA_DIR>/backups/20161231/20161231010101/gpbackup_<SEGID>_20161231010101_1234"))
+		})
+	})
+	Describe("GetBaseTimestamps", func() {
+		It("returns each base backup timestamp once, in sorted order", func() {
+			entries := []restore.TableMapEntry{
+				{Relation: utils.BasicRelation("public", "foo"), BaseTimestamp: "20161231010101"},
+				{Relation: utils.BasicRelation("public", "bar")},
+				{Relation: utils.BasicRelation("public", "baz"), BaseTimestamp: "20161130010101"},
+				{Relation: utils.BasicRelation("public", "qux"), BaseTimestamp: "20161231010101"},
+			}
+			Expect(restore.GetBaseTimestamps(entries)).To(Equal([]string{"20161130010101", "20161231010101"}))
+		})
+		It("returns no timestamps if all data is in the backup being restored", func() {
+			entries := []restore.TableMapEntry{{Relation: utils.BasicRelation("public", "foo")}}
+			Expect(restore.GetBaseTimestamps(entries)).To(BeEmpty())
+		})
+	})
+	Describe("SortTableMapEntriesBySize", func() {
+		It("sorts tables from largest to smallest, keeping the order of tables with equal sizes", func() {
+			entries := []restore.TableMapEntry{
+				{Relation: utils.BasicRelation("public", "small"), Size: 10},
+				{Relation: utils.BasicRelation("public", "large"), Size: 1000},
+				{Relation: utils.BasicRelation("public", "empty1"), Size: 0},
+				{Relation: utils.BasicRelation("public", "medium"), Size: 100},
+				{Relation: utils.BasicRelation("public", "empty2"), Size: 0},
+			}
+			restore.SortTableMapEntriesBySize(entries)
+			names := []string{}
+			for _, entry := range entries {
+				names = append(names, entry.RelationName)
+			}
+			Expect(names).To(Equal([]string{"large", "medium", "small", "empty1", "empty2"}))
+		})
+	})
+	Describe("ReadRowCountFile", func() {
+		AfterEach(func() {
+			utils.System.OpenFile = os.OpenFile
+		})
+		mockRowCountFile := func(contents string) {
+			r, w, _ := os.Pipe()
+			w.WriteString(contents)
+			w.Close()
+			utils.System.OpenFile = func(name string, flag int, perm os.FileMode) (*os.File, error) { return r, nil }
+		}
+		It("reads the row count of each table keyed by oid", func() {
+			mockRowCountFile("public.foo: 1234 10\n\"my: schema\".\"my: table\": 2345 0\n")
+			Expect(restore.ReadRowCountFile("row_counts")).To(Equal(map[uint32]int64{1234: 10, 2345: 0}))
+		})
+		It("panics if a line has no row count", func() {
+			mockRowCountFile("public.foo: 1234\n")
+			defer testutils.ShouldPanicWithMessage("Invalid line in row count file: public.foo: 1234")
+			restore.ReadRowCountFile("row_counts")
+		})
+		It("panics if a line has an invalid row count", func() {
+			mockRowCountFile("public.foo: 1234 bar\n")
+			defer testutils.ShouldPanicWithMessage("Invalid line in row count file: public.foo: 1234 bar")
+			restore.ReadRowCountFile("row_counts")
+		})
+	})
+	Describe("CopyAllTablesIn", func() {
+		var entries []restore.TableMapEntry
+		BeforeEach(func() {
+			foo := restore.TableMapEntry{Relation: utils.BasicRelation("public", "foo")}
+			foo.RelationOid = 1234
+			bar := restore.TableMapEntry{Relation: utils.BasicRelation("public", "bar")}
+			bar.RelationOid = 2345
+			baz := restore.TableMapEntry{Relation: utils.BasicRelation("public", "baz")}
+			baz.RelationOid = 3456
+			entries = []restore.TableMapEntry{foo, bar, baz}
+		})
+		It("loads all tables in order over a single connection", func() {
+			mock.ExpectExec(regexp.QuoteMeta("COPY public.foo FROM '<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_1234'")).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(regexp.QuoteMeta("COPY public.bar FROM '<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_2345'")).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(regexp.QuoteMeta("COPY public.baz FROM '<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456'")).WillReturnResult(sqlmock.NewResult(0, 0))
+			results := restore.CopyAllTablesIn([]*utils.DBConn{connection}, entries, map[string]int64{}, true)
+			Expect(results.Loaded).To(Equal([]string{"public.foo", "public.bar", "public.baz"}))
+			Expect(results.Failed).To(BeEmpty())
+			Expect(results.Skipped).To(BeEmpty())
+			Expect(mock.ExpectationsWereMet()).To(Succeed())
+		})
+		It("loads all tables over multiple connections", func() {
+			connection2, mock2 := testutils.CreateAndConnectMockDB()
+			mock.MatchExpectationsInOrder(false)
+			mock2.MatchExpectationsInOrder(false)
+			for _, m := range []sqlmock.Sqlmock{mock, mock2} {
+				for _, table := range []string{"foo", "bar", "baz"} {
+					m.ExpectExec("COPY public." + table + " FROM").WillReturnResult(sqlmock.NewResult(0, 0))
+				}
+			}
+			results := restore.CopyAllTablesIn([]*utils.DBConn{connection, connection2}, entries, map[string]int64{}, true)
+			Expect(results.Loaded).To(ConsistOf("public.foo", "public.bar", "public.baz"))
+			Expect(results.Failed).To(BeEmpty())
+			Expect(results.Skipped).To(BeEmpty())
+		})
+		It("skips the remaining tables after a failure when stopping on error", func() {
+			mock.ExpectExec("COPY public.foo FROM").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("COPY public.bar FROM").WillReturnError(errors.New("invalid input syntax"))
+			results := restore.CopyAllTablesIn([]*utils.DBConn{connection}, entries, map[string]int64{}, true)
+			Expect(results.Loaded).To(Equal([]string{"public.foo"}))
+			Expect(len(results.Failed)).To(Equal(1))
+			Expect(results.Failed["public.bar"].Error()).To(Equal("invalid input syntax"))
+			Expect(results.Skipped).To(Equal([]string{"public.baz"}))
+		})
+		It("continues loading the remaining tables after a failure when not stopping on error", func() {
+			mock.ExpectExec("COPY public.foo FROM").WillReturnError(errors.New("invalid input syntax"))
+			mock.ExpectExec("COPY public.bar FROM").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("COPY public.baz FROM").WillReturnResult(sqlmock.NewResult(0, 0))
+			results := restore.CopyAllTablesIn([]*utils.DBConn{connection}, entries, map[string]int64{}, false)
+			Expect(results.Loaded).To(Equal([]string{"public.bar", "public.baz"}))
+			Expect(len(results.Failed)).To(Equal(1))
+			Expect(results.Skipped).To(BeEmpty())
+		})
+		It("reports a table as failed if the number of rows loaded differs from the number backed up", func() {
+			mock.ExpectExec("COPY public.foo FROM").WillReturnResult(sqlmock.NewResult(0, 10))
+			mock.ExpectExec("COPY public.bar FROM").WillReturnResult(sqlmock.NewResult(0, 5))
+			mock.ExpectExec("COPY public.baz FROM").WillReturnResult(sqlmock.NewResult(0, 7))
+			expectedRowCounts := map[string]int64{"public.foo": 10, "public.bar": 20}
+			results := restore.CopyAllTablesIn([]*utils.DBConn{connection}, entries, expectedRowCounts, false)
+			Expect(results.Loaded).To(Equal([]string{"public.foo", "public.baz"}))
+			Expect(len(results.Failed)).To(Equal(1))
+			Expect(results.Failed["public.bar"]).To(MatchError("Loaded 5 rows, but 20 rows were backed up"))
+		})
+	})
+	Describe("ReportDataRestoreResults", func() {
+		It("returns the success exit code if all tables loaded", func() {
+			results := restore.DataRestoreResults{Loaded: []string{"public.foo", "public.bar"}, Failed: map[string]error{}, Skipped: []string{}}
+			Expect(restore.ReportDataRestoreResults(results)).To(Equal(restore.EXIT_SUCCESS))
+			Expect(logfile).To(gbytes.Say("Data restore summary: 2 of 2 tables loaded, 0 failed, 0 skipped"))
+		})
+		It("returns the failure exit code and logs failed tables if no tables were skipped", func() {
+			results := restore.DataRestoreResults{Loaded: []string{"public.foo"}, Failed: map[string]error{"public.bar": errors.New("invalid input syntax")}, Skipped: []string{}}
+			Expect(restore.ReportDataRestoreResults(results)).To(Equal(restore.EXIT_TABLES_FAILED))
+			Expect(logfile).To(gbytes.Say("Data restore summary: 1 of 2 tables loaded, 1 failed, 0 skipped"))
+			Expect(logfile).To(gbytes.Say("Unable to restore data for table public.bar: invalid input syntax"))
+		})
+		It("returns the failure exit code and logs failed and skipped tables if tables both failed and were skipped", func() {
+			results := restore.DataRestoreResults{Loaded: []string{}, Failed: map[string]error{"public.foo": errors.New("invalid input syntax")}, Skipped: []string{"public.bar"}}
+			Expect(restore.ReportDataRestoreResults(results)).To(Equal(restore.EXIT_TABLES_FAILED))
+			Expect(logfile).To(gbytes.Say("Data restore summary: 0 of 2 tables loaded, 1 failed, 1 skipped"))
+			Expect(logfile).To(gbytes.Say("Unable to restore data for table public.foo: invalid input syntax"))
+			Expect(logfile).To(gbytes.Say("Skipped restoring data for table public.bar"))
+		})
+		It("returns the skipped exit code if tables were skipped but none failed", func() {
+			results := restore.DataRestoreResults{Loaded: []string{"public.foo"}, Failed: map[string]error{}, Skipped: []string{"public.bar"}}
+			Expect(restore.ReportDataRestoreResults(results)).To(Equal(restore.EXIT_TABLES_SKIPPED))
+			Expect(logfile).To(gbytes.Say("Data restore summary: 1 of 2 tables loaded, 0 failed, 1 skipped"))
+			Expect(logfile).To(gbytes.Say("Skipped restoring data for table public.bar"))
+		})
+	})
+	Describe("ShouldStopAfterDataRestore", func() {
+		It("stops with the failure exit code after a table fails when stopping on error", func() {
+			foo := restore.TableMapEntry{Relation: utils.BasicRelation("public", "foo")}
+			bar := restore.TableMapEntry{Relation: utils.BasicRelation("public", "bar")}
+			mock.ExpectExec("COPY public.foo FROM").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("COPY public.bar FROM").WillReturnError(errors.New("invalid input syntax"))
+			results := restore.CopyAllTablesIn([]*utils.DBConn{connection}, []restore.TableMapEntry{foo, bar}, map[string]int64{}, true)
+			Expect(restore.ReportDataRestoreResults(results)).To(Equal(restore.EXIT_TABLES_FAILED))
+			Expect(restore.ShouldStopAfterDataRestore(results, true)).To(BeTrue())
+		})
+		It("stops with the failure exit code when the first table fails and the rest are skipped when stopping on error", func() {
+			foo := restore.TableMapEntry{Relation: utils.BasicRelation("public", "foo")}
+			bar := restore.TableMapEntry{Relation: utils.BasicRelation("public", "bar")}
+			mock.ExpectExec("COPY public.foo FROM").WillReturnError(errors.New("invalid input syntax"))
+			results := restore.CopyAllTablesIn([]*utils.DBConn{connection}, []restore.TableMapEntry{foo, bar}, map[string]int64{}, true)
+			Expect(restore.ReportDataRestoreResults(results)).To(Equal(restore.EXIT_TABLES_FAILED))
+			Expect(restore.ShouldStopAfterDataRestore(results, true)).To(BeTrue())
+		})
+		It("stops with the skipped exit code if tables were skipped but none failed", func() {
+			results := restore.DataRestoreResults{Loaded: []string{"public.foo"}, Failed: map[string]error{}, Skipped: []string{"public.bar"}}
+			Expect(restore.ReportDataRestoreResults(results)).To(Equal(restore.EXIT_TABLES_SKIPPED))
+			Expect(restore.ShouldStopAfterDataRestore(results, true)).To(BeTrue())
+		})
+		It("continues if tables failed but none were skipped when not stopping on error", func() {
+			results := restore.DataRestoreResults{Loaded: []string{"public.foo"}, Failed: map[string]error{"public.bar": errors.New("invalid input syntax")}, Skipped: []string{}}
+			Expect(restore.ShouldStopAfterDataRestore(results, false)).To(BeFalse())
+		})
+		It("continues if all tables loaded", func() {
+			results := restore.DataRestoreResults{Loaded: []string{"public.foo"}, Failed: map[string]error{}, Skipped: []string{}}
+			Expect(restore.ShouldStopAfterDataRestore(results, true)).To(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,252 @@
+package restore
+
+/*
+ * This file contains functions related to restoring individual objects from
+ * the metadata files using the TOC, such as restoring only the objects in
+ * particular schemas or tables from a backup.
+ */
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/greenplum-db/gpbackup/utils"
+
+	"github.com/pkg/errors"
+)
+
+var ( // Schema and table filters, parsed from the filter flags
+	includeSchemas []utils.Schema
+	excludeSchemas []utils.Schema
+	includeTables  []utils.Relation
+	excludeTables  []utils.Relation
+)
+
+/*
+ * Parses the schema and table names passed to the filter flags.  When any
+ * tables are included, only those tables and the objects that belong to them
+ * (constraints, indexes, rules, triggers, and owned sequences) are restored,
+ * along with their schemas; otherwise, all objects in the included schemas
+ * that are not in an excluded schema or table are restored.
+ */
+func SetFilters(inclSchemas []string, exclSchemas []string, inclTables []string, exclTables []string) {
+	includeSchemas = make([]utils.Schema, 0)
+	for _, schema := range inclSchemas {
+		includeSchemas = append(includeSchemas, utils.SchemaFromString(schema))
+	}
+	excludeSchemas = make([]utils.Schema, 0)
+	for _, schema := range exclSchemas {
+		excludeSchemas = append(excludeSchemas, utils.SchemaFromString(schema))
+	}
+	includeTables = make([]utils.Relation, 0)
+	for _, table := range inclTables {
+		includeTables = append(includeTables, utils.RelationFromString(table))
+	}
+	excludeTables = make([]utils.Relation, 0)
+	for _, table := range exclTables {
+		excludeTables = append(excludeTables, utils.RelationFromString(table))
+	}
+}
+
+func FiltersAreSet() bool {
+	return len(includeSchemas) > 0 || len(excludeSchemas) > 0 || len(includeTables) > 0 || len(excludeTables) > 0
+}
+
+func schemaInList(schema string, schemas []utils.Schema) bool {
+	for _, listSchema := range schemas {
+		if listSchema.SchemaName == schema {
+			return true
+		}
+	}
+	return false
+}
+
+func relationInList(schema string, name string, relations []utils.Relation) bool {
+	for _, listRelation := range relations {
+		if listRelation.SchemaName == schema && listRelation.RelationName == name {
+			return true
+		}
+	}
+	return false
+}
+
+func SchemaIsIncluded(schema string) bool {
+	if len(includeSchemas) > 0 && !schemaInList(schema, includeSchemas) {
+		return false
+	}
+	return !schemaInList(schema, excludeSchemas)
+}
+
+func RelationIsIncluded(schema string, name string) bool {
+	if !SchemaIsIncluded(schema) {
+		return false
+	}
+	if len(includeTables) > 0 && !relationInList(schema, name, includeTables) {
+		return false
+	}
+	return !relationInList(schema, name, excludeTables)
+}
+
+/*
+ * Objects that belong to a table are restored along with that table, and
+ * objects without a schema, such as languages and casts, are only restored
+ * when no schemas or tables are specifically included.  The session GUCs are
+ * always restored, since the other statements in each file depend on them.
+ */
+func MetadataEntryIsIncluded(entry utils.MetadataEntry) bool {
+	if entry.ObjectType == "SESSION GUCS" {
+		return true
+	}
+	if entry.ReferenceObject != "" {
+		table := utils.RelationFromString(entry.ReferenceObject)
+		return RelationIsIncluded(table.SchemaName, table.RelationName)
+	}
+	switch entry.ObjectType {
+	case "SCHEMA":
+		if !SchemaIsIncluded(entry.Schema) {
+			return false
+		}
+		if len(includeTables) == 0 {
+			return true
+		}
+		for _, table := range includeTables {
+			if table.SchemaName == entry.Schema {
+				return true
+			}
+		}
+		return false
+	case "TABLE", "VIEW", "SEQUENCE":
+		return RelationIsIncluded(entry.Schema, entry.Name)
+	}
+	if len(includeTables) > 0 {
+		return false
+	}
+	if entry.Schema == "" {
+		return len(includeSchemas) == 0
+	}
+	return SchemaIsIncluded(entry.Schema)
+}
+
+func FilterMetadataEntries(entries []utils.MetadataEntry) []utils.MetadataEntry {
+	filteredEntries := make([]utils.MetadataEntry, 0)
+	for _, entry := range entries {
+		if MetadataEntryIsIncluded(entry) {
+			filteredEntries = append(filteredEntries, entry)
+		}
+	}
+	return filteredEntries
+}
+
+func FilterTableMapEntries(entries []TableMapEntry) []TableMapEntry {
+	filteredEntries := make([]TableMapEntry, 0)
+	for _, entry := range entries {
+		if RelationIsIncluded(entry.SchemaName, entry.RelationName) {
+			filteredEntries = append(filteredEntries, entry)
+		}
+	}
+	return filteredEntries
+}
+
+/*
+ * When restoring into an existing database, the schemas of the objects being
+ * restored will often still exist, so their CREATE SCHEMA statements are skipped.
+ */
+func GetExistingSchemas(connection *utils.DBConn) map[string]bool {
+	results := make([]struct{ String string }, 0)
+	err := connection.Select(&results, "SELECT nspname AS string FROM pg_namespace;")
+	utils.CheckError(err)
+	schemas := make(map[string]bool, 0)
+	for _, result := range results {
+		schemas[result.String] = true
+	}
+	return schemas
+}
+
+func RemoveExistingSchemaEntries(entries []utils.MetadataEntry, existingSchemas map[string]bool) []utils.MetadataEntry {
+	filteredEntries := make([]utils.MetadataEntry, 0)
+	for _, entry := range entries {
+		if entry.ObjectType == "SCHEMA" && existingSchemas[entry.Schema] {
+			logger.Verbose("Schema %s already exists, skipping its creation", utils.QuoteIdent(entry.Schema))
+			continue
+		}
+		filteredEntries = append(filteredEntries, entry)
+	}
+	return filteredEntries
+}
+
+/*
+ * Runs the statements for each of the given entries from the metadata file in
+ * order, stopping at the first object that can't be restored.
+ */
+func ExecuteMetadataEntries(connection *utils.DBConn, filename string, entries []utils.MetadataEntry) {
+	ExecuteStatements(connection, entries, utils.GetMetadataStatements(filename, entries))
+}
+
+func ExecuteStatements(connection *utils.DBConn, entries []utils.MetadataEntry, statements []string) {
+	for i, statement := range statements {
+		_, err := connection.Exec(statement)
+		if err != nil {
+			entry := entries[i]
+			objectName := entry.Name
+			if entry.Schema != "" && entry.ObjectType != "SCHEMA" {
+				objectName = fmt.Sprintf("%s.%s", entry.Schema, entry.Name)
+			}
+			logger.Fatal(errors.Errorf("Unable to restore %s %s: %v", entry.ObjectType, objectName, err), "")
+		}
+	}
+}
+
+/*
+ * The statements for the database itself in the global file name the database
+ * that was backed up, so when restoring into a different database they are
+ * rewritten to name that database instead.  The name of the original database
+ * is the Name of each such entry, and it always directly follows the keywords
+ * that start the statement, so only the name in that position is replaced and
+ * any other text, such as the body of a comment, is left as it is.
+ */
+func RedirectDatabaseStatements(entries []utils.MetadataEntry, statements []string, newDBName string) []string {
+	statementPrefixes := map[string]string{
+		"DATABASE":         "CREATE DATABASE ",
+		"DATABASE OWNER":   "ALTER DATABASE ",
+		"DATABASE GUC":     "ALTER DATABASE ",
+		"DATABASE COMMENT": "COMMENT ON DATABASE ",
+	}
+	redirectedStatements := make([]string, len(statements))
+	for i, statement := range statements {
+		entry := entries[i]
+		if prefix, ok := statementPrefixes[entry.ObjectType]; ok {
+			body := strings.TrimLeft(statement, "\n")
+			leadingNewlines := statement[:len(statement)-len(body)]
+			oldStart := prefix + utils.QuoteIdent(entry.Name)
+			if strings.HasPrefix(body, oldStart) {
+				statement = leadingNewlines + prefix + utils.QuoteIdent(newDBName) + body[len(oldStart):]
+			}
+		}
+		redirectedStatements[i] = statement
+	}
+	return redirectedStatements
+}
+
+/*
+ * Returns the entries for creating the database itself, along with setting
+ * its owner, GUCs, and comment, without any of the roles or resource queues
+ * in the global metadata.
+ */
+func GetCreateDatabaseEntries(entries []utils.MetadataEntry) []utils.MetadataEntry {
+	databaseEntries := make([]utils.MetadataEntry, 0)
+	for _, entry := range entries {
+		switch entry.ObjectType {
+		case "DATABASE", "DATABASE OWNER", "DATABASE GUC", "DATABASE COMMENT":
+			databaseEntries = append(databaseEntries, entry)
+		}
+	}
+	return databaseEntries
+}
+
+func DatabaseExists(connection *utils.DBConn, dbname string) bool {
+	results := make([]struct{ Count int }, 0)
+	query := fmt.Sprintf("SELECT count(*) AS count FROM pg_database WHERE datname = %s;", utils.QuoteLiteral(dbname))
+	err := connection.Select(&results, query)
+	utils.CheckError(err)
+	return len(results) > 0 && results[0].Count > 0
+}
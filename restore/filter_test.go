@@ -0,0 +1,194 @@
+package restore_test
+
+import (
+	"errors"
+	"os"
+
+	"github.com/greenplum-db/gpbackup/restore"
+	"github.com/greenplum-db/gpbackup/testutils"
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+var _ = Describe("restore/filter tests", func() {
+	var connection *utils.DBConn
+	var mock sqlmock.Sqlmock
+	var logfile *gbytes.Buffer
+	gucs := utils.MetadataEntry{"", "", "SESSION GUCS", "", 0, 10}
+	schema := utils.MetadataEntry{"schema1", "schema1", "SCHEMA", "", 10, 20}
+	otherSchema := utils.MetadataEntry{"schema2", "schema2", "SCHEMA", "", 20, 30}
+	language := utils.MetadataEntry{"", "plpythonu", "PROCEDURAL LANGUAGE", "", 30, 40}
+	function := utils.MetadataEntry{"schema1", "func(integer)", "FUNCTION", "", 40, 50}
+	table := utils.MetadataEntry{"schema1", "table1", "TABLE", "", 50, 60}
+	otherTable := utils.MetadataEntry{"schema1", "table2", "TABLE", "", 60, 70}
+	constraint := utils.MetadataEntry{"schema1", "table1_pkey", "CONSTRAINT", "schema1.table1", 70, 80}
+	sequence := utils.MetadataEntry{"schema1", "table1_i_seq", "SEQUENCE", "schema1.table1", 80, 90}
+	otherIndex := utils.MetadataEntry{"schema1", "table2_idx", "INDEX", "schema1.table2", 90, 100}
+	view := utils.MetadataEntry{"schema2", "view1", "VIEW", "", 100, 110}
+	allEntries := []utils.MetadataEntry{gucs, schema, otherSchema, language, function, table, otherTable, constraint, sequence, otherIndex, view}
+
+	BeforeEach(func() {
+		connection, mock = testutils.CreateAndConnectMockDB()
+		var testLogger *utils.Logger
+		testLogger, _, _, logfile = testutils.SetupTestLogger()
+		restore.SetLogger(testLogger)
+	})
+	AfterEach(func() {
+		restore.SetFilters([]string{}, []string{}, []string{}, []string{})
+	})
+	Describe("FiltersAreSet", func() {
+		It("returns false if no filters are set", func() {
+			Expect(restore.FiltersAreSet()).To(BeFalse())
+		})
+		It("returns true if any filter is set", func() {
+			restore.SetFilters([]string{}, []string{}, []string{}, []string{"schema1.table1"})
+			Expect(restore.FiltersAreSet()).To(BeTrue())
+		})
+	})
+	Describe("FilterMetadataEntries", func() {
+		It("keeps all entries if no filters are set", func() {
+			Expect(restore.FilterMetadataEntries(allEntries)).To(Equal(allEntries))
+		})
+		It("keeps a table, its schema, and the objects that belong to it when the table is included", func() {
+			restore.SetFilters([]string{}, []string{}, []string{"schema1.table1"}, []string{})
+			Expect(restore.FilterMetadataEntries(allEntries)).To(Equal([]utils.MetadataEntry{gucs, schema, table, constraint, sequence}))
+		})
+		It("keeps all objects in a schema and objects without a schema when the other schema is excluded", func() {
+			restore.SetFilters([]string{}, []string{"schema2"}, []string{}, []string{})
+			Expect(restore.FilterMetadataEntries(allEntries)).To(Equal([]utils.MetadataEntry{gucs, schema, language, function, table, otherTable, constraint, sequence, otherIndex}))
+		})
+		It("keeps only the objects in a schema when the schema is included", func() {
+			restore.SetFilters([]string{"schema2"}, []string{}, []string{}, []string{})
+			Expect(restore.FilterMetadataEntries(allEntries)).To(Equal([]utils.MetadataEntry{gucs, otherSchema, view}))
+		})
+		It("removes a table and the objects that belong to it when the table is excluded", func() {
+			restore.SetFilters([]string{}, []string{}, []string{}, []string{"schema1.table2"})
+			Expect(restore.FilterMetadataEntries(allEntries)).To(Equal([]utils.MetadataEntry{gucs, schema, otherSchema, language, function, table, constraint, sequence, view}))
+		})
+	})
+	Describe("FilterTableMapEntries", func() {
+		It("keeps only the tables that pass the filters", func() {
+			entries := []restore.TableMapEntry{
+				{Relation: utils.BasicRelation("schema1", "table1")},
+				{Relation: utils.BasicRelation("schema1", "table2")},
+				{Relation: utils.BasicRelation("schema2", "table1")},
+			}
+			restore.SetFilters([]string{"schema1"}, []string{}, []string{}, []string{"schema1.table2"})
+			filteredEntries := restore.FilterTableMapEntries(entries)
+			Expect(len(filteredEntries)).To(Equal(1))
+			Expect(filteredEntries[0].ToString()).To(Equal("schema1.table1"))
+		})
+	})
+	Describe("GetExistingSchemas", func() {
+		It("returns the schemas in the database", func() {
+			mock.ExpectQuery("SELECT nspname AS string FROM pg_namespace").WillReturnRows(sqlmock.NewRows([]string{"string"}).AddRow("public").AddRow("schema1"))
+			Expect(restore.GetExistingSchemas(connection)).To(Equal(map[string]bool{"public": true, "schema1": true}))
+		})
+	})
+	Describe("RemoveExistingSchemaEntries", func() {
+		It("removes the entries for schemas that already exist", func() {
+			entries := restore.RemoveExistingSchemaEntries([]utils.MetadataEntry{gucs, schema, otherSchema, table}, map[string]bool{"schema1": true})
+			Expect(entries).To(Equal([]utils.MetadataEntry{gucs, otherSchema, table}))
+			Expect(logfile).To(gbytes.Say("Schema schema1 already exists, skipping its creation"))
+		})
+	})
+	Describe("ExecuteMetadataEntries", func() {
+		BeforeEach(func() {
+			r, w, _ := os.Pipe()
+			w.WriteString("CREATE SCHEMA schema1;CREATE TABLE schema1.table1 (i int);")
+			w.Close()
+			utils.System.OpenFile = func(name string, flag int, perm os.FileMode) (*os.File, error) { return r, nil }
+		})
+		AfterEach(func() {
+			utils.System.OpenFile = os.OpenFile
+		})
+		entries := []utils.MetadataEntry{{"schema1", "schema1", "SCHEMA", "", 0, 22}, {"schema1", "table1", "TABLE", "", 22, 58}}
+
+		It("runs the statements for each entry in order", func() {
+			mock.ExpectExec("CREATE SCHEMA schema1;").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(`CREATE TABLE schema1.table1 \(i int\);`).WillReturnResult(sqlmock.NewResult(0, 0))
+			restore.ExecuteMetadataEntries(connection, "predata.sql", entries)
+			Expect(mock.ExpectationsWereMet()).To(Succeed())
+		})
+		It("panics with the name of the object that could not be restored", func() {
+			mock.ExpectExec("CREATE SCHEMA schema1;").WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec("CREATE TABLE").WillReturnError(errors.New(`relation "table1" already exists`))
+			defer testutils.ShouldPanicWithMessage(`Unable to restore TABLE schema1.table1: relation "table1" already exists`)
+			restore.ExecuteMetadataEntries(connection, "predata.sql", entries)
+		})
+	})
+	Describe("RedirectDatabaseStatements", func() {
+		It("replaces the name of the backed-up database in database statements", func() {
+			entries := []utils.MetadataEntry{
+				{"", "testdb", "DATABASE", "", 0, 0},
+				{"", "testdb", "DATABASE OWNER", "", 0, 0},
+				{"", "testdb", "DATABASE GUC", "", 0, 0},
+				{"", "testdb", "DATABASE COMMENT", "", 0, 0},
+			}
+			statements := []string{
+				"\n\nCREATE DATABASE testdb;",
+				"\nALTER DATABASE testdb OWNER TO testdb;",
+				"\nALTER DATABASE testdb SET default_with_oids TO 'true';",
+				"\nCOMMENT ON DATABASE testdb IS 'This is a comment on testdb.';\n",
+			}
+			redirected := restore.RedirectDatabaseStatements(entries, statements, "Test DB")
+			Expect(redirected).To(Equal([]string{
+				"\n\nCREATE DATABASE \"Test DB\";",
+				"\nALTER DATABASE \"Test DB\" OWNER TO testdb;",
+				"\nALTER DATABASE \"Test DB\" SET default_with_oids TO 'true';",
+				"\nCOMMENT ON DATABASE \"Test DB\" IS 'This is a comment on testdb.';\n",
+			}))
+		})
+		It("does not replace the name of the backed-up database elsewhere in a statement", func() {
+			entries := []utils.MetadataEntry{
+				{"", "testdb", "DATABASE GUC", "", 0, 0},
+				{"", "testdb", "DATABASE COMMENT", "", 0, 0},
+			}
+			statements := []string{
+				"\nALTER DATABASE testdb SET search_path TO 'DATABASE testdb ';",
+				"\nCOMMENT ON DATABASE testdb IS 'Restored from DATABASE testdb ; see DATABASE testdb;';\n",
+			}
+			redirected := restore.RedirectDatabaseStatements(entries, statements, "newdb")
+			Expect(redirected).To(Equal([]string{
+				"\nALTER DATABASE newdb SET search_path TO 'DATABASE testdb ';",
+				"\nCOMMENT ON DATABASE newdb IS 'Restored from DATABASE testdb ; see DATABASE testdb;';\n",
+			}))
+		})
+		It("does not change statements for other objects", func() {
+			entries := []utils.MetadataEntry{{"", "testdb", "ROLE", "", 0, 0}}
+			statements := []string{"\n\nCREATE ROLE testdb;\n\nALTER ROLE testdb WITH NOSUPERUSER;"}
+			Expect(restore.RedirectDatabaseStatements(entries, statements, "newdb")).To(Equal(statements))
+		})
+	})
+	Describe("GetCreateDatabaseEntries", func() {
+		It("returns only the entries for the database itself", func() {
+			database := utils.MetadataEntry{"", "testdb", "DATABASE", "", 0, 10}
+			owner := utils.MetadataEntry{"", "testdb", "DATABASE OWNER", "", 10, 20}
+			guc := utils.MetadataEntry{"", "testdb", "DATABASE GUC", "", 20, 30}
+			comment := utils.MetadataEntry{"", "testdb", "DATABASE COMMENT", "", 30, 40}
+			role := utils.MetadataEntry{"", "testrole", "ROLE", "", 40, 50}
+			queue := utils.MetadataEntry{"", "testqueue", "RESOURCE QUEUE", "", 50, 60}
+			entries := []utils.MetadataEntry{gucs, database, owner, guc, comment, queue, role}
+			Expect(restore.GetCreateDatabaseEntries(entries)).To(Equal([]utils.MetadataEntry{database, owner, guc, comment}))
+		})
+	})
+	Describe("DatabaseExists", func() {
+		It("returns true if the database exists", func() {
+			mock.ExpectQuery(`SELECT count\(\*\) AS count FROM pg_database WHERE datname = E'testdb'`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+			Expect(restore.DatabaseExists(connection, "testdb")).To(BeTrue())
+		})
+		It("returns false if the database does not exist", func() {
+			mock.ExpectQuery(`SELECT count\(\*\) AS count FROM pg_database WHERE datname = E'testdb'`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+			Expect(restore.DatabaseExists(connection, "testdb")).To(BeFalse())
+		})
+		It("escapes quotes and backslashes in the database name", func() {
+			mock.ExpectQuery(`SELECT count\(\*\) AS count FROM pg_database WHERE datname = E'test''db\\\\; DROP DATABASE postgres; --'`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+			Expect(restore.DatabaseExists(connection, `test'db\; DROP DATABASE postgres; --`)).To(BeFalse())
+			Expect(mock.ExpectationsWereMet()).To(Succeed())
+		})
+	})
+})
@@ -0,0 +1,139 @@
+package restore
+
+/*
+ * This file contains structs and functions related to listing the objects in
+ * a backup and restoring only the objects selected from such a list, in the
+ * manner of pg_restore's --list and --use-list options.
+ */
+
+import (
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/greenplum-db/gpbackup/utils"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	SECTION_GLOBAL   = "global"
+	SECTION_PREDATA  = "predata"
+	SECTION_DATA     = "data"
+	SECTION_POSTDATA = "postdata"
+)
+
+/*
+ * Each object in the TOC and each table in the table map is given an ID by its
+ * position in the backup, so the IDs are the same every time a backup is listed.
+ * Table is only set for entries in the data section.
+ */
+type ListEntry struct {
+	ID      int
+	Section string
+	utils.MetadataEntry
+	Table TableMapEntry
+}
+
+func GetListEntries(toc *utils.TOC, tables []TableMapEntry) []ListEntry {
+	listEntries := make([]ListEntry, 0)
+	addEntries := func(section string, entries []utils.MetadataEntry) {
+		for _, entry := range entries {
+			listEntries = append(listEntries, ListEntry{ID: len(listEntries) + 1, Section: section, MetadataEntry: entry})
+		}
+	}
+	addEntries(SECTION_GLOBAL, toc.GlobalEntries)
+	addEntries(SECTION_PREDATA, toc.PredataEntries)
+	for _, table := range tables {
+		dataEntry := utils.MetadataEntry{Schema: table.SchemaName, Name: table.RelationName, ObjectType: "TABLE DATA"}
+		listEntries = append(listEntries, ListEntry{ID: len(listEntries) + 1, Section: SECTION_DATA, MetadataEntry: dataEntry, Table: table})
+	}
+	addEntries(SECTION_POSTDATA, toc.PostdataEntries)
+	return listEntries
+}
+
+/*
+ * Lines beginning with a semicolon are comments, so entries can be excluded
+ * from a restore by commenting them out of the list as well as by deleting them.
+ * The row count of each table, keyed by FQN, is printed after its size if it is
+ * known; backups taken before row counts were recorded have none.
+ */
+func PrintList(listFile io.Writer, listEntries []ListEntry, rowCounts map[string]int64) {
+	utils.MustPrintf(listFile, ";\n; Backup timestamp: %s\n;\n; Selected TOC entries:\n", utils.DumpTimestamp)
+	sectionHeaders := map[string]string{
+		SECTION_GLOBAL:   "Global metadata",
+		SECTION_PREDATA:  "Pre-data metadata",
+		SECTION_DATA:     "Table data",
+		SECTION_POSTDATA: "Post-data metadata",
+	}
+	currentSection := ""
+	for _, entry := range listEntries {
+		if entry.Section != currentSection {
+			currentSection = entry.Section
+			utils.MustPrintf(listFile, ";\n; %s\n;\n", sectionHeaders[currentSection])
+		}
+		schema := entry.Schema
+		if schema == "" {
+			schema = "-"
+		}
+		name := entry.Name
+		if name == "" {
+			name = "-"
+		}
+		utils.MustPrintf(listFile, "%d; %s %s %s", entry.ID, entry.ObjectType, schema, name)
+		if entry.Section == SECTION_DATA {
+			utils.MustPrintf(listFile, " %d bytes", entry.Table.Size)
+			if rowCount, ok := rowCounts[entry.Table.ToString()]; ok {
+				utils.MustPrintf(listFile, " %d rows", rowCount)
+			}
+		}
+		utils.MustPrintln(listFile)
+	}
+}
+
+/*
+ * Returns the IDs of the entries in a list file written by PrintList, which
+ * may have been edited to remove entries or to comment them out.
+ */
+func ReadUseListFile(filename string) map[int]bool {
+	ids := make(map[int]bool, 0)
+	for _, line := range utils.ReadLinesFromFile(filename) {
+		if strings.HasPrefix(line, ";") {
+			continue
+		}
+		delimIndex := strings.Index(line, ";")
+		if delimIndex == -1 {
+			logger.Fatal(errors.Errorf("Invalid line in list file %s: %s", filename, line), "")
+		}
+		id, err := strconv.Atoi(strings.TrimSpace(line[:delimIndex]))
+		if err != nil {
+			logger.Fatal(errors.Errorf("Invalid ID in list file %s line: %s", filename, line), "")
+		}
+		ids[id] = true
+	}
+	return ids
+}
+
+/*
+ * Returns a TOC and table map containing only the entries with the given IDs.
+ */
+func FilterByList(listEntries []ListEntry, ids map[int]bool) (*utils.TOC, []TableMapEntry) {
+	toc := &utils.TOC{}
+	tables := make([]TableMapEntry, 0)
+	for _, entry := range listEntries {
+		if !ids[entry.ID] {
+			continue
+		}
+		switch entry.Section {
+		case SECTION_GLOBAL:
+			toc.GlobalEntries = append(toc.GlobalEntries, entry.MetadataEntry)
+		case SECTION_PREDATA:
+			toc.PredataEntries = append(toc.PredataEntries, entry.MetadataEntry)
+		case SECTION_DATA:
+			tables = append(tables, entry.Table)
+		case SECTION_POSTDATA:
+			toc.PostdataEntries = append(toc.PostdataEntries, entry.MetadataEntry)
+		}
+	}
+	return toc, tables
+}
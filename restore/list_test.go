@@ -0,0 +1,117 @@
+package restore_test
+
+import (
+	"os"
+
+	"github.com/greenplum-db/gpbackup/restore"
+	"github.com/greenplum-db/gpbackup/testutils"
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("restore/list tests", func() {
+	role := utils.MetadataEntry{"", "testrole", "ROLE", "", 0, 10}
+	schema := utils.MetadataEntry{"schema1", "schema1", "SCHEMA", "", 0, 10}
+	table := utils.MetadataEntry{"schema1", "table1", "TABLE", "", 10, 20}
+	index := utils.MetadataEntry{"schema1", "table1_idx", "INDEX", "schema1.table1", 0, 10}
+	toc := &utils.TOC{GlobalEntries: []utils.MetadataEntry{role}, PredataEntries: []utils.MetadataEntry{schema, table}, PostdataEntries: []utils.MetadataEntry{index}}
+	tableData := restore.TableMapEntry{Relation: utils.BasicRelation("schema1", "table1"), Size: 8192}
+	tables := []restore.TableMapEntry{tableData}
+
+	BeforeEach(func() {
+		testLogger, _, _, _ := testutils.SetupTestLogger()
+		restore.SetLogger(testLogger)
+		utils.SetDumpTimestamp("20170101010101")
+	})
+	Describe("GetListEntries", func() {
+		It("numbers the entries in global, pre-data, data, and post-data order", func() {
+			listEntries := restore.GetListEntries(toc, tables)
+			Expect(len(listEntries)).To(Equal(5))
+			Expect(listEntries[0]).To(Equal(restore.ListEntry{ID: 1, Section: restore.SECTION_GLOBAL, MetadataEntry: role}))
+			Expect(listEntries[1]).To(Equal(restore.ListEntry{ID: 2, Section: restore.SECTION_PREDATA, MetadataEntry: schema}))
+			Expect(listEntries[2]).To(Equal(restore.ListEntry{ID: 3, Section: restore.SECTION_PREDATA, MetadataEntry: table}))
+			Expect(listEntries[3].ID).To(Equal(4))
+			Expect(listEntries[3].Section).To(Equal(restore.SECTION_DATA))
+			Expect(listEntries[3].MetadataEntry).To(Equal(utils.MetadataEntry{Schema: "schema1", Name: "table1", ObjectType: "TABLE DATA"}))
+			Expect(listEntries[3].Table).To(Equal(tableData))
+			Expect(listEntries[4]).To(Equal(restore.ListEntry{ID: 5, Section: restore.SECTION_POSTDATA, MetadataEntry: index}))
+		})
+	})
+	Describe("PrintList", func() {
+		It("prints each entry with its ID and the size and row count of each table's data", func() {
+			buffer := gbytes.NewBuffer()
+			restore.PrintList(buffer, restore.GetListEntries(toc, tables), map[string]int64{"schema1.table1": 100})
+			testutils.ExpectRegexp(buffer, `;
+; Backup timestamp: 20170101010101
+;
+; Selected TOC entries:
+;
+; Global metadata
+;
+1; ROLE - testrole
+;
+; Pre-data metadata
+;
+2; SCHEMA schema1 schema1
+3; TABLE schema1 table1
+;
+; Table data
+;
+4; TABLE DATA schema1 table1 8192 bytes 100 rows
+;
+; Post-data metadata
+;
+5; INDEX schema1 table1_idx
+`)
+		})
+		It("prints no row counts for backups without a row count file", func() {
+			buffer := gbytes.NewBuffer()
+			restore.PrintList(buffer, restore.GetListEntries(toc, tables), map[string]int64{})
+			testutils.ExpectRegexp(buffer, "4; TABLE DATA schema1 table1 8192 bytes\n")
+		})
+	})
+	Describe("ReadUseListFile", func() {
+		mockListFile := func(contents string) {
+			r, w, _ := os.Pipe()
+			w.WriteString(contents)
+			w.Close()
+			utils.System.OpenFile = func(name string, flag int, perm os.FileMode) (*os.File, error) { return r, nil }
+		}
+		AfterEach(func() {
+			utils.System.OpenFile = os.OpenFile
+		})
+
+		It("reads the IDs of the entries, skipping comments and blank lines", func() {
+			mockListFile(";\n; Pre-data metadata\n;\n2; SCHEMA schema1 schema1\n;3; TABLE schema1 table1\n\n4; TABLE DATA schema1 table1 8192 bytes\n")
+			Expect(restore.ReadUseListFile("list_file")).To(Equal(map[int]bool{2: true, 4: true}))
+		})
+		It("panics if a line has no ID", func() {
+			mockListFile("SCHEMA schema1 schema1\n")
+			defer testutils.ShouldPanicWithMessage("Invalid line in list file list_file: SCHEMA schema1 schema1")
+			restore.ReadUseListFile("list_file")
+		})
+		It("panics if a line has an invalid ID", func() {
+			mockListFile("two; SCHEMA schema1 schema1\n")
+			defer testutils.ShouldPanicWithMessage("Invalid ID in list file list_file line: two; SCHEMA schema1 schema1")
+			restore.ReadUseListFile("list_file")
+		})
+	})
+	Describe("FilterByList", func() {
+		It("returns only the selected entries and tables", func() {
+			resultTOC, resultTables := restore.FilterByList(restore.GetListEntries(toc, tables), map[int]bool{1: true, 3: true, 4: true})
+			Expect(resultTOC.GlobalEntries).To(Equal([]utils.MetadataEntry{role}))
+			Expect(resultTOC.PredataEntries).To(Equal([]utils.MetadataEntry{table}))
+			Expect(resultTOC.PostdataEntries).To(BeEmpty())
+			Expect(resultTables).To(Equal(tables))
+		})
+		It("returns no tables if no data entries are selected", func() {
+			resultTOC, resultTables := restore.FilterByList(restore.GetListEntries(toc, tables), map[int]bool{5: true})
+			Expect(resultTOC.PredataEntries).To(BeEmpty())
+			Expect(resultTOC.PostdataEntries).To(Equal([]utils.MetadataEntry{index}))
+			Expect(resultTables).To(BeEmpty())
+		})
+	})
+})
@@ -1,8 +1,12 @@
 package restore
 
 import (
+	"bufio"
+	"bytes"
 	"flag"
 	"fmt"
+	"os"
+	"strings"
 
 	"github.com/greenplum-db/gpbackup/utils"
 
@@ -12,20 +16,79 @@ import (
 var (
 	connection *utils.DBConn
 	logger     *utils.Logger
+	exitCode   = EXIT_SUCCESS
+)
+
+/*
+ * Exit codes below 3 are the overall status of the run, shared with gpbackup;
+ * the data restore codes let callers tell a partial data load apart from other
+ * failures.
+ */
+const (
+	EXIT_SUCCESS        = utils.EXIT_SUCCESS
+	EXIT_FATAL          = utils.EXIT_FATAL
+	EXIT_WARNINGS       = utils.EXIT_WARNINGS
+	EXIT_TABLES_FAILED  = 3
+	EXIT_TABLES_SKIPPED = 4
 )
 
 var ( // Command-line flags
-	debug          = flag.Bool("debug", false, "Print verbose and debug log messages")
-	dumpDir        = flag.String("dumpdir", "", "The directory in which the dump files to be restored are located")
-	quiet          = flag.Bool("quiet", false, "Suppress non-warning, non-error log messages")
-	timestamp      = flag.String("timestamp", "", "The timestamp to be restored, in the format YYYYMMDDHHMMSS")
-	verbose        = flag.Bool("verbose", false, "Print verbose log messages")
-	restoreGlobals = flag.Bool("globals", false, "Restore global metadata")
+	createDB                *bool
+	debug                   *bool
+	dumpDir                 *string
+	encryptionKeyFile       *string
+	encryptionPassphraseEnv *string
+	excludeSchema           *utils.ArrayFlags
+	excludeTable            *utils.ArrayFlags
+	includeSchema           *utils.ArrayFlags
+	includeTable            *utils.ArrayFlags
+	list                    *bool
+	numJobs                 *int
+	onErrorContinue         *bool
+	pluginConfigFile        *string
+	quiet                   *bool
+	redirectDB              *string
+	timestamp               *string
+	useList                 *string
+	verbose                 *bool
+	restoreGlobals          *bool
 )
 
+/*
+ * Flags are registered here instead of at package initialization so that the
+ * backup and restore packages can be linked into the same test binary without
+ * their flags conflicting.
+ */
+func initializeFlags() {
+	createDB = flag.Bool("create-db", false, "Create the database being restored into, with the owner, encoding, settings, and comment of the database that was backed up")
+	debug = flag.Bool("debug", false, "Print verbose and debug log messages")
+	dumpDir = flag.String("dumpdir", "", "The directory in which the dump files to be restored are located")
+	encryptionKeyFile = flag.String("encryption-key-file", "", "A file containing the key an encrypted backup was encrypted with.  The file must exist at the same path on every host in the cluster.")
+	encryptionPassphraseEnv = flag.String("encryption-passphrase-env", "", "The name of an environment variable containing the passphrase an encrypted backup was encrypted with.  The variable must also be set in the environment of the segments.")
+	excludeSchema = &utils.ArrayFlags{}
+	flag.Var(excludeSchema, "exclude-schema", "Restore all metadata and data except objects in the specified schema.  This flag can be specified multiple times.")
+	excludeTable = &utils.ArrayFlags{}
+	flag.Var(excludeTable, "exclude-table", "Restore all metadata and data except the specified table, in schema.table format.  This flag can be specified multiple times.")
+	includeSchema = &utils.ArrayFlags{}
+	flag.Var(includeSchema, "include-schema", "Restore only the objects in the specified schema.  This flag can be specified multiple times.")
+	includeTable = &utils.ArrayFlags{}
+	flag.Var(includeTable, "include-table", "Restore only the specified table, in schema.table format, and the objects that belong to it.  This flag can be specified multiple times.")
+	list = flag.Bool("list", false, "Print a list of the objects in the backup, which can be edited and passed to --use-list, instead of restoring it")
+	numJobs = flag.Int("jobs", 1, "The number of parallel connections to use when restoring table data")
+	onErrorContinue = flag.Bool("on-error-continue", false, "Continue restoring data into the remaining tables if data for a table fails to restore")
+	pluginConfigFile = flag.String("plugin-config", "", "The config file of the storage plugin the backup was sent to, from which the backup files will be retrieved.  The file must exist at the same path on every host in the cluster.")
+	quiet = flag.Bool("quiet", false, "Suppress non-warning, non-error log messages")
+	redirectDB = flag.String("redirect-db", "", "Restore into the specified database instead of the database that was backed up")
+	timestamp = flag.String("timestamp", "", "The timestamp to be restored, in the format YYYYMMDDHHMMSS")
+	useList = flag.String("use-list", "", "Restore only the objects in the specified file, which contains an edited copy of the output of --list")
+	verbose = flag.Bool("verbose", false, "Print verbose log messages")
+	restoreGlobals = flag.Bool("globals", false, "Restore global metadata")
+}
+
 // This function handles setup that can be done before parsing flags.
 func DoInit() {
 	SetLogger(utils.InitializeLogging("gprestore", ""))
+	initializeFlags()
 }
 
 func SetLogger(log *utils.Logger) {
@@ -39,10 +102,17 @@ func SetLogger(log *utils.Logger) {
 func DoValidation() {
 	flag.Parse()
 	utils.CheckExclusiveFlags("debug", "quiet", "verbose")
+	utils.CheckExclusiveFlags("list", "use-list")
+	utils.CheckExclusiveFlags("create-db", "globals")
+	utils.CheckExclusiveFlags("encryption-key-file", "encryption-passphrase-env")
 	utils.CheckMandatoryFlags("timestamp")
+	if *numJobs < 1 {
+		logger.Fatal(errors.Errorf("Flag jobs must be at least 1"), "")
+	}
 	if !utils.IsValidTimestamp(*timestamp) {
 		logger.Fatal(errors.Errorf("Timestamp %s is invalid.  Timestamps must be in the format YYYYMMDDHHMMSS.", *timestamp), "")
 	}
+	SetFilters(*includeSchema, *excludeSchema, *includeTable, *excludeTable)
 }
 
 // This function handles setup that must be done after parsing flags.
@@ -57,6 +127,8 @@ func DoSetup() {
 	connection = utils.NewDBConn("postgres")
 	connection.Connect()
 	connection.Exec("SET application_name TO 'gprestore'")
+	utils.MakeCancellable(connection)
+	utils.HandleSignals("postgres")
 
 	utils.SetDumpTimestamp(*timestamp)
 
@@ -66,59 +138,360 @@ func DoSetup() {
 	logger.Verbose("Gathering information on dump directories")
 	segConfig := utils.GetSegmentConfiguration(connection)
 	utils.SetupSegmentConfiguration(segConfig)
+	if *pluginConfigFile != "" {
+		utils.Plugin = utils.ReadPluginConfig(*pluginConfigFile)
+		utils.Plugin.CheckPluginVersion()
+		logger.Info("Backup files will be retrieved from plugin %s", utils.Plugin.ExecutablePath)
+		utils.Plugin.Execute("setup_plugin_for_restore", utils.GetDirForContent(-1))
+		for _, filename := range []string{utils.GetManifestFilePath(), utils.GetTOCFilePath(), utils.GetTableMapFilePath(), utils.GetRowCountFilePath()} {
+			utils.Plugin.RestoreFile(filename)
+		}
+	}
 }
 
 func DoRestore() {
+	if *list {
+		printBackupList()
+		return
+	}
 	logger.Info("Restore Key = %s", utils.DumpTimestamp)
 
-	utils.AssertDumpDirsExist()
+	// Data files retrieved from a plugin are not on the segments, so only the master directory is needed
+	if utils.Plugin == nil {
+		utils.AssertDumpDirsExist()
+	}
+	manifest := readManifest()
+	if manifest != nil {
+		utils.ValidateManifest(manifest, len(utils.GetContentList())-1)
+		utils.SetCompression(utils.GetCompressionTypeName(manifest.CompressionType, manifest.CompressionLevel), manifest.CompressionLevel)
+		logger.Verbose("Backup data files use compression type %s", utils.Compression.Name)
+		setEncryption(manifest)
+		if manifest.Plugin != "" && utils.Plugin == nil {
+			logger.Fatal(errors.Errorf("Backup %s was sent to plugin %s, so flag plugin-config must be set", utils.DumpTimestamp, manifest.Plugin), "")
+		}
+	}
 
 	masterDumpDir := utils.GetDirForContent(-1)
 	globalFilename := fmt.Sprintf("%s/global.sql", masterDumpDir)
 	predataFilename := fmt.Sprintf("%s/predata.sql", masterDumpDir)
 	postdataFilename := fmt.Sprintf("%s/postdata.sql", masterDumpDir)
+	if utils.Plugin != nil {
+		for _, filename := range []string{globalFilename, predataFilename, postdataFilename} {
+			utils.Plugin.RestoreFile(utils.GetEncryptedFilePath(filename))
+		}
+	}
+
+	restoreDBName := GetDBNameFromFile(predataFilename)
+	if *redirectDB != "" {
+		logger.Info("Redirecting restore from database %s to database %s", restoreDBName, *redirectDB)
+		restoreDBName = *redirectDB
+	}
+
+	tables := readTableMap()
+	var toc *utils.TOC
+	if FiltersAreSet() || *useList != "" || *redirectDB != "" {
+		toc = readTOC()
+	}
+	if *useList != "" {
+		logger.Info("Restoring only the objects listed in %s", *useList)
+		toc, tables = FilterByList(GetListEntries(toc, tables), ReadUseListFile(*useList))
+	}
+	if FiltersAreSet() {
+		tables = FilterTableMapEntries(tables)
+	}
+	validateBaseBackups(tables)
+
+	if *createDB {
+		logger.Info("Creating database %s", restoreDBName)
+		createDatabase(globalFilename, restoreDBName)
+		logger.Info("Database creation complete")
+	}
 
 	if *restoreGlobals {
 		logger.Info("Restoring global database metadata from %s", globalFilename)
-		restoreGlobal(globalFilename)
+		restoreGlobal(globalFilename, toc)
 		logger.Info("Global database metadata restore complete")
 	}
 
 	logger.Info("Restoring pre-data metadata from %s", predataFilename)
-	restorePredata(predataFilename)
+	restorePredata(predataFilename, restoreDBName, toc)
 	logger.Info("Pre-data metadata restore complete")
 
-	//TODO: Restore data
-	//logger.Info("Restoring data")
-	//restoreData(tables)
-	//logger.Info("Data restore complete")
+	logger.Info("Restoring data")
+	if restoreData(restoreDBName, tables) {
+		logger.Info("Data restore complete")
+
+		logger.Info("Restoring post-data metadata from %s", postdataFilename)
+		restorePostdata(postdataFilename, toc)
+		logger.Info("Post-data metadata restore complete")
+	}
+
+	if utils.Plugin != nil {
+		utils.Plugin.Execute("cleanup_plugin_for_restore", utils.GetDirForContent(-1))
+	}
+}
+
+/*
+ * The list is printed to stdout without any log messages so that it can be
+ * redirected to a file, edited, and passed back in with --use-list.
+ */
+func printBackupList() {
+	tables := readTableMap()
+	PrintList(os.Stdout, GetListEntries(readTOC(), tables), readRowCounts(tables, false))
+}
+
+/*
+ * Backups taken before manifests were written don't have one, so those are
+ * restored without being validated and are assumed to be uncompressed.
+ */
+func readManifest() *utils.Manifest {
+	manifestFilename := utils.GetManifestFilePath()
+	if _, err := utils.System.Stat(manifestFilename); err != nil {
+		if utils.System.IsNotExist(err) {
+			logger.Warn("Manifest file %s not found, skipping validation of backup", manifestFilename)
+			return nil
+		}
+		logger.Fatal(err, "Cannot stat manifest file %s", manifestFilename)
+	}
+	logger.Verbose("Reading manifest file %s", manifestFilename)
+	manifest := utils.ReadManifest(manifestFilename)
+	logger.Verbose("Backup was taken of database %s by gpbackup version %s on %s", manifest.DatabaseName, manifest.BackupVersion, manifest.DatabaseVersion)
+	return manifest
+}
+
+/*
+ * Encrypted backup files are decrypted as they are read, so the key must be
+ * given for an encrypted backup.
+ */
+func setEncryption(manifest *utils.Manifest) {
+	keyGiven := *encryptionKeyFile != "" || *encryptionPassphraseEnv != ""
+	if !manifest.Encrypted {
+		if keyGiven {
+			logger.Warn("Backup %s is not encrypted, ignoring encryption key", utils.DumpTimestamp)
+		}
+		return
+	}
+	if !keyGiven {
+		logger.Fatal(errors.Errorf("Backup %s is encrypted, so flag encryption-key-file or encryption-passphrase-env must be set", utils.DumpTimestamp), "")
+	}
+	utils.SetEncryption(*encryptionKeyFile, *encryptionPassphraseEnv)
+	utils.CheckOpenSSLVersion()
+	logger.Verbose("Backup files are encrypted and will be decrypted as they are read")
+}
+
+/*
+ * The data for some tables in an incremental backup is in the data files of
+ * its base backup, so that backup must also be present and complete.
+ */
+func validateBaseBackups(tables []TableMapEntry) {
+	for _, timestamp := range GetBaseTimestamps(tables) {
+		manifestFilename := utils.GetManifestFilePathForTimestamp(timestamp)
+		if utils.Plugin != nil {
+			utils.Plugin.RestoreFile(manifestFilename)
+			utils.Plugin.RestoreFile(utils.GetRowCountFilePathForTimestamp(timestamp))
+		}
+		if _, err := utils.System.Stat(manifestFilename); err != nil {
+			logger.Fatal(errors.Errorf("Backup %s, which contains data for tables in this incremental backup, was not found", timestamp), "")
+		}
+		logger.Info("Restoring data for unchanged tables from backup %s", timestamp)
+		utils.ValidateManifest(utils.ReadManifest(manifestFilename), len(utils.GetContentList())-1)
+	}
+}
+
+func readTableMap() []TableMapEntry {
+	tableMapFilename := utils.GetTableMapFilePath()
+	logger.Verbose("Reading table map file %s", tableMapFilename)
+	return ReadTableMapFile(tableMapFilename)
+}
+
+/*
+ * Returns the number of rows backed up for each table, keyed by FQN, reading
+ * the counts for tables whose data is in a base backup from that backup.
+ * Backups taken before row counts were recorded don't have a row count file,
+ * so their tables are restored without their row counts being checked, and
+ * a warning is logged if warnIfMissing is set.
+ */
+func readRowCounts(tables []TableMapEntry, warnIfMissing bool) map[string]int64 {
+	rowCountsByTimestamp := make(map[string]map[uint32]int64, 0)
+	for _, timestamp := range append([]string{utils.DumpTimestamp}, GetBaseTimestamps(tables)...) {
+		rowCountFilename := utils.GetRowCountFilePathForTimestamp(timestamp)
+		if _, err := utils.System.Stat(rowCountFilename); err != nil {
+			if utils.System.IsNotExist(err) {
+				if warnIfMissing {
+					logger.Warn("Row count file %s not found, skipping row count verification for tables in backup %s", rowCountFilename, timestamp)
+				}
+				continue
+			}
+			logger.Fatal(err, "Cannot stat row count file %s", rowCountFilename)
+		}
+		logger.Verbose("Reading row count file %s", rowCountFilename)
+		rowCountsByTimestamp[timestamp] = ReadRowCountFile(rowCountFilename)
+	}
+	expectedRowCounts := make(map[string]int64, 0)
+	for _, table := range tables {
+		timestamp := table.BaseTimestamp
+		if timestamp == "" {
+			timestamp = utils.DumpTimestamp
+		}
+		if rowCount, ok := rowCountsByTimestamp[timestamp][table.RelationOid]; ok {
+			expectedRowCounts[table.ToString()] = rowCount
+		}
+	}
+	return expectedRowCounts
+}
+
+func readTOC() *utils.TOC {
+	logger.Verbose("Reading table of contents file %s", utils.GetTOCFilePath())
+	return utils.ReadTOC(utils.GetTOCFilePath())
+}
+
+/*
+ * Global objects don't belong to any schema, so the schema and table filters
+ * don't apply to them; only --use-list selects which ones are restored.
+ */
+func restoreGlobal(filename string, toc *utils.TOC) {
+	if toc == nil {
+		utils.ExecuteSQLFile(connection, filename)
+		return
+	}
+	statements := utils.GetMetadataStatements(filename, toc.GlobalEntries)
+	if *redirectDB != "" {
+		statements = RedirectDatabaseStatements(toc.GlobalEntries, statements, *redirectDB)
+	}
+	ExecuteStatements(connection, toc.GlobalEntries, statements)
+}
+
+/*
+ * Only the statements for the database itself are run from the global file, so
+ * that the database can be created without also recreating roles and resource
+ * queues.  The restore stops before changing anything if the database exists.
+ */
+func createDatabase(filename string, dbname string) {
+	if DatabaseExists(connection, dbname) {
+		logger.Fatal(errors.Errorf("Database %s already exists", dbname), "")
+	}
+	entries := GetCreateDatabaseEntries(readTOC().GlobalEntries)
+	statements := utils.GetMetadataStatements(filename, entries)
+	if *redirectDB != "" {
+		statements = RedirectDatabaseStatements(entries, statements, *redirectDB)
+	}
+	ExecuteStatements(connection, entries, statements)
+}
+
+/*
+ * When no filters, list file, or redirect database are given, the metadata
+ * files are run in their entirety and connect to the backed-up database on
+ * their own.  Otherwise, only the statements for the objects that were selected
+ * are taken from the file, using the offsets recorded in the TOC, and run over
+ * a connection to the database being restored into.
+ */
+func restorePredata(filename string, dbname string, toc *utils.TOC) {
+	if toc == nil {
+		utils.ExecuteSQLFile(connection, filename)
+		return
+	}
+	connectToDatabase(dbname)
+	entries := FilterMetadataEntries(toc.PredataEntries)
+	entries = RemoveExistingSchemaEntries(entries, GetExistingSchemas(connection))
+	logger.Verbose("Restoring %d of %d pre-data objects", len(entries), len(toc.PredataEntries))
+	ExecuteMetadataEntries(connection, filename, entries)
+}
+
+/*
+ * The metadata files connect to the backed-up database on their own, but COPY
+ * and statements taken from the metadata files need a connection to the
+ * database being restored into.
+ */
+func connectToDatabase(dbname string) {
+	if connection.DBName == dbname {
+		return
+	}
+	connection.Close()
+	connection = utils.NewDBConn(dbname)
+	connection.Connect()
+	connection.Exec("SET application_name TO 'gprestore'")
+	utils.MakeCancellable(connection)
+}
+
+// Returns false if the data restore stopped partway, so the post-data metadata should not be restored
+func restoreData(dbname string, tables []TableMapEntry) bool {
+	connectToDatabase(dbname)
 
-	logger.Info("Restoring post-data metadata from %s", postdataFilename)
-	restorePostdata(postdataFilename)
-	logger.Info("Post-data metadata restore complete")
+	SortTableMapEntriesBySize(tables)
+
+	dataConns := []*utils.DBConn{connection}
+	if *numJobs > 1 {
+		dataConns = setUpWorkerConnections(dbname)
+		defer closeWorkerConnections(dataConns)
+	}
+	results := CopyAllTablesIn(dataConns, tables, readRowCounts(tables, true), !*onErrorContinue)
+	exitCode = ReportDataRestoreResults(results)
+	if ShouldStopAfterDataRestore(results, !*onErrorContinue) {
+		logger.Error("Data restore stopped with %d of %d tables failed and %d skipped, so post-data metadata was not restored", len(results.Failed), len(tables), len(results.Skipped))
+		return false
+	}
+	return true
 }
 
-func restoreGlobal(filename string) {
-	utils.ExecuteSQLFile(connection, filename)
+func setUpWorkerConnections(dbname string) []*utils.DBConn {
+	logger.Verbose("Opening %d connections to restore data", *numJobs)
+	workerConns := make([]*utils.DBConn, *numJobs)
+	for i := 0; i < *numJobs; i++ {
+		workerConns[i] = utils.NewDBConn(dbname)
+		workerConns[i].Connect()
+		workerConns[i].Exec("SET application_name TO 'gprestore'")
+		utils.MakeCancellable(workerConns[i])
+	}
+	return workerConns
 }
 
-func restorePredata(filename string) {
-	utils.ExecuteSQLFile(connection, filename)
+func closeWorkerConnections(workerConns []*utils.DBConn) {
+	for _, conn := range workerConns {
+		conn.Close()
+	}
 }
 
-func restoreData() {
+func restorePostdata(filename string, toc *utils.TOC) {
+	if toc == nil {
+		utils.ExecuteSQLFile(connection, filename)
+		return
+	}
+	entries := FilterMetadataEntries(toc.PostdataEntries)
+	logger.Verbose("Restoring %d of %d post-data objects", len(entries), len(toc.PostdataEntries))
+	ExecuteMetadataEntries(connection, filename, entries)
 }
 
-func restorePostdata(filename string) {
-	utils.ExecuteSQLFile(connection, filename)
+/*
+ * Each metadata file begins with the "\c dbname" line written by PrintConnectionString
+ * during backup, which records the name of the database that was backed up.
+ */
+func GetDBNameFromFile(filename string) string {
+	reader := bufio.NewReader(bytes.NewReader(utils.ReadMetadataFile(filename)))
+	line, err := reader.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, `\c `) {
+		logger.Fatal(errors.Errorf("Could not determine the database name from %s", filename), "")
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(line, `\c `), "\n")
 }
 
+/*
+ * A run that logged warnings but otherwise succeeded exits with EXIT_WARNINGS,
+ * while the exit codes for failed or skipped tables take precedence over it,
+ * and EXIT_FATAL takes precedence over all of them.
+ */
 func DoTeardown() {
 	if r := recover(); r != nil {
 		fmt.Println(r)
+		if utils.WasSignalReceived() {
+			logger.Error("Restore was cancelled by a signal")
+		}
+		exitCode = EXIT_FATAL
+	}
+	if exitCode == EXIT_SUCCESS && logger != nil && len(logger.GetWarnings()) > 0 {
+		exitCode = EXIT_WARNINGS
 	}
 	if connection != nil {
 		connection.Close()
 	}
-	// TODO: Add logic for error codes based on whether we Abort()ed or not
+	os.Exit(exitCode)
 }
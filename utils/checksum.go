@@ -0,0 +1,108 @@
+package utils
+
+/*
+ * This file contains structs and functions related to the checksum file, which
+ * records a checksum for each file in a backup so that the backup can later be
+ * checked for files that are corrupt or missing.
+ */
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+/*
+ * Checksums are SHA-256 hashes in hexadecimal, as output by sha256sum.  The
+ * metadata files are keyed by their base names in the master dump directory,
+ * and the data files by their base names on the segments, which are unique
+ * across segments because they include the segment's content ID.
+ */
+type ChecksumManifest struct {
+	MetadataFiles map[string]string
+	DataFiles     map[string]string
+}
+
+func GetChecksumFilePath() string {
+	return fmt.Sprintf("%s/gpbackup_%s_checksums.json", GetDirForContent(-1), DumpTimestamp)
+}
+
+func WriteChecksumFile(filename string, checksums *ChecksumManifest) {
+	checksumFile := MustOpenFile(filename)
+	checksumContents, err := json.MarshalIndent(checksums, "", "  ")
+	CheckError(err)
+	MustPrintf(checksumFile, "%s\n", checksumContents)
+}
+
+func ReadChecksumFile(filename string) *ChecksumManifest {
+	checksumContents, err := ioutil.ReadAll(MustOpenFileForReading(filename))
+	CheckError(err)
+	checksums := &ChecksumManifest{}
+	err = json.Unmarshal(checksumContents, checksums)
+	if err != nil {
+		logger.Fatal(errors.Errorf("Unable to parse checksum file %s: %v", filename, err), "")
+	}
+	return checksums
+}
+
+/*
+ * Returns the checksum of each of the given files on the master, keyed by base
+ * name.  Files that do not exist are left out, so that a backup being verified
+ * can report them as missing.
+ */
+func GetLocalFileChecksums(filenames []string) map[string]string {
+	checksums := make(map[string]string, 0)
+	for _, filename := range filenames {
+		if _, err := System.Stat(filename); err != nil {
+			if System.IsNotExist(err) {
+				continue
+			}
+			logger.Fatal(err, "Cannot stat file %s", filename)
+		}
+		hash := sha256.New()
+		_, err := io.Copy(hash, MustOpenFileForReading(filename))
+		CheckError(err)
+		checksums[path.Base(filename)] = fmt.Sprintf("%x", hash.Sum(nil))
+	}
+	return checksums
+}
+
+/*
+ * Compares the checksums recorded when a backup was taken to the checksums of
+ * the files as they are now, returning the sorted names of the files whose
+ * checksums differ and of the files that no longer exist.
+ */
+func CompareChecksums(expected map[string]string, actual map[string]string) ([]string, []string) {
+	corruptFiles := make([]string, 0)
+	missingFiles := make([]string, 0)
+	for filename, expectedChecksum := range expected {
+		actualChecksum, ok := actual[filename]
+		if !ok {
+			missingFiles = append(missingFiles, filename)
+		} else if actualChecksum != expectedChecksum {
+			corruptFiles = append(corruptFiles, filename)
+		}
+	}
+	sort.Strings(corruptFiles)
+	sort.Strings(missingFiles)
+	return corruptFiles, missingFiles
+}
+
+// Returns the paths on the master of the metadata files that are checksummed
+func GetMetadataFilePaths() []string {
+	masterDumpDir := GetDirForContent(-1)
+	return []string{
+		GetEncryptedFilePath(fmt.Sprintf("%s/global.sql", masterDumpDir)),
+		GetEncryptedFilePath(fmt.Sprintf("%s/predata.sql", masterDumpDir)),
+		GetEncryptedFilePath(fmt.Sprintf("%s/postdata.sql", masterDumpDir)),
+		GetTOCFilePath(),
+		GetTableMapFilePath(),
+		GetRowCountFilePath(),
+	}
+}
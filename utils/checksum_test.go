@@ -0,0 +1,105 @@
+package utils_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+
+	"github.com/greenplum-db/gpbackup/testutils"
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("utils/checksum tests", func() {
+	checksums := &utils.ChecksumManifest{
+		MetadataFiles: map[string]string{"predata.sql": "1111"},
+		DataFiles:     map[string]string{"gpbackup_0_20170101010101_3456": "2222", "gpbackup_1_20170101010101_3456": "3333"},
+	}
+
+	BeforeEach(func() {
+		testutils.SetupTestLogger()
+	})
+	AfterEach(func() {
+		utils.System.OpenFile = os.OpenFile
+		utils.System.Stat = os.Stat
+	})
+
+	Describe("GetChecksumFilePath", func() {
+		It("returns the path of the checksum file in the master dump directory", func() {
+			testutils.SetDefaultSegmentConfiguration()
+			Expect(utils.GetChecksumFilePath()).To(Equal("/data/gpseg-1/backups/20170101/20170101010101/gpbackup_20170101010101_checksums.json"))
+		})
+	})
+	Describe("WriteChecksumFile and ReadChecksumFile", func() {
+		It("writes a checksum file that can be read back in", func() {
+			r, w, _ := os.Pipe()
+			utils.System.OpenFile = func(name string, flag int, perm os.FileMode) (*os.File, error) { return w, nil }
+			utils.WriteChecksumFile("checksum_file", checksums)
+			w.Close()
+			contents, _ := ioutil.ReadAll(r)
+
+			r, w, _ = os.Pipe()
+			w.Write(contents)
+			w.Close()
+			utils.System.OpenFile = func(name string, flag int, perm os.FileMode) (*os.File, error) { return r, nil }
+			Expect(utils.ReadChecksumFile("checksum_file")).To(Equal(checksums))
+		})
+		It("panics if the checksum file is not valid", func() {
+			r, w, _ := os.Pipe()
+			w.WriteString("not a checksum file")
+			w.Close()
+			utils.System.OpenFile = func(name string, flag int, perm os.FileMode) (*os.File, error) { return r, nil }
+			defer testutils.ShouldPanicWithMessage("Unable to parse checksum file checksum_file")
+			utils.ReadChecksumFile("checksum_file")
+		})
+	})
+	Describe("GetLocalFileChecksums", func() {
+		It("returns the SHA-256 checksum of each file keyed by its base name", func() {
+			r, w, _ := os.Pipe()
+			w.WriteString("hello\n")
+			w.Close()
+			utils.System.OpenFile = func(name string, flag int, perm os.FileMode) (*os.File, error) { return r, nil }
+			utils.System.Stat = func(name string) (os.FileInfo, error) { return nil, nil }
+			Expect(utils.GetLocalFileChecksums([]string{"/tmp/dir/predata.sql"})).To(Equal(map[string]string{
+				"predata.sql": "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03",
+			}))
+		})
+		It("leaves out files that do not exist", func() {
+			utils.System.Stat = func(name string) (os.FileInfo, error) { return nil, os.ErrNotExist }
+			Expect(utils.GetLocalFileChecksums([]string{"/tmp/dir/predata.sql"})).To(BeEmpty())
+		})
+		It("panics if a file cannot be checked", func() {
+			utils.System.Stat = func(name string) (os.FileInfo, error) { return nil, errors.New("permission denied") }
+			defer testutils.ShouldPanicWithMessage("permission denied")
+			utils.GetLocalFileChecksums([]string{"/tmp/dir/predata.sql"})
+		})
+	})
+	Describe("CompareChecksums", func() {
+		It("returns no files if every checksum matches", func() {
+			corrupt, missing := utils.CompareChecksums(checksums.DataFiles, checksums.DataFiles)
+			Expect(corrupt).To(BeEmpty())
+			Expect(missing).To(BeEmpty())
+		})
+		It("returns the files whose checksums differ and the files that are missing", func() {
+			actual := map[string]string{"gpbackup_0_20170101010101_3456": "4444", "gpbackup_2_20170101010101_3456": "5555"}
+			corrupt, missing := utils.CompareChecksums(checksums.DataFiles, actual)
+			Expect(corrupt).To(Equal([]string{"gpbackup_0_20170101010101_3456"}))
+			Expect(missing).To(Equal([]string{"gpbackup_1_20170101010101_3456"}))
+		})
+	})
+	Describe("GetMetadataFilePaths", func() {
+		It("returns the paths of the metadata files in the master dump directory", func() {
+			testutils.SetDefaultSegmentConfiguration()
+			Expect(utils.GetMetadataFilePaths()).To(Equal([]string{
+				"/data/gpseg-1/backups/20170101/20170101010101/global.sql",
+				"/data/gpseg-1/backups/20170101/20170101010101/predata.sql",
+				"/data/gpseg-1/backups/20170101/20170101010101/postdata.sql",
+				"/data/gpseg-1/backups/20170101/20170101010101/gpbackup_20170101010101_toc.json",
+				"/data/gpseg-1/backups/20170101/20170101010101/gpbackup_20170101010101_table_map",
+				"/data/gpseg-1/backups/20170101/20170101010101/gpbackup_20170101010101_row_counts",
+			}))
+		})
+	})
+})
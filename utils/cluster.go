@@ -0,0 +1,173 @@
+package utils
+
+/*
+ * This file contains structs and functions related to running shell commands
+ * on the hosts of the segments in the cluster.
+ */
+
+import (
+	"bufio"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const segmentDoneMarker = "GPBACKUP_SEGMENT_DONE"
+
+var (
+	ClusterExecutor Executor = &SSHExecutor{}
+)
+
+/*
+ * An Executor runs a shell script on a host and returns its combined stdout and
+ * stderr.  The error is only for failing to run the script, as the exit status
+ * of each command in the script is reported in its output.
+ */
+type Executor interface {
+	ExecuteScript(host string, script string) (string, error)
+}
+
+/*
+ * The SSHExecutor runs scripts on each host over SSH, which must be set up to
+ * connect without a password, as the Greenplum management utilities require.
+ */
+type SSHExecutor struct{}
+
+func (executor *SSHExecutor) ExecuteScript(host string, script string) (string, error) {
+	output, err := exec.Command("ssh", "-o", "BatchMode=yes", host, script).CombinedOutput()
+	return string(output), err
+}
+
+/*
+ * The LocalExecutor runs every script on the local host regardless of the host
+ * it is given, so that clusters running on a single host can be handled, and
+ * commands can be tested, without SSH.
+ */
+type LocalExecutor struct{}
+
+func (executor *LocalExecutor) ExecuteScript(host string, script string) (string, error) {
+	output, err := exec.Command("bash", "-c", script).CombinedOutput()
+	return string(output), err
+}
+
+/*
+ * Stdouts contains the combined stdout and stderr of the command run for each
+ * segment, and Errors contains an error for each segment whose command failed,
+ * both keyed by content id.
+ */
+type ClusterOutput struct {
+	Stdouts map[int]string
+	Errors  map[int]error
+}
+
+/*
+ * The commands of the segments on the same host are run one after another in a
+ * single script, so that each host is only connected to once, while the hosts
+ * run their scripts in parallel.  After each command, the script prints a line
+ * giving its content id and exit status, which is used to split the output of
+ * the script among the segments.  The commandMap is keyed by content id.
+ */
+func ExecuteClusterCommand(commandMap map[int]string) *ClusterOutput {
+	hostContents := make(map[string][]int, 0)
+	for contentID := range commandMap {
+		host := GetHostForContent(contentID)
+		hostContents[host] = append(hostContents[host], contentID)
+	}
+
+	clusterOutput := &ClusterOutput{Stdouts: make(map[int]string, 0), Errors: make(map[int]error, 0)}
+	var mutex sync.Mutex
+	var waitGroup sync.WaitGroup
+	for host, contentIDs := range hostContents {
+		sort.Ints(contentIDs)
+		waitGroup.Add(1)
+		go func(host string, contentIDs []int) {
+			defer waitGroup.Done()
+			output, err := ClusterExecutor.ExecuteScript(host, buildHostScript(contentIDs, commandMap))
+			stdouts, errs := parseHostOutput(output)
+			mutex.Lock()
+			defer mutex.Unlock()
+			for _, contentID := range contentIDs {
+				stdout, finished := stdouts[contentID]
+				if !finished {
+					// The script was cut short, such as by a failure to connect to the host
+					clusterOutput.Stdouts[contentID] = strings.TrimSpace(output)
+					clusterOutput.Errors[contentID] = errors.Errorf("Unable to run command on host %s: %v", host, err)
+					continue
+				}
+				clusterOutput.Stdouts[contentID] = stdout
+				if errs[contentID] != nil {
+					clusterOutput.Errors[contentID] = errs[contentID]
+				}
+			}
+		}(host, contentIDs)
+	}
+	waitGroup.Wait()
+	return clusterOutput
+}
+
+func buildHostScript(contentIDs []int, commandMap map[int]string) string {
+	script := ""
+	for _, contentID := range contentIDs {
+		script += fmt.Sprintf("(%s) 2>&1; printf '\\n%s %d %%d\\n' $?; ", commandMap[contentID], segmentDoneMarker, contentID)
+	}
+	return script
+}
+
+/*
+ * The line giving the exit status of a command is printed after a newline, so
+ * that it is on its own line even if the output of the command does not end in
+ * one, and that newline is removed from the output of the command.
+ */
+func parseHostOutput(output string) (map[int]string, map[int]error) {
+	stdouts := make(map[int]string, 0)
+	errs := make(map[int]error, 0)
+	currentOutput := ""
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		fields := strings.Fields(line)
+		if len(fields) == 3 && fields[0] == segmentDoneMarker {
+			contentID, idErr := strconv.Atoi(fields[1])
+			status, statusErr := strconv.Atoi(fields[2])
+			if idErr == nil && statusErr == nil {
+				stdouts[contentID] = strings.TrimSuffix(currentOutput, "\n")
+				if status != 0 {
+					errs[contentID] = errors.Errorf("Command exited with status %d", status)
+				}
+				currentOutput = ""
+				continue
+			}
+		}
+		currentOutput += line + "\n"
+	}
+	return stdouts, errs
+}
+
+/*
+ * Logs an error for each segment whose command failed, with the message given
+ * by getMessage for that segment followed by the output of the command, and
+ * then fails with finalErrMsg if any command failed.
+ */
+func CheckClusterError(output *ClusterOutput, finalErrMsg string, getMessage func(contentID int) string) {
+	if len(output.Errors) == 0 {
+		return
+	}
+	contentIDs := make([]int, 0)
+	for contentID := range output.Errors {
+		contentIDs = append(contentIDs, contentID)
+	}
+	sort.Ints(contentIDs)
+	for _, contentID := range contentIDs {
+		message := getMessage(contentID)
+		if stdout := strings.TrimSpace(output.Stdouts[contentID]); stdout != "" {
+			message += ": " + stdout
+		}
+		logger.Error("%s (%v)", message, output.Errors[contentID])
+	}
+	logger.Fatal(errors.Errorf("%s on %d segments", finalErrMsg, len(contentIDs)), "")
+}
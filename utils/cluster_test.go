@@ -0,0 +1,116 @@
+package utils_test
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/greenplum-db/gpbackup/testutils"
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+/*
+ * Records the script run on each host and runs it locally, unless the host is
+ * set to fail, in which case it returns the failure instead.
+ */
+type testExecutor struct {
+	mutex       sync.Mutex
+	scripts     map[string]string
+	failedHosts map[string]bool
+}
+
+func (executor *testExecutor) ExecuteScript(host string, script string) (string, error) {
+	executor.mutex.Lock()
+	executor.scripts[host] = script
+	executor.mutex.Unlock()
+	if executor.failedHosts[host] {
+		return "ssh: connect to host " + host + " port 22: Connection refused\n", errors.New("exit status 255")
+	}
+	return (&utils.LocalExecutor{}).ExecuteScript(host, script)
+}
+
+var _ = Describe("utils/cluster tests", func() {
+	var executor *testExecutor
+	var stderr *gbytes.Buffer
+	BeforeEach(func() {
+		_, _, stderr, _ = testutils.SetupTestLogger()
+		executor = &testExecutor{scripts: make(map[string]string, 0), failedHosts: make(map[string]bool, 0)}
+		utils.ClusterExecutor = executor
+		configMaster := utils.QuerySegConfig{-1, "mdw", "/data/gpseg-1"}
+		configSegOne := utils.QuerySegConfig{0, "sdw1", "/data/gpseg0"}
+		configSegTwo := utils.QuerySegConfig{1, "sdw1", "/data/gpseg1"}
+		configSegThree := utils.QuerySegConfig{2, "sdw2", "/data/gpseg2"}
+		utils.SetupSegmentConfiguration([]utils.QuerySegConfig{configMaster, configSegOne, configSegTwo, configSegThree})
+	})
+	AfterEach(func() {
+		utils.ClusterExecutor = &utils.SSHExecutor{}
+		testutils.SetDefaultSegmentConfiguration()
+	})
+	Describe("ExecuteClusterCommand", func() {
+		It("runs one script per host containing the commands of its segments", func() {
+			output := utils.ExecuteClusterCommand(map[int]string{0: "echo zero", 1: "echo one", 2: "echo two"})
+
+			Expect(len(executor.scripts)).To(Equal(2))
+			Expect(strings.Index(executor.scripts["sdw1"], "echo zero")).To(BeNumerically("<", strings.Index(executor.scripts["sdw1"], "echo one")))
+			Expect(executor.scripts["sdw1"]).ToNot(ContainSubstring("echo two"))
+			Expect(executor.scripts["sdw2"]).To(ContainSubstring("echo two"))
+			Expect(output.Stdouts).To(Equal(map[int]string{0: "zero\n", 1: "one\n", 2: "two\n"}))
+			Expect(output.Errors).To(BeEmpty())
+		})
+		It("returns the output of each command exactly, including stderr", func() {
+			output := utils.ExecuteClusterCommand(map[int]string{0: "printf 'no newline'", 1: "echo error >&2", 2: "true"})
+
+			Expect(output.Stdouts).To(Equal(map[int]string{0: "no newline", 1: "error\n", 2: ""}))
+			Expect(output.Errors).To(BeEmpty())
+		})
+		It("returns an error for each segment whose command fails", func() {
+			output := utils.ExecuteClusterCommand(map[int]string{0: "echo failed; exit 3", 1: "echo succeeded", 2: "false"})
+
+			Expect(output.Stdouts).To(Equal(map[int]string{0: "failed\n", 1: "succeeded\n", 2: ""}))
+			Expect(len(output.Errors)).To(Equal(2))
+			Expect(output.Errors[0]).To(MatchError("Command exited with status 3"))
+			Expect(output.Errors[2]).To(MatchError("Command exited with status 1"))
+		})
+		It("returns an error for each segment on a host that cannot be reached", func() {
+			executor.failedHosts["sdw2"] = true
+
+			output := utils.ExecuteClusterCommand(map[int]string{0: "echo zero", 1: "echo one", 2: "echo two"})
+
+			Expect(output.Stdouts).To(Equal(map[int]string{0: "zero\n", 1: "one\n", 2: "ssh: connect to host sdw2 port 22: Connection refused"}))
+			Expect(len(output.Errors)).To(Equal(1))
+			Expect(output.Errors[2]).To(MatchError("Unable to run command on host sdw2: exit status 255"))
+		})
+		It("runs no scripts if there are no commands", func() {
+			output := utils.ExecuteClusterCommand(map[int]string{})
+
+			Expect(executor.scripts).To(BeEmpty())
+			Expect(output.Stdouts).To(BeEmpty())
+			Expect(output.Errors).To(BeEmpty())
+		})
+	})
+	Describe("CheckClusterError", func() {
+		getMessage := func(contentID int) string {
+			return "Command failed on host " + utils.GetHostForContent(contentID)
+		}
+		It("does nothing if no command failed", func() {
+			output := &utils.ClusterOutput{Stdouts: map[int]string{0: "zero\n"}, Errors: map[int]error{}}
+			utils.CheckClusterError(output, "Commands failed", getMessage)
+		})
+		It("logs the output of each failed command and panics", func() {
+			output := &utils.ClusterOutput{
+				Stdouts: map[int]string{0: "zero\n", 1: "", 2: "no such file\n"},
+				Errors:  map[int]error{1: errors.New("Command exited with status 1"), 2: errors.New("Command exited with status 2")},
+			}
+			defer func() {
+				testutils.ExpectRegexp(stderr, "Command failed on host sdw1 (Command exited with status 1)")
+				testutils.ExpectRegexp(stderr, "Command failed on host sdw2: no such file (Command exited with status 2)")
+			}()
+			defer testutils.ShouldPanicWithMessage("Commands failed on 2 segments")
+			utils.CheckClusterError(output, "Commands failed", getMessage)
+		})
+	})
+})
@@ -0,0 +1,125 @@
+package utils
+
+/*
+ * This file contains structs and functions related to compressing table data
+ * files, which is done on the segments by piping COPY through a program.
+ */
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+/*
+ * CompressCommand reads data on stdin and writes it compressed to stdout, with
+ * the compression level appended as a "-N" option.  DecompressCommand reads the
+ * file named after it, or stdin if no file is named, and writes the
+ * decompressed data to stdout.  The "none"
+ * type has no commands, and its data files are read and written by COPY itself.
+ */
+type CompressionType struct {
+	Name              string
+	Extension         string
+	CompressCommand   string
+	DecompressCommand string
+	DefaultLevel      int
+	MaxLevel          int
+}
+
+var (
+	compressionTypes = map[string]CompressionType{
+		"gzip": {Name: "gzip", Extension: ".gz", CompressCommand: "gzip -c", DecompressCommand: "gzip -d -c", DefaultLevel: 6, MaxLevel: 9},
+		"lz4":  {Name: "lz4", Extension: ".lz4", CompressCommand: "lz4 -c", DecompressCommand: "lz4 -d -c", DefaultLevel: 1, MaxLevel: 9},
+		"none": {Name: "none"},
+		"zstd": {Name: "zstd", Extension: ".zst", CompressCommand: "zstd -q -c", DecompressCommand: "zstd -q -d -c", DefaultLevel: 3, MaxLevel: 19},
+	}
+
+	// The compression used for the table data files of the current backup
+	Compression      = compressionTypes["none"]
+	CompressionLevel = 0
+)
+
+func GetCompressionType(name string) (CompressionType, bool) {
+	compression, ok := compressionTypes[name]
+	return compression, ok
+}
+
+/*
+ * Before other compression types were supported, setting a compression level
+ * always meant gzip, so that is the type used when only a level is given.
+ */
+func GetCompressionTypeName(name string, level int) string {
+	if name != "" {
+		return name
+	}
+	if level > 0 {
+		return "gzip"
+	}
+	return "none"
+}
+
+// A level of 0 uses the default level for the compression type
+func SetCompression(name string, level int) {
+	compression, ok := GetCompressionType(name)
+	if !ok {
+		logger.Fatal(errors.Errorf("Compression type %s is not supported", name), "")
+	}
+	if level == 0 {
+		level = compression.DefaultLevel
+	}
+	Compression = compression
+	CompressionLevel = level
+}
+
+/*
+ * These functions return the target of a COPY TO or the source of a COPY FROM
+ * for a data file, which is either the file itself or a pipeline compressing
+ * and/or encrypting the data into that file or decrypting and/or decompressing
+ * it out of that file.  Data is compressed before it is encrypted, since
+ * encrypted data does not compress.  If a plugin is in use, the pipeline sends
+ * the data to or reads it from the plugin instead of the file.
+ */
+func GetCopyToTarget(filename string) string {
+	commands := make([]string, 0)
+	if Compression.CompressCommand != "" {
+		commands = append(commands, fmt.Sprintf("%s -%d", Compression.CompressCommand, CompressionLevel))
+	}
+	if IsEncrypted() {
+		commands = append(commands, GetEncryptCommand())
+	}
+	if Plugin != nil {
+		commands = append(commands, Plugin.GetCommand("backup_data", filename))
+		return fmt.Sprintf("PROGRAM '%s'", escapeProgram(strings.Join(commands, " | ")))
+	}
+	if len(commands) == 0 {
+		return fmt.Sprintf("'%s'", filename)
+	}
+	return fmt.Sprintf("PROGRAM '%s > %s'", strings.Join(commands, " | "), filename)
+}
+
+func GetCopyFromSource(filename string) string {
+	commands := make([]string, 0)
+	if IsEncrypted() {
+		commands = append(commands, GetDecryptCommand())
+	}
+	if Compression.DecompressCommand != "" {
+		commands = append(commands, Compression.DecompressCommand)
+	}
+	if Plugin != nil {
+		commands = append([]string{Plugin.GetCommand("restore_data", filename)}, commands...)
+	} else if len(commands) == 0 {
+		return fmt.Sprintf("'%s'", filename)
+	} else if IsEncrypted() {
+		commands[0] = fmt.Sprintf("%s -in %s", commands[0], filename)
+	} else {
+		commands[0] = fmt.Sprintf("%s %s", commands[0], filename)
+	}
+	return fmt.Sprintf("PROGRAM '%s'", escapeProgram(strings.Join(commands, " | ")))
+}
+
+// Doubles the single quotes in a COPY program, such as those shell-quoting plugin arguments
+func escapeProgram(program string) string {
+	return strings.Replace(program, "'", "''", -1)
+}
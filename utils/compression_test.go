@@ -0,0 +1,93 @@
+package utils_test
+
+import (
+	"github.com/greenplum-db/gpbackup/testutils"
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("utils/compression tests", func() {
+	BeforeEach(func() {
+		testutils.SetupTestLogger()
+	})
+	AfterEach(func() {
+		utils.SetCompression("none", 0)
+		utils.EncryptionPassArg = ""
+	})
+
+	Describe("GetCompressionType", func() {
+		It("returns a supported compression type", func() {
+			compression, ok := utils.GetCompressionType("zstd")
+			Expect(ok).To(BeTrue())
+			Expect(compression.Extension).To(Equal(".zst"))
+		})
+		It("does not return an unsupported compression type", func() {
+			_, ok := utils.GetCompressionType("bzip2")
+			Expect(ok).To(BeFalse())
+		})
+	})
+	Describe("GetCompressionTypeName", func() {
+		It("returns the compression type if it is given", func() {
+			Expect(utils.GetCompressionTypeName("lz4", 5)).To(Equal("lz4"))
+		})
+		It("returns gzip if only a compression level is given", func() {
+			Expect(utils.GetCompressionTypeName("", 5)).To(Equal("gzip"))
+		})
+		It("returns none if neither a compression type nor a level is given", func() {
+			Expect(utils.GetCompressionTypeName("", 0)).To(Equal("none"))
+		})
+	})
+	Describe("SetCompression", func() {
+		It("sets the compression type and level", func() {
+			utils.SetCompression("zstd", 12)
+			Expect(utils.Compression.Name).To(Equal("zstd"))
+			Expect(utils.CompressionLevel).To(Equal(12))
+		})
+		It("uses the default level of the compression type if the level is 0", func() {
+			utils.SetCompression("gzip", 0)
+			Expect(utils.CompressionLevel).To(Equal(6))
+		})
+		It("panics if the compression type is not supported", func() {
+			defer testutils.ShouldPanicWithMessage("Compression type bzip2 is not supported")
+			utils.SetCompression("bzip2", 0)
+		})
+	})
+	Describe("GetCopyToTarget", func() {
+		It("returns the file if compression is not enabled", func() {
+			Expect(utils.GetCopyToTarget("/tmp/file")).To(Equal("'/tmp/file'"))
+		})
+		It("returns a program compressing the data into the file if compression is enabled", func() {
+			utils.SetCompression("lz4", 3)
+			Expect(utils.GetCopyToTarget("/tmp/file.lz4")).To(Equal("PROGRAM 'lz4 -c -3 > /tmp/file.lz4'"))
+		})
+		It("returns a program encrypting the data into the file if encryption is enabled", func() {
+			utils.EncryptionPassArg = "env:KEY"
+			Expect(utils.GetCopyToTarget("/tmp/file.enc")).To(Equal("PROGRAM 'openssl enc -aes-256-cbc -pbkdf2 -salt -pass env:KEY > /tmp/file.enc'"))
+		})
+		It("returns a program compressing and then encrypting the data into the file if both are enabled", func() {
+			utils.SetCompression("gzip", 6)
+			utils.EncryptionPassArg = "env:KEY"
+			Expect(utils.GetCopyToTarget("/tmp/file.gz.enc")).To(Equal("PROGRAM 'gzip -c -6 | openssl enc -aes-256-cbc -pbkdf2 -salt -pass env:KEY > /tmp/file.gz.enc'"))
+		})
+	})
+	Describe("GetCopyFromSource", func() {
+		It("returns the file if compression is not enabled", func() {
+			Expect(utils.GetCopyFromSource("/tmp/file")).To(Equal("'/tmp/file'"))
+		})
+		It("returns a program decompressing the data from the file if compression is enabled", func() {
+			utils.SetCompression("zstd", 0)
+			Expect(utils.GetCopyFromSource("/tmp/file.zst")).To(Equal("PROGRAM 'zstd -q -d -c /tmp/file.zst'"))
+		})
+		It("returns a program decrypting the data from the file if encryption is enabled", func() {
+			utils.EncryptionPassArg = "env:KEY"
+			Expect(utils.GetCopyFromSource("/tmp/file.enc")).To(Equal("PROGRAM 'openssl enc -d -aes-256-cbc -pbkdf2 -pass env:KEY -in /tmp/file.enc'"))
+		})
+		It("returns a program decrypting and then decompressing the data from the file if both are enabled", func() {
+			utils.SetCompression("zstd", 0)
+			utils.EncryptionPassArg = "env:KEY"
+			Expect(utils.GetCopyFromSource("/tmp/file.zst.enc")).To(Equal("PROGRAM 'openssl enc -d -aes-256-cbc -pbkdf2 -pass env:KEY -in /tmp/file.zst.enc | zstd -q -d -c'"))
+		})
+	})
+})
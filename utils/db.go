@@ -16,14 +16,21 @@ import (
 	"github.com/pkg/errors"
 )
 
+/*
+ * Pid is the pid of the backend serving the connection, which is only looked up
+ * for connections made cancellable with MakeCancellable.  Once a connection is
+ * cancelled, it refuses to run any more queries.
+ */
 type DBConn struct {
-	Conn   *sqlx.DB
-	Driver DBDriver
-	User   string
-	DBName string
-	Host   string
-	Port   int
-	Tx     *sqlx.Tx
+	Conn      *sqlx.DB
+	Driver    DBDriver
+	User      string
+	DBName    string
+	Host      string
+	Port      int
+	Tx        *sqlx.Tx
+	Pid       int
+	cancelled int32
 }
 
 func NewDBConn(dbname string) *DBConn {
@@ -77,6 +84,7 @@ func (dbconn *DBConn) Begin() {
 }
 
 func (dbconn *DBConn) Close() {
+	removeCancellable(dbconn)
 	if dbconn.Conn != nil {
 		dbconn.Conn.Close()
 	}
@@ -86,12 +94,30 @@ func (dbconn *DBConn) Commit() {
 	if dbconn.Tx == nil {
 		logger.Fatal(errors.New("Cannot commit transaction; there is no transaction in progress"), "")
 	}
+	if dbconn.IsCancelled() {
+		logger.Fatal(errCancelled, "Cannot commit transaction")
+	}
 	var err error
 	err = dbconn.Tx.Commit()
 	CheckError(err)
 	dbconn.Tx = nil
 }
 
+/*
+ * Unlike Commit, this only logs errors, since transactions are rolled back while
+ * handling another error, when the connection may already be broken.
+ */
+func (dbconn *DBConn) Rollback() {
+	if dbconn.Tx == nil {
+		return
+	}
+	err := dbconn.Tx.Rollback()
+	dbconn.Tx = nil
+	if err != nil {
+		logger.Warn("Unable to roll back transaction: %v", err)
+	}
+}
+
 func (dbconn *DBConn) Connect() {
 	dbname := escapeConnectionParam(dbconn.DBName)
 	user := escapeConnectionParam(dbconn.User)
@@ -115,6 +141,9 @@ func (dbconn *DBConn) Connect() {
 }
 
 func (dbconn *DBConn) Exec(query string) (sql.Result, error) {
+	if dbconn.IsCancelled() {
+		return nil, errCancelled
+	}
 	if dbconn.Tx != nil {
 		return dbconn.Tx.Exec(query)
 	}
@@ -122,6 +151,9 @@ func (dbconn *DBConn) Exec(query string) (sql.Result, error) {
 }
 
 func (dbconn *DBConn) Get(destination interface{}, query string) error {
+	if dbconn.IsCancelled() {
+		return errCancelled
+	}
 	if dbconn.Tx != nil {
 		return dbconn.Tx.Get(destination, query)
 	}
@@ -129,6 +161,9 @@ func (dbconn *DBConn) Get(destination interface{}, query string) error {
 }
 
 func (dbconn *DBConn) Select(destination interface{}, query string) error {
+	if dbconn.IsCancelled() {
+		return errCancelled
+	}
 	if dbconn.Tx != nil {
 		return dbconn.Tx.Select(destination, query)
 	}
@@ -139,6 +174,7 @@ func (dbconn *DBConn) Select(destination interface{}, query string) error {
  * Other useful/helper functions involving DBConn
  */
 
+// Escapes a value for a libpq connection string, which is not SQL and so cannot use QuoteLiteral
 func escapeConnectionParam(param string) string {
 	param = strings.Replace(param, `\`, `\\`, -1)
 	param = strings.Replace(param, `'`, `\'`, -1)
@@ -147,7 +183,7 @@ func escapeConnectionParam(param string) string {
 
 func (dbconn *DBConn) GetDBSize() string {
 	size := struct{ DBSize string }{}
-	sizeQuery := fmt.Sprintf("SELECT pg_size_pretty(sodddatsize) as dbsize FROM gp_toolkit.gp_size_of_database WHERE sodddatname=E'%s'", escapeConnectionParam(dbconn.DBName))
+	sizeQuery := fmt.Sprintf("SELECT pg_size_pretty(sodddatsize) as dbsize FROM gp_toolkit.gp_size_of_database WHERE sodddatname=%s", QuoteLiteral(dbconn.DBName))
 	err := dbconn.Get(&size, sizeQuery)
 	CheckError(err)
 	return size.DBSize
@@ -117,6 +117,23 @@ var _ = Describe("utils/db tests", func() {
 			Expect(rowsReturned).To(Equal(int64(1)))
 		})
 	})
+	Describe("DBConn.Rollback", func() {
+		It("rolls back the transaction in progress", func() {
+			connection, mock = testutils.CreateAndConnectMockDB()
+			testutils.ExpectBegin(mock)
+			mock.ExpectRollback()
+
+			connection.Begin()
+			connection.Rollback()
+			Expect(connection.Tx).To(BeNil())
+			Expect(mock.ExpectationsWereMet()).To(Succeed())
+		})
+		It("does nothing if there is no transaction in progress", func() {
+			connection, mock = testutils.CreateAndConnectMockDB()
+			connection.Rollback()
+			Expect(mock.ExpectationsWereMet()).To(Succeed())
+		})
+	})
 	Describe("DBConn.Get", func() {
 		It("executes a GET outside of a transaction", func() {
 			connection, mock = testutils.CreateAndConnectMockDB()
@@ -0,0 +1,176 @@
+package utils
+
+/*
+ * This file contains functions related to encrypting backup files, which is
+ * done with openssl on the segments for table data files and on the master for
+ * metadata files, so that the files can also be decrypted by hand if needed.
+ */
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const ENCRYPTION_EXTENSION = ".enc"
+
+// The first version of OpenSSL with the -pbkdf2 option used to derive the key
+const MINIMUM_OPENSSL_VERSION = "1.1.1"
+
+var (
+	// The openssl -pass argument giving the key of the current backup, or "" if it is not encrypted
+	EncryptionPassArg = ""
+)
+
+/*
+ * The key is either read from a key file, which must exist at the same path on
+ * every host in the cluster, or is a passphrase read from an environment
+ * variable, which must also be set in the environment of the segments.  Only
+ * the location of the key is passed to openssl, so the key itself never
+ * appears in a command line or a query.  If neither is given, encryption is
+ * disabled.
+ */
+func SetEncryption(keyFile string, passphraseEnv string) {
+	if keyFile != "" {
+		if _, err := System.Stat(keyFile); err != nil {
+			logger.Fatal(errors.Errorf("Encryption key file %s does not exist", keyFile), "")
+		}
+		EncryptionPassArg = fmt.Sprintf("file:%s", keyFile)
+	} else if passphraseEnv != "" {
+		if System.Getenv(passphraseEnv) == "" {
+			logger.Fatal(errors.Errorf("Environment variable %s containing the encryption passphrase is not set", passphraseEnv), "")
+		}
+		EncryptionPassArg = fmt.Sprintf("env:%s", passphraseEnv)
+	} else {
+		EncryptionPassArg = ""
+	}
+}
+
+func IsEncrypted() bool {
+	return EncryptionPassArg != ""
+}
+
+func GetEncryptionExtension() string {
+	if IsEncrypted() {
+		return ENCRYPTION_EXTENSION
+	}
+	return ""
+}
+
+// Returns the path a metadata file is stored at, which has an extension if the backup is encrypted
+func GetEncryptedFilePath(filename string) string {
+	return filename + GetEncryptionExtension()
+}
+
+/*
+ * Returns an error unless the output of "openssl version" gives a version of
+ * OpenSSL at least as recent as MINIMUM_OPENSSL_VERSION.  Letter suffixes only
+ * mark bug fix releases, so they are ignored.
+ */
+func ValidateOpenSSLVersion(output string) error {
+	versionRegex := regexp.MustCompile(`^OpenSSL (\d+)\.(\d+)\.(\d+)`)
+	matches := versionRegex.FindStringSubmatch(strings.TrimSpace(output))
+	if matches == nil {
+		return errors.Errorf("Unable to determine the version of OpenSSL")
+	}
+	for i, minimumPart := range strings.Split(MINIMUM_OPENSSL_VERSION, ".") {
+		version, _ := strconv.Atoi(matches[i+1])
+		minimum, _ := strconv.Atoi(minimumPart)
+		if version > minimum {
+			return nil
+		} else if version < minimum {
+			return errors.Errorf("OpenSSL %s or later is required", MINIMUM_OPENSSL_VERSION)
+		}
+	}
+	return nil
+}
+
+/*
+ * Backup files are encrypted and decrypted on the master and on every segment,
+ * so each of them must have a recent enough version of OpenSSL.  This is
+ * checked before anything is written, since older versions fail on the first
+ * file with an unhelpful usage message.
+ */
+func CheckOpenSSLVersion() {
+	commandMap := make(map[int]string, 0)
+	for _, contentID := range GetContentList() {
+		commandMap[contentID] = "openssl version"
+	}
+	output := ExecuteClusterCommand(commandMap)
+	for contentID, stdout := range output.Stdouts {
+		if output.Errors[contentID] == nil {
+			if err := ValidateOpenSSLVersion(stdout); err != nil {
+				output.Errors[contentID] = err
+			}
+		}
+	}
+	CheckClusterError(output, "Unable to use OpenSSL for encryption", func(contentID int) string {
+		return fmt.Sprintf("Cannot use openssl for encryption on host %s", GetHostForContent(contentID))
+	})
+}
+
+func getEncryptArgs() []string {
+	return []string{"enc", "-aes-256-cbc", "-pbkdf2", "-salt", "-pass", EncryptionPassArg}
+}
+
+func getDecryptArgs() []string {
+	return []string{"enc", "-d", "-aes-256-cbc", "-pbkdf2", "-pass", EncryptionPassArg}
+}
+
+/*
+ * These functions return the commands used on the segments to encrypt and
+ * decrypt data from stdin to stdout.  The decrypt command reads a file instead
+ * if "-in <file>" is appended to it.
+ */
+func GetEncryptCommand() string {
+	return fmt.Sprintf("openssl %s", strings.Join(getEncryptArgs(), " "))
+}
+
+func GetDecryptCommand() string {
+	return fmt.Sprintf("openssl %s", strings.Join(getDecryptArgs(), " "))
+}
+
+/*
+ * The metadata files are written in plain text, so that the offsets in the TOC
+ * refer to the plain text, and are encrypted once they are complete.  The
+ * plain text file is removed once the encrypted file has been written.
+ */
+func EncryptFile(filename string) {
+	args := append(getEncryptArgs(), "-in", filename, "-out", GetEncryptedFilePath(filename))
+	output, err := exec.Command("openssl", args...).CombinedOutput()
+	if err != nil {
+		logger.Fatal(errors.Errorf("Unable to encrypt file %s: %s", filename, strings.TrimSpace(string(output))), "")
+	}
+	err = System.Remove(filename)
+	if err != nil {
+		logger.Fatal(err, "Unable to remove unencrypted file %s", filename)
+	}
+}
+
+/*
+ * Returns the contents of a metadata file, decrypting it in memory if the
+ * backup is encrypted so that the plain text is never written to disk.
+ */
+func ReadMetadataFile(filename string) []byte {
+	if !IsEncrypted() {
+		contents, err := ioutil.ReadAll(MustOpenFileForReading(filename))
+		CheckError(err)
+		return contents
+	}
+	encryptedFilename := GetEncryptedFilePath(filename)
+	args := append(getDecryptArgs(), "-in", encryptedFilename)
+	cmd := exec.Command("openssl", args...)
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	contents, err := cmd.Output()
+	if err != nil {
+		logger.Fatal(errors.Errorf("Unable to decrypt file %s: %s", encryptedFilename, strings.TrimSpace(stderr.String())), "")
+	}
+	return contents
+}
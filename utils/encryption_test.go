@@ -0,0 +1,111 @@
+package utils_test
+
+import (
+	"os"
+
+	"github.com/greenplum-db/gpbackup/testutils"
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("utils/encryption tests", func() {
+	BeforeEach(func() {
+		testutils.SetupTestLogger()
+	})
+	AfterEach(func() {
+		utils.EncryptionPassArg = ""
+		utils.System.Stat = os.Stat
+		utils.System.Getenv = os.Getenv
+	})
+
+	Describe("SetEncryption", func() {
+		It("uses the key in the key file", func() {
+			utils.System.Stat = func(name string) (os.FileInfo, error) { return nil, nil }
+			utils.SetEncryption("/home/gpadmin/backup.key", "")
+			Expect(utils.IsEncrypted()).To(BeTrue())
+			Expect(utils.EncryptionPassArg).To(Equal("file:/home/gpadmin/backup.key"))
+		})
+		It("uses the passphrase in the environment variable", func() {
+			utils.System.Getenv = func(key string) string { return "secret" }
+			utils.SetEncryption("", "BACKUP_PASSPHRASE")
+			Expect(utils.IsEncrypted()).To(BeTrue())
+			Expect(utils.EncryptionPassArg).To(Equal("env:BACKUP_PASSPHRASE"))
+		})
+		It("disables encryption if no key is given", func() {
+			utils.SetEncryption("", "")
+			Expect(utils.IsEncrypted()).To(BeFalse())
+		})
+		It("panics if the key file does not exist", func() {
+			utils.System.Stat = func(name string) (os.FileInfo, error) { return nil, os.ErrNotExist }
+			defer testutils.ShouldPanicWithMessage("Encryption key file /home/gpadmin/backup.key does not exist")
+			utils.SetEncryption("/home/gpadmin/backup.key", "")
+		})
+		It("panics if the environment variable is not set", func() {
+			utils.System.Getenv = func(key string) string { return "" }
+			defer testutils.ShouldPanicWithMessage("Environment variable BACKUP_PASSPHRASE containing the encryption passphrase is not set")
+			utils.SetEncryption("", "BACKUP_PASSPHRASE")
+		})
+	})
+	Describe("GetEncryptedFilePath", func() {
+		It("returns the file unchanged if the backup is not encrypted", func() {
+			Expect(utils.GetEncryptedFilePath("/tmp/predata.sql")).To(Equal("/tmp/predata.sql"))
+		})
+		It("adds an extension to the file if the backup is encrypted", func() {
+			utils.EncryptionPassArg = "env:BACKUP_PASSPHRASE"
+			Expect(utils.GetEncryptedFilePath("/tmp/predata.sql")).To(Equal("/tmp/predata.sql.enc"))
+		})
+	})
+	Describe("GetEncryptCommand and GetDecryptCommand", func() {
+		It("pass only the location of the key to openssl", func() {
+			utils.EncryptionPassArg = "file:/home/gpadmin/backup.key"
+			Expect(utils.GetEncryptCommand()).To(Equal("openssl enc -aes-256-cbc -pbkdf2 -salt -pass file:/home/gpadmin/backup.key"))
+			Expect(utils.GetDecryptCommand()).To(Equal("openssl enc -d -aes-256-cbc -pbkdf2 -pass file:/home/gpadmin/backup.key"))
+		})
+	})
+	Describe("ValidateOpenSSLVersion", func() {
+		It("accepts the minimum version and later versions", func() {
+			Expect(utils.ValidateOpenSSLVersion("OpenSSL 1.1.1  11 Sep 2018\n")).To(Succeed())
+			Expect(utils.ValidateOpenSSLVersion("OpenSSL 1.1.1w  11 Sep 2023\n")).To(Succeed())
+			Expect(utils.ValidateOpenSSLVersion("OpenSSL 3.0.2 15 Mar 2022 (Library: OpenSSL 3.0.2 15 Mar 2022)\n")).To(Succeed())
+		})
+		It("rejects earlier versions", func() {
+			Expect(utils.ValidateOpenSSLVersion("OpenSSL 1.0.2k-fips  26 Jan 2017\n")).To(MatchError("OpenSSL 1.1.1 or later is required"))
+			Expect(utils.ValidateOpenSSLVersion("OpenSSL 1.1.0l  10 Sep 2019\n")).To(MatchError("OpenSSL 1.1.1 or later is required"))
+			Expect(utils.ValidateOpenSSLVersion("OpenSSL 0.9.8zh 3 Dec 2015\n")).To(MatchError("OpenSSL 1.1.1 or later is required"))
+		})
+		It("rejects output that does not give an OpenSSL version", func() {
+			Expect(utils.ValidateOpenSSLVersion("LibreSSL 2.8.3\n")).To(MatchError("Unable to determine the version of OpenSSL"))
+			Expect(utils.ValidateOpenSSLVersion("")).To(MatchError("Unable to determine the version of OpenSSL"))
+		})
+	})
+	Describe("CheckOpenSSLVersion", func() {
+		var executor *testExecutor
+		BeforeEach(func() {
+			executor = &testExecutor{scripts: make(map[string]string, 0), failedHosts: make(map[string]bool, 0)}
+			utils.ClusterExecutor = executor
+			configMaster := utils.QuerySegConfig{-1, "mdw", "/data/gpseg-1"}
+			configSegOne := utils.QuerySegConfig{0, "sdw1", "/data/gpseg0"}
+			utils.SetupSegmentConfiguration([]utils.QuerySegConfig{configMaster, configSegOne})
+		})
+		AfterEach(func() {
+			utils.ClusterExecutor = &utils.SSHExecutor{}
+			testutils.SetDefaultSegmentConfiguration()
+		})
+		It("checks the version of openssl on the master and every segment host", func() {
+			utils.CheckOpenSSLVersion()
+			Expect(executor.scripts["mdw"]).To(ContainSubstring("openssl version"))
+			Expect(executor.scripts["sdw1"]).To(ContainSubstring("openssl version"))
+		})
+		It("panics if a host cannot be reached", func() {
+			_, _, stderr, _ := testutils.SetupTestLogger()
+			executor.failedHosts["sdw1"] = true
+			defer func() {
+				testutils.ExpectRegexp(stderr, "Cannot use openssl for encryption on host sdw1: ssh: connect to host sdw1 port 22: Connection refused")
+			}()
+			defer testutils.ShouldPanicWithMessage("Unable to use OpenSSL for encryption on 1 segments")
+			utils.CheckOpenSSLVersion()
+		})
+	})
+})
@@ -12,6 +12,21 @@ import (
 	"github.com/pkg/errors"
 )
 
+/*
+ * A flag that can be passed more than once, such as --include-schema, collects
+ * each value it is passed into this list.
+ */
+type ArrayFlags []string
+
+func (flags *ArrayFlags) String() string {
+	return strings.Join(*flags, ",")
+}
+
+func (flags *ArrayFlags) Set(value string) error {
+	*flags = append(*flags, value)
+	return nil
+}
+
 /*
  * Functions for validating whether flags are set and in what combination
  */
@@ -20,6 +35,15 @@ func FlagIsSet(f *flag.Flag) bool {
 	return (*f).Value.String() != (*f).DefValue
 }
 
+// Returns the value of each flag that was set on the command line, by flag name
+func GetSetFlags() map[string]string {
+	setFlags := make(map[string]string, 0)
+	flag.Visit(func(f *flag.Flag) {
+		setFlags[f.Name] = f.Value.String()
+	})
+	return setFlags
+}
+
 // Each flag passed to this function must be set
 func CheckMandatoryFlags(flagNames ...string) {
 	for _, name := range flagNames {
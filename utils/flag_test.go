@@ -41,11 +41,30 @@ var _ = Describe("utils/flag tests", func() {
 		var testString *string
 		var testBool *bool
 		var testInt *int
+		var testArray *utils.ArrayFlags
 		BeforeEach(func() {
 			flag.CommandLine = flag.NewFlagSet("", flag.ContinueOnError)
 			testString = flag.String("stringFlag", "", "This is a sample string flag.")
 			testBool = flag.Bool("boolFlag", false, "This is a sample bool flag.")
 			testInt = flag.Int("intFlag", 0, "This is a sample int flag.")
+			testArray = &utils.ArrayFlags{}
+			flag.Var(testArray, "arrayFlag", "This is a sample array flag.")
+		})
+		Context("ArrayFlags", func() {
+			It("is empty if the flag is not passed", func() {
+				flag.CommandLine.Parse([]string{})
+				Expect(*testArray).To(BeEmpty())
+				Expect(utils.FlagIsSet(flag.Lookup("arrayFlag"))).To(BeFalse())
+			})
+			It("collects a value passed once", func() {
+				flag.CommandLine.Parse([]string{"-arrayFlag", "foo"})
+				Expect(*testArray).To(Equal(utils.ArrayFlags{"foo"}))
+				Expect(utils.FlagIsSet(flag.Lookup("arrayFlag"))).To(BeTrue())
+			})
+			It("collects each value in order if the flag is passed more than once", func() {
+				flag.CommandLine.Parse([]string{"-arrayFlag", "foo", "-arrayFlag", "bar", "-arrayFlag", "baz"})
+				Expect(*testArray).To(Equal(utils.ArrayFlags{"foo", "bar", "baz"}))
+			})
 		})
 		Context("CheckMandatoryFlags", func() {
 			It("does not panic if a mandatory flag is set", func() {
@@ -77,5 +96,11 @@ var _ = Describe("utils/flag tests", func() {
 				utils.CheckExclusiveFlags("stringFlag", "boolFlag")
 			})
 		})
+		Context("GetSetFlags", func() {
+			It("returns the values of only the flags that were set", func() {
+				flag.CommandLine.Parse([]string{"-stringFlag", "foo", "-boolFlag", "-arrayFlag", "bar", "-arrayFlag", "baz"})
+				Expect(utils.GetSetFlags()).To(Equal(map[string]string{"stringFlag": "foo", "boolFlag": "true", "arrayFlag": "bar,baz"}))
+			})
+		})
 	})
 })
@@ -0,0 +1,137 @@
+package utils
+
+/*
+ * This file contains structs and functions related to the backup history
+ * file, which records one entry for each run of gpbackup so that past backups
+ * can be found without searching through the backup directories.
+ */
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// The status given to the entry of a backup once the backup has been deleted
+const HISTORY_STATUS_DELETED = "Deleted"
+
+/*
+ * Bytes is the total size of the tables whose data was backed up, before any
+ * compression.
+ */
+type HistoryEntry struct {
+	Timestamp       string
+	DatabaseName    string
+	Status          string
+	Flags           map[string]string
+	TableCount      int
+	Bytes           int64
+	DurationSeconds int64
+}
+
+/*
+ * The history file is kept in the master data directory instead of in a dump
+ * directory, so that it covers backups taken to any base directory.
+ */
+func GetHistoryFilePath() string {
+	return fmt.Sprintf("%s/gpbackup_history.jsonl", GetMasterDataDir())
+}
+
+func NewHistoryEntry(manifest *Manifest) HistoryEntry {
+	entry := HistoryEntry{
+		Timestamp:    manifest.StartTime,
+		DatabaseName: manifest.DatabaseName,
+		Status:       manifest.Status,
+		Flags:        manifest.Flags,
+		TableCount:   manifest.TableCount,
+		Bytes:        manifest.DataSize,
+	}
+	startTime, startErr := time.ParseInLocation("20060102150405", manifest.StartTime, time.Local)
+	endTime, endErr := time.ParseInLocation("20060102150405", manifest.EndTime, time.Local)
+	if startErr == nil && endErr == nil {
+		entry.DurationSeconds = int64(endTime.Sub(startTime).Seconds())
+	}
+	return entry
+}
+
+/*
+ * Each entry is written as a single line of JSON, so that entries can be
+ * appended to the file without reading or rewriting the entries before them.
+ */
+func AppendHistoryEntry(filename string, entry HistoryEntry) {
+	historyFile := MustOpenFile(filename)
+	entryContents, err := json.Marshal(entry)
+	CheckError(err)
+	MustPrintf(historyFile, "%s\n", entryContents)
+}
+
+/*
+ * Deleting a backup appends a new entry for it with the deleted status instead
+ * of rewriting the file, so that entry replaces the status of the earlier entry
+ * for the same backup, if there is one, rather than being returned separately.
+ */
+func ReadHistoryFile(filename string) []HistoryEntry {
+	entries := make([]HistoryEntry, 0)
+	entryIndexes := make(map[string]int, 0)
+	if _, err := System.Stat(filename); err != nil {
+		if System.IsNotExist(err) {
+			return entries
+		}
+		logger.Fatal(err, "Cannot stat history file %s", filename)
+	}
+	scanner := bufio.NewScanner(MustOpenFileForReading(filename))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		entry := HistoryEntry{}
+		err := json.Unmarshal([]byte(line), &entry)
+		if err != nil {
+			logger.Fatal(errors.Errorf("Invalid entry in history file %s: %s", filename, line), "")
+		}
+		if index, ok := entryIndexes[entry.Timestamp]; ok && entry.Status == HISTORY_STATUS_DELETED {
+			entries[index].Status = HISTORY_STATUS_DELETED
+			continue
+		}
+		entryIndexes[entry.Timestamp] = len(entries)
+		entries = append(entries, entry)
+	}
+	CheckError(scanner.Err())
+	return entries
+}
+
+/*
+ * Prints one line per entry, in the order of the entries, with the flags in
+ * the form they were passed on the command line.  The columns are separated
+ * by whitespace so that the output can be processed by other tools, so spaces
+ * in the status are replaced with underscores.
+ */
+func PrintHistoryEntries(historyFile io.Writer, entries []HistoryEntry) {
+	writer := tabwriter.NewWriter(historyFile, 0, 0, 2, ' ', 0)
+	MustPrintf(writer, "TIMESTAMP\tDATABASE\tSTATUS\tTABLES\tBYTES\tDURATION\tFLAGS\n")
+	for _, entry := range entries {
+		flagNames := make([]string, 0)
+		for name := range entry.Flags {
+			flagNames = append(flagNames, name)
+		}
+		sort.Strings(flagNames)
+		flagList := make([]string, 0)
+		for _, name := range flagNames {
+			flagList = append(flagList, fmt.Sprintf("--%s=%s", name, entry.Flags[name]))
+		}
+		MustPrintf(writer, "%s\t%s\t%s\t%d\t%d\t%ds", entry.Timestamp, entry.DatabaseName, strings.Replace(entry.Status, " ", "_", -1), entry.TableCount, entry.Bytes, entry.DurationSeconds)
+		if len(flagList) > 0 {
+			MustPrintf(writer, "\t%s", strings.Join(flagList, " "))
+		}
+		MustPrintf(writer, "\n")
+	}
+	CheckError(writer.Flush())
+}
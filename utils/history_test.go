@@ -0,0 +1,127 @@
+package utils_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+
+	"github.com/greenplum-db/gpbackup/testutils"
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("utils/history tests", func() {
+	entry := utils.HistoryEntry{
+		Timestamp:       "20170101010101",
+		DatabaseName:    "testdb",
+		Status:          utils.BACKUP_STATUS_COMPLETE,
+		Flags:           map[string]string{"dbname": "testdb", "jobs": "4"},
+		TableCount:      2,
+		Bytes:           16384,
+		DurationSeconds: 61,
+	}
+	failedEntry := utils.HistoryEntry{
+		Timestamp:    "20170102010101",
+		DatabaseName: "otherdb",
+		Status:       utils.BACKUP_STATUS_FAILED,
+		Flags:        map[string]string{},
+	}
+
+	BeforeEach(func() {
+		testutils.SetupTestLogger()
+	})
+	AfterEach(func() {
+		utils.System.OpenFile = os.OpenFile
+		utils.System.Stat = os.Stat
+	})
+
+	Describe("GetHistoryFilePath", func() {
+		It("returns the path of the history file in the master data directory", func() {
+			testutils.SetDefaultSegmentConfiguration()
+			Expect(utils.GetHistoryFilePath()).To(Equal("/data/gpseg-1/gpbackup_history.jsonl"))
+		})
+	})
+	Describe("NewHistoryEntry", func() {
+		It("creates an entry from the manifest of a backup", func() {
+			manifest := &utils.Manifest{
+				DatabaseName: "testdb",
+				Flags:        map[string]string{"dbname": "testdb", "jobs": "4"},
+				TableCount:   2,
+				DataSize:     16384,
+				StartTime:    "20170101010101",
+				EndTime:      "20170101010202",
+				Status:       utils.BACKUP_STATUS_COMPLETE,
+			}
+			Expect(utils.NewHistoryEntry(manifest)).To(Equal(entry))
+		})
+		It("leaves the duration at 0 if the backup has no end time", func() {
+			manifest := &utils.Manifest{StartTime: "20170101010101", Status: utils.BACKUP_STATUS_IN_PROGRESS}
+			Expect(utils.NewHistoryEntry(manifest).DurationSeconds).To(Equal(int64(0)))
+		})
+	})
+	Describe("AppendHistoryEntry and ReadHistoryFile", func() {
+		It("appends entries to the history file that can be read back in", func() {
+			r, w, _ := os.Pipe()
+			openFlags := 0
+			utils.System.OpenFile = func(name string, flag int, perm os.FileMode) (*os.File, error) { openFlags = flag; return w, nil }
+			utils.AppendHistoryEntry("history_file", entry)
+			utils.AppendHistoryEntry("history_file", failedEntry)
+			w.Close()
+			Expect(openFlags & os.O_APPEND).To(Equal(os.O_APPEND))
+			contents, _ := ioutil.ReadAll(r)
+
+			r, w, _ = os.Pipe()
+			w.Write(contents)
+			w.Close()
+			utils.System.OpenFile = func(name string, flag int, perm os.FileMode) (*os.File, error) { return r, nil }
+			utils.System.Stat = func(name string) (os.FileInfo, error) { return nil, nil }
+			Expect(utils.ReadHistoryFile("history_file")).To(Equal([]utils.HistoryEntry{entry, failedEntry}))
+		})
+		It("marks the entry of a backup deleted if a deleted entry for it follows", func() {
+			deletedEntry := entry
+			deletedEntry.Status = utils.HISTORY_STATUS_DELETED
+			orphanedEntry := utils.HistoryEntry{Timestamp: "20170103010101", DatabaseName: "testdb", Status: utils.HISTORY_STATUS_DELETED}
+			r, w, _ := os.Pipe()
+			utils.System.OpenFile = func(name string, flag int, perm os.FileMode) (*os.File, error) { return w, nil }
+			utils.AppendHistoryEntry("history_file", entry)
+			utils.AppendHistoryEntry("history_file", failedEntry)
+			utils.AppendHistoryEntry("history_file", deletedEntry)
+			utils.AppendHistoryEntry("history_file", orphanedEntry)
+			w.Close()
+			utils.System.OpenFile = func(name string, flag int, perm os.FileMode) (*os.File, error) { return r, nil }
+			utils.System.Stat = func(name string) (os.FileInfo, error) { return nil, nil }
+			Expect(utils.ReadHistoryFile("history_file")).To(Equal([]utils.HistoryEntry{deletedEntry, failedEntry, orphanedEntry}))
+		})
+		It("returns no entries if the history file does not exist", func() {
+			utils.System.Stat = func(name string) (os.FileInfo, error) { return nil, os.ErrNotExist }
+			Expect(utils.ReadHistoryFile("history_file")).To(BeEmpty())
+		})
+		It("panics if the history file cannot be checked", func() {
+			utils.System.Stat = func(name string) (os.FileInfo, error) { return nil, errors.New("permission denied") }
+			defer testutils.ShouldPanicWithMessage("permission denied")
+			utils.ReadHistoryFile("history_file")
+		})
+		It("panics if an entry is not valid", func() {
+			r, w, _ := os.Pipe()
+			w.WriteString("not an entry\n")
+			w.Close()
+			utils.System.OpenFile = func(name string, flag int, perm os.FileMode) (*os.File, error) { return r, nil }
+			utils.System.Stat = func(name string) (os.FileInfo, error) { return nil, nil }
+			defer testutils.ShouldPanicWithMessage("Invalid entry in history file history_file: not an entry")
+			utils.ReadHistoryFile("history_file")
+		})
+	})
+	Describe("PrintHistoryEntries", func() {
+		It("prints a line for each entry", func() {
+			buffer := gbytes.NewBuffer()
+			utils.PrintHistoryEntries(buffer, []utils.HistoryEntry{entry, failedEntry})
+			testutils.ExpectRegexp(buffer, `TIMESTAMP       DATABASE  STATUS    TABLES  BYTES  DURATION  FLAGS
+20170101010101  testdb    Complete  2       16384  61s       --dbname=testdb --jobs=4
+20170102010101  otherdb   Failed    0       0      0s
+`)
+		})
+	})
+})
@@ -6,10 +6,13 @@ package utils
  */
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"path"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -20,9 +23,10 @@ const DefaultSegmentDir = "<SEG_DATA_DIR>"
 var (
 	BaseDumpDir = DefaultSegmentDir
 
-	contentList []int
-	segDirMap   map[int]string
-	segHostMap  map[int]string
+	contentList   []int
+	masterDataDir string
+	segDirMap     map[int]string
+	segHostMap    map[int]string
 )
 
 /*
@@ -67,6 +71,33 @@ func MustOpenFile(filename string) io.Writer {
 	return fileHandle
 }
 
+func MustOpenFileForReading(filename string) io.Reader {
+	fileHandle, err := System.OpenFile(filename, os.O_RDONLY, 0644)
+	if err != nil {
+		logger.Fatal(err, "Unable to open file for reading")
+	}
+	return fileHandle
+}
+
+/*
+ * Reads a file containing one entry per line, such as a list of tables passed to
+ * --include-table-file, ignoring blank lines and surrounding whitespace.
+ */
+func ReadLinesFromFile(filename string) []string {
+	scanner := bufio.NewScanner(MustOpenFileForReading(filename))
+	lines := make([]string, 0)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		logger.Fatal(err, "Unable to read file %s", filename)
+	}
+	return lines
+}
+
 func GetUserAndHostInfo() (string, string, string) {
 	currentUser, _ := System.CurrentUser()
 	userName := currentUser.Username
@@ -75,17 +106,29 @@ func GetUserAndHostInfo() (string, string, string) {
 	return userName, userDir, hostname
 }
 
+/*
+ * An encrypted file is decrypted in memory and passed to psql on stdin, so that
+ * its plain text is never written to disk.
+ */
 func ExecuteSQLFile(dbconn *DBConn, filename string) {
+	inputFile := filename
+	if IsEncrypted() {
+		inputFile = "-"
+	}
 	connStr := []string{
 		"-U", dbconn.User,
 		"-d", fmt.Sprintf("%s", QuoteIdent(dbconn.DBName)),
 		"-h", dbconn.Host,
 		"-p", fmt.Sprintf("%d", dbconn.Port),
-		"-f", fmt.Sprintf("%s", filename),
+		"-f", fmt.Sprintf("%s", inputFile),
 		"-v", "ON_ERROR_STOP=1",
 		"-q",
 	}
-	out, err := exec.Command("psql", connStr...).CombinedOutput()
+	cmd := exec.Command("psql", connStr...)
+	if IsEncrypted() {
+		cmd.Stdin = bytes.NewReader(ReadMetadataFile(filename))
+	}
+	out, err := cmd.CombinedOutput()
 	if err != nil {
 		/*
 		 * Not using logger.Fatal, as this is a SQL error rather than a code error,
@@ -114,29 +157,87 @@ func MustPrintln(file io.Writer, v ...interface{}) {
  * Backup-specific file/directory manipulation functions
  */
 
-// TODO: Handle multi-node clusters
+/*
+ * The master directory is created locally, since gpbackup runs on the master,
+ * and the segment directories are created on their own hosts.
+ */
 func CreateDumpDirs() {
-	for segID, dumpPath := range segDirMap {
-		logger.Verbose("Creating directory %s", dumpPath)
-		err := System.MkdirAll(dumpPath, 0700)
-		if err != nil {
-			logger.Fatal(err, "Cannot create directory %s on host %s", dumpPath, segHostMap[segID])
+	masterDir := GetDirForContent(-1)
+	logger.Verbose("Creating directory %s", masterDir)
+	err := System.MkdirAll(masterDir, 0700)
+	if err != nil {
+		logger.Fatal(err, "Cannot create directory %s on host %s", masterDir, GetHostForContent(-1))
+	}
+	commandMap := make(map[int]string, 0)
+	for contentID, dumpPath := range segDirMap {
+		if contentID >= 0 {
+			logger.Verbose("Creating directory %s on host %s", dumpPath, GetHostForContent(contentID))
+			commandMap[contentID] = fmt.Sprintf("umask 077 && mkdir -p %s", ShellQuote(dumpPath))
 		}
-		CheckError(err)
 	}
+	output := ExecuteClusterCommand(commandMap)
+	CheckClusterError(output, "Unable to create dump directories", func(contentID int) string {
+		return fmt.Sprintf("Cannot create directory %s on host %s", GetDirForContent(contentID), GetHostForContent(contentID))
+	})
 }
 
-// TODO: Handle multi-node clusters
 func AssertDumpDirsExist() {
-	for _, dumpPath := range segDirMap {
-		exists, err := CheckDirectoryExists(dumpPath)
-		if err != nil {
-			logger.Fatal(err, "Error statting dump directory %s", dumpPath)
-		}
-		if !exists {
-			logger.Fatal(errors.Errorf("Dump directory %s does not exist", dumpPath), "")
+	masterDir := GetDirForContent(-1)
+	exists, err := CheckDirectoryExists(masterDir)
+	if err != nil {
+		logger.Fatal(err, "Error statting dump directory %s", masterDir)
+	}
+	if !exists {
+		logger.Fatal(errors.Errorf("Dump directory %s does not exist", masterDir), "")
+	}
+	commandMap := make(map[int]string, 0)
+	for contentID, dumpPath := range segDirMap {
+		if contentID >= 0 {
+			commandMap[contentID] = fmt.Sprintf("test -d %s", ShellQuote(dumpPath))
 		}
 	}
+	output := ExecuteClusterCommand(commandMap)
+	CheckClusterError(output, "Dump directories do not exist", func(contentID int) string {
+		return fmt.Sprintf("Dump directory %s does not exist on host %s", GetDirForContent(contentID), GetHostForContent(contentID))
+	})
+}
+
+func GetTableMapFilePath() string {
+	return fmt.Sprintf("%s/gpbackup_%s_table_map", GetDirForContent(-1), DumpTimestamp)
+}
+
+func GetRowCountFilePath() string {
+	return GetRowCountFilePathForTimestamp(DumpTimestamp)
+}
+
+/*
+ * The rows of a table that is unchanged in an incremental backup were counted
+ * when its data was dumped, so restore reads its count from the base backup.
+ */
+func GetRowCountFilePathForTimestamp(timestamp string) string {
+	return fmt.Sprintf("%s/gpbackup_%s_row_counts", GetMasterDirForTimestamp(timestamp), timestamp)
+}
+
+func GetTOCFilePath() string {
+	return fmt.Sprintf("%s/gpbackup_%s_toc.json", GetDirForContent(-1), DumpTimestamp)
+}
+
+/*
+ * Returns the path of the file holding a table's data on each segment, with
+ * <SEGID> left in place for COPY ... ON SEGMENT to fill in.  Compressed data
+ * files have the extension of their compression type, followed by another
+ * extension if they are encrypted.
+ */
+func GetTableBackupFilePath(oid uint32) string {
+	return GetTableBackupFilePathForTimestamp(oid, DumpTimestamp)
+}
+
+/*
+ * An incremental backup uses the data files of an earlier backup for tables
+ * that have not changed, so restore needs the paths of files in that backup.
+ */
+func GetTableBackupFilePathForTimestamp(oid uint32, timestamp string) string {
+	return fmt.Sprintf("%s/gpbackup_<SEGID>_%s_%d%s%s", GetGenericSegDirForTimestamp(timestamp), timestamp, oid, Compression.Extension, GetEncryptionExtension())
 }
 
 /*
@@ -175,6 +276,9 @@ func SetupSegmentConfiguration(segConfigs []QuerySegConfig) {
 		contentList = append(contentList, seg.Content)
 		segDirMap[seg.Content] = dumpPath
 		segHostMap[seg.Content] = seg.Hostname
+		if seg.Content == -1 {
+			masterDataDir = seg.DataDir
+		}
 	}
 }
 
@@ -190,10 +294,35 @@ func GetDirForContent(content int) string {
 	return segDirMap[content]
 }
 
+func GetMasterDataDir() string {
+	return masterDataDir
+}
+
 /*
  * Returns a segment directory with the BaseDumpDir intact (for use with <SEG_DUMP_DIR>
  * in COPY ... ON SEGMENT), instead of a directory corresponding to a particular segment.
  */
 func GetGenericSegDir() string {
-	return fmt.Sprintf("%s/backups/%s/%s", BaseDumpDir, DumpTimestamp[0:8], DumpTimestamp)
+	return GetGenericSegDirForTimestamp(DumpTimestamp)
+}
+
+func GetGenericSegDirForTimestamp(timestamp string) string {
+	return fmt.Sprintf("%s/backups/%s/%s", BaseDumpDir, timestamp[0:8], timestamp)
+}
+
+/*
+ * Returns the directory on the master containing the directories of every
+ * backup taken to the same base directory as the current backup.
+ */
+func GetMasterBackupsDir() string {
+	return path.Dir(path.Dir(GetDirForContent(-1)))
+}
+
+func GetMasterDirForTimestamp(timestamp string) string {
+	return GetDirForContentAndTimestamp(-1, timestamp)
+}
+
+// Returns the directory of the backup with the given timestamp for a segment, in the base directory of the current backup
+func GetDirForContentAndTimestamp(content int, timestamp string) string {
+	return fmt.Sprintf("%s/%s/%s", path.Dir(path.Dir(GetDirForContent(content))), timestamp[0:8], timestamp)
 }
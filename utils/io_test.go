@@ -56,6 +56,42 @@ var _ = Describe("utils/io tests", func() {
 			utils.MustOpenFile("filename")
 		})
 	})
+	Describe("MustOpenFileForReading", func() {
+		It("opens the file for reading", func() {
+			utils.System.OpenFile = func(name string, flag int, perm os.FileMode) (*os.File, error) { return os.Stdin, nil }
+			defer func() { utils.System.OpenFile = os.OpenFile }()
+			fileHandle := utils.MustOpenFileForReading("filename")
+			Expect(fileHandle).To(Equal(os.Stdin))
+		})
+		It("panics on error", func() {
+			utils.System.OpenFile = func(name string, flag int, perm os.FileMode) (*os.File, error) {
+				return nil, errors.New("No such file or directory")
+			}
+			defer func() { utils.System.OpenFile = os.OpenFile }()
+			defer testutils.ShouldPanicWithMessage("Unable to open file for reading: No such file or directory")
+			utils.MustOpenFileForReading("filename")
+		})
+	})
+	Describe("ReadLinesFromFile", func() {
+		AfterEach(func() {
+			utils.System.OpenFile = os.OpenFile
+		})
+		It("returns each line of the file, skipping blank lines and trimming whitespace", func() {
+			r, w, _ := os.Pipe()
+			w.WriteString("public.foo\n\n  public.\"bar baz\"  \nschema.table\n")
+			w.Close()
+			utils.System.OpenFile = func(name string, flag int, perm os.FileMode) (*os.File, error) { return r, nil }
+			lines := utils.ReadLinesFromFile("filename")
+			Expect(lines).To(Equal([]string{"public.foo", `public."bar baz"`, "schema.table"}))
+		})
+		It("returns an empty list for an empty file", func() {
+			r, w, _ := os.Pipe()
+			w.Close()
+			utils.System.OpenFile = func(name string, flag int, perm os.FileMode) (*os.File, error) { return r, nil }
+			lines := utils.ReadLinesFromFile("filename")
+			Expect(lines).To(BeEmpty())
+		})
+	})
 	Describe("GetSegmentConfiguration", func() {
 		header := []string{"content", "hostname", "datadir"}
 		localSegOne := []driver.Value{"0", "localhost", "/data/gpseg0"}
@@ -132,37 +168,86 @@ var _ = Describe("utils/io tests", func() {
 		})
 	})
 	Describe("CreateDumpDirs", func() {
-		It("creates directories relative to the segment data directory", func() {
-			checkMap := make(map[string]bool, 0)
+		var tempDir string
+		var masterDirs map[string]bool
+		BeforeEach(func() {
+			tempDir, _ = ioutil.TempDir("", "gpbackup_dump_dirs")
+			masterDirs = make(map[string]bool, 0)
 			utils.System.MkdirAll = func(path string, perm os.FileMode) error {
-				checkMap[path] = true
+				masterDirs[path] = true
 				Expect(perm).To(Equal(os.FileMode(0700)))
 				return nil
 			}
-			defer func() { utils.System.MkdirAll = os.MkdirAll }()
-			testutils.SetDefaultSegmentConfiguration()
+			utils.ClusterExecutor = &utils.LocalExecutor{}
+			configMaster := utils.QuerySegConfig{-1, "localhost", tempDir + "/gpseg-1"}
+			configSegOne := utils.QuerySegConfig{0, "localhost", tempDir + "/gpseg0"}
+			configSegTwo := utils.QuerySegConfig{1, "localhost", tempDir + "/gpseg1"}
+			utils.SetupSegmentConfiguration([]utils.QuerySegConfig{configMaster, configSegOne, configSegTwo})
+		})
+		AfterEach(func() {
+			utils.System.MkdirAll = os.MkdirAll
+			utils.ClusterExecutor = &utils.SSHExecutor{}
+			utils.BaseDumpDir = utils.DefaultSegmentDir
+			os.RemoveAll(tempDir)
+		})
+		It("creates directories relative to the segment data directory", func() {
 			utils.CreateDumpDirs()
-			Expect(len(checkMap)).To(Equal(3))
-			Expect(checkMap["/data/gpseg-1/backups/20170101/20170101010101"]).To(BeTrue())
-			Expect(checkMap["/data/gpseg0/backups/20170101/20170101010101"]).To(BeTrue())
-			Expect(checkMap["/data/gpseg1/backups/20170101/20170101010101"]).To(BeTrue())
+			Expect(len(masterDirs)).To(Equal(1))
+			Expect(masterDirs[tempDir+"/gpseg-1/backups/20170101/20170101010101"]).To(BeTrue())
+			for _, segDir := range []string{tempDir + "/gpseg0/backups/20170101/20170101010101", tempDir + "/gpseg1/backups/20170101/20170101010101"} {
+				info, err := os.Stat(segDir)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(info.IsDir()).To(BeTrue())
+				Expect(info.Mode().Perm()).To(Equal(os.FileMode(0700)))
+			}
 		})
 		It("creates directories relative to a user-specified directory", func() {
-			checkMap := make(map[string]bool, 0)
-			utils.System.MkdirAll = func(path string, perm os.FileMode) error {
-				checkMap[path] = true
-				Expect(perm).To(Equal(os.FileMode(0700)))
-				return nil
-			}
-			defer func() { utils.System.MkdirAll = os.MkdirAll; utils.BaseDumpDir = utils.DefaultSegmentDir }()
-			utils.BaseDumpDir = "/tmp/foo"
-			configMaster := utils.QuerySegConfig{-1, "/data/gpseg-1", "localhost"}
-			configSegOne := utils.QuerySegConfig{0, "/data/gpseg0", "localhost"}
-			configSegTwo := utils.QuerySegConfig{1, "/data/gpseg1", "localhost"}
+			utils.BaseDumpDir = tempDir + "/foo"
+			configMaster := utils.QuerySegConfig{-1, "localhost", "/data/gpseg-1"}
+			configSegOne := utils.QuerySegConfig{0, "localhost", "/data/gpseg0"}
+			configSegTwo := utils.QuerySegConfig{1, "localhost", "/data/gpseg1"}
 			utils.SetupSegmentConfiguration([]utils.QuerySegConfig{configMaster, configSegOne, configSegTwo})
 			utils.CreateDumpDirs()
-			Expect(len(checkMap)).To(Equal(1))
-			Expect(checkMap["/tmp/foo/backups/20170101/20170101010101"]).To(BeTrue())
+			Expect(len(masterDirs)).To(Equal(1))
+			Expect(masterDirs[tempDir+"/foo/backups/20170101/20170101010101"]).To(BeTrue())
+			info, err := os.Stat(tempDir + "/foo/backups/20170101/20170101010101")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(info.IsDir()).To(BeTrue())
+		})
+		It("panics if a segment directory cannot be created", func() {
+			ioutil.WriteFile(tempDir+"/gpseg1", []byte{}, 0600)
+			defer testutils.ShouldPanicWithMessage("Unable to create dump directories on 1 segments")
+			utils.CreateDumpDirs()
+		})
+	})
+	Describe("AssertDumpDirsExist", func() {
+		var tempDir string
+		BeforeEach(func() {
+			tempDir, _ = ioutil.TempDir("", "gpbackup_dump_dirs")
+			utils.ClusterExecutor = &utils.LocalExecutor{}
+			configMaster := utils.QuerySegConfig{-1, "localhost", tempDir + "/gpseg-1"}
+			configSegOne := utils.QuerySegConfig{0, "localhost", tempDir + "/gpseg0"}
+			configSegTwo := utils.QuerySegConfig{1, "localhost", tempDir + "/gpseg1"}
+			utils.SetupSegmentConfiguration([]utils.QuerySegConfig{configMaster, configSegOne, configSegTwo})
+			os.MkdirAll(tempDir+"/gpseg-1/backups/20170101/20170101010101", 0700)
+			os.MkdirAll(tempDir+"/gpseg0/backups/20170101/20170101010101", 0700)
+		})
+		AfterEach(func() {
+			utils.ClusterExecutor = &utils.SSHExecutor{}
+			os.RemoveAll(tempDir)
+		})
+		It("does nothing if every dump directory exists", func() {
+			os.MkdirAll(tempDir+"/gpseg1/backups/20170101/20170101010101", 0700)
+			utils.AssertDumpDirsExist()
+		})
+		It("panics if a segment dump directory does not exist", func() {
+			defer testutils.ShouldPanicWithMessage("Dump directories do not exist on 1 segments")
+			utils.AssertDumpDirsExist()
+		})
+		It("panics if the master dump directory does not exist", func() {
+			os.RemoveAll(tempDir + "/gpseg-1")
+			defer testutils.ShouldPanicWithMessage("does not exist")
+			utils.AssertDumpDirsExist()
 		})
 	})
 	Describe("WriteTableMapFile", func() {
@@ -176,10 +261,10 @@ var _ = Describe("utils/io tests", func() {
 			utils.System.OpenFile = func(name string, flag int, perm os.FileMode) (*os.File, error) { filePath = name; return w, nil }
 			defer func() { utils.System.OpenFile = os.OpenFile }()
 			tables := []utils.Relation{tableOne}
-			backup.WriteTableMapFile(tables)
+			backup.WriteTableMapFile(tables, map[uint32]int64{1234: 8192}, map[uint32]string{})
 			w.Close()
 			output, _ := ioutil.ReadAll(r)
-			testutils.ExpectRegex(string(output), `public.foo: 1234
+			testutils.ExpectRegex(string(output), `public.foo: 1234 8192
 `)
 		})
 		It("writes a map file containing multiple tables", func() {
@@ -188,11 +273,46 @@ var _ = Describe("utils/io tests", func() {
 			utils.System.OpenFile = func(name string, flag int, perm os.FileMode) (*os.File, error) { filePath = name; return w, nil }
 			defer func() { utils.System.OpenFile = os.OpenFile }()
 			tables := []utils.Relation{tableOne, tableTwo}
-			backup.WriteTableMapFile(tables)
+			backup.WriteTableMapFile(tables, map[uint32]int64{1234: 8192, 2345: 0}, map[uint32]string{})
+			w.Close()
+			output, _ := ioutil.ReadAll(r)
+			testutils.ExpectRegex(string(output), `public.foo: 1234 8192
+public."foo|bar": 2345 0`)
+		})
+		It("writes the timestamp of the base backup for tables whose data was not dumped", func() {
+			r, w, _ := os.Pipe()
+			utils.System.OpenFile = func(name string, flag int, perm os.FileMode) (*os.File, error) { return w, nil }
+			defer func() { utils.System.OpenFile = os.OpenFile }()
+			tables := []utils.Relation{tableOne, tableTwo}
+			backup.WriteTableMapFile(tables, map[uint32]int64{1234: 8192, 2345: 0}, map[uint32]string{2345: "20161231010101"})
+			w.Close()
+			output, _ := ioutil.ReadAll(r)
+			testutils.ExpectRegex(string(output), `public.foo: 1234 8192
+public."foo|bar": 2345 0 20161231010101
+`)
+		})
+	})
+	Describe("WriteRowCountFile", func() {
+		It("writes the row count of each table that was dumped", func() {
+			testutils.SetDefaultSegmentConfiguration()
+			filePath := ""
+			r, w, _ := os.Pipe()
+			utils.System.OpenFile = func(name string, flag int, perm os.FileMode) (*os.File, error) { filePath = name; return w, nil }
+			defer func() { utils.System.OpenFile = os.OpenFile }()
+			tables := []utils.Relation{{0, 1234, "public", "foo", "", ""}, {0, 2345, "public", "foo|bar", "", ""}, {0, 3456, "public", "baz", "", ""}}
+			backup.WriteRowCountFile(tables, map[uint32]int64{1234: 10, 2345: 0})
 			w.Close()
 			output, _ := ioutil.ReadAll(r)
-			testutils.ExpectRegex(string(output), `public.foo: 1234
-public."foo|bar": 2345`)
+			Expect(filePath).To(Equal("/data/gpseg-1/backups/20170101/20170101010101/gpbackup_20170101010101_row_counts"))
+			Expect(string(output)).To(Equal(`public.foo: 1234 10
+public."foo|bar": 2345 0
+`))
+		})
+	})
+	Describe("GetRowCountFilePathForTimestamp", func() {
+		It("returns the path of the row count file of another backup in the same base directory", func() {
+			testutils.SetDefaultSegmentConfiguration()
+			Expect(utils.GetRowCountFilePathForTimestamp("20161231010101")).To(Equal("/data/gpseg-1/backups/20161231/20161231010101/gpbackup_20161231010101_row_counts"))
 		})
 	})
 	Describe("MustPrintf", func() {
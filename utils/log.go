@@ -9,6 +9,7 @@ import (
 	"io"
 	"log"
 	"os"
+	"sync"
 
 	"github.com/pkg/errors"
 )
@@ -61,6 +62,8 @@ type Logger struct {
 	logFile   *log.Logger
 	verbosity int
 	header    string
+	warnings  []string
+	mutex     sync.Mutex
 }
 
 /*
@@ -129,6 +132,13 @@ func (logger *Logger) SetVerbosity(verbosity int) {
 	logger.verbosity = verbosity
 }
 
+// Returns the messages of every warning logged so far, without their log prefixes
+func (logger *Logger) GetWarnings() []string {
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+	return logger.warnings
+}
+
 /*
  * Log output functions, as described above
  */
@@ -142,6 +152,9 @@ func (logger *Logger) Info(s string, v ...interface{}) {
 }
 
 func (logger *Logger) Warn(s string, v ...interface{}) {
+	logger.mutex.Lock()
+	logger.warnings = append(logger.warnings, fmt.Sprintf(s, v...))
+	logger.mutex.Unlock()
 	message := logger.GetLogPrefix("WARNING") + fmt.Sprintf(s, v...)
 	logger.logFile.Output(1, message)
 	logger.logStdout.Output(1, message)
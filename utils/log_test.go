@@ -124,6 +124,14 @@ var _ = Describe("utils/log tests", func() {
 			Expect(expectedMessage).To(Equal(prefix))
 		})
 	})
+	Describe("GetWarnings", func() {
+		It("returns the messages of the warnings logged so far", func() {
+			logger.Info("not a warning")
+			logger.Warn("first warning")
+			logger.Warn("second warning for table %s", "public.foo")
+			Expect(logger.GetWarnings()).To(Equal([]string{"first warning", "second warning for table public.foo"}))
+		})
+	})
 	Describe("Output function tests", func() {
 		patternExpected := "20170101:01:01:01 testProgram:testUser:testHost:000000-[%s]:-"
 		infoExpected := fmt.Sprintf(patternExpected, "INFO")
@@ -0,0 +1,138 @@
+package utils
+
+/*
+ * This file contains structs and functions related to the manifest file, which
+ * records how a backup was taken and whether it completed, so that gprestore
+ * can check a backup before restoring it.
+ */
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+/*
+ * The gpbackup version is set at build time, e.g. with
+ * -ldflags "-X github.com/greenplum-db/gpbackup/utils.Version=1.0.0".
+ */
+var Version = "dev"
+
+const (
+	BACKUP_STATUS_IN_PROGRESS = "In Progress"
+	BACKUP_STATUS_COMPLETE    = "Complete"
+	BACKUP_STATUS_FAILED      = "Failed"
+	BACKUP_STATUS_CANCELLED   = "Cancelled"
+)
+
+/*
+ * The modification count of an append-optimized table changes whenever its
+ * data does, and the last DDL timestamp changes whenever it is altered or
+ * truncated, so a table whose state is unchanged since an earlier backup has
+ * the same data as in that backup.  For a partitioned table, the state covers
+ * all of its partitions.
+ */
+type AOTableState struct {
+	ModCount         int64
+	LastDDLTimestamp string
+}
+
+/*
+ * StartTime and EndTime are in the same YYYYMMDDHHMMSS format as the backup
+ * timestamp.  Flags holds the value of each flag that was set on the command
+ * line, and SegmentCount does not include the master.  Backups taken before
+ * CompressionType was recorded compressed their data with gzip if they have
+ * a CompressionLevel other than 0.  AOTableStates holds the state of each
+ * append-optimized table in the backup, keyed by the table's FQN, so that
+ * later incremental backups can be based on this one; for an incremental
+ * backup, BaseTimestamp is the timestamp of the full backup it is based on.
+ * TableCount and DataSize are the number and total size in bytes of the tables
+ * whose data was backed up.  Encrypted records whether the backup files were
+ * encrypted; the key itself is never recorded.  Plugin is the executable of
+ * the storage plugin the data files were sent to, if any.
+ */
+type Manifest struct {
+	BackupVersion    string
+	DatabaseName     string
+	DatabaseVersion  string
+	SegmentCount     int
+	Flags            map[string]string
+	CompressionType  string
+	CompressionLevel int
+	Encrypted        bool
+	Plugin           string
+	Incremental      bool
+	BaseTimestamp    string
+	AOTableStates    map[string]AOTableState
+	TableCount       int
+	DataSize         int64
+	StartTime        string
+	EndTime          string
+	Status           string
+}
+
+func GetManifestFilePath() string {
+	return GetManifestFilePathForTimestamp(DumpTimestamp)
+}
+
+func GetManifestFilePathForTimestamp(timestamp string) string {
+	return fmt.Sprintf("%s/gpbackup_%s_manifest.json", GetMasterDirForTimestamp(timestamp), timestamp)
+}
+
+/*
+ * Returns the manifests of every backup in the same base directory as the
+ * current backup, including the current backup if its manifest has been written.
+ */
+func GetBackupManifests() []*Manifest {
+	manifestFilenames, err := System.Glob(fmt.Sprintf("%s/*/*/gpbackup_*_manifest.json", GetMasterBackupsDir()))
+	CheckError(err)
+	manifests := make([]*Manifest, 0)
+	for _, filename := range manifestFilenames {
+		manifests = append(manifests, ReadManifest(filename))
+	}
+	return manifests
+}
+
+/*
+ * The manifest is written once when a backup starts and again when it ends, so
+ * the file is truncated on each write instead of being appended to.
+ */
+func WriteManifest(filename string, manifest *Manifest) {
+	manifestFile, err := System.OpenFile(filename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		logger.Fatal(err, "Unable to create or open manifest file %s", filename)
+	}
+	defer manifestFile.Close()
+	manifestContents, err := json.MarshalIndent(manifest, "", "  ")
+	CheckError(err)
+	MustPrintf(manifestFile, "%s\n", manifestContents)
+}
+
+func ReadManifest(filename string) *Manifest {
+	manifestContents, err := ioutil.ReadAll(MustOpenFileForReading(filename))
+	CheckError(err)
+	manifest := &Manifest{}
+	err = json.Unmarshal(manifestContents, manifest)
+	if err != nil {
+		logger.Fatal(errors.Errorf("Unable to parse manifest file %s: %v", filename, err), "")
+	}
+	return manifest
+}
+
+/*
+ * A backup that did not complete is missing data or metadata, so it cannot be
+ * restored.  A backup taken on a cluster with a different number of segments
+ * can still be restored, but its data files will not all be loaded, so only a
+ * warning is given in that case.
+ */
+func ValidateManifest(manifest *Manifest, segmentCount int) {
+	if manifest.Status != BACKUP_STATUS_COMPLETE {
+		logger.Fatal(errors.Errorf("Backup %s is not complete (status: %s) and cannot be restored", manifest.StartTime, manifest.Status), "")
+	}
+	if manifest.SegmentCount != segmentCount {
+		logger.Warn("Backup was taken on a cluster with %d segments, but the current cluster has %d segments", manifest.SegmentCount, segmentCount)
+	}
+}
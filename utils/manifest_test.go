@@ -0,0 +1,108 @@
+package utils_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/greenplum-db/gpbackup/testutils"
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("utils/manifest tests", func() {
+	var logfile *gbytes.Buffer
+	manifest := &utils.Manifest{
+		BackupVersion:    "1.0.0",
+		DatabaseName:     "testdb",
+		DatabaseVersion:  "PostgreSQL 8.3.23 (Greenplum Database 5.0.0)",
+		SegmentCount:     2,
+		Flags:            map[string]string{"dbname": "testdb", "compression-level": "6"},
+		CompressionLevel: 6,
+		StartTime:        "20170101010101",
+		EndTime:          "20170101010202",
+		Status:           utils.BACKUP_STATUS_COMPLETE,
+	}
+
+	BeforeEach(func() {
+		_, _, _, logfile = testutils.SetupTestLogger()
+	})
+	AfterEach(func() {
+		utils.System.OpenFile = os.OpenFile
+	})
+
+	Describe("GetManifestFilePath", func() {
+		It("returns the path of the manifest file in the master dump directory", func() {
+			testutils.SetDefaultSegmentConfiguration()
+			Expect(utils.GetManifestFilePath()).To(Equal("/data/gpseg-1/backups/20170101/20170101010101/gpbackup_20170101010101_manifest.json"))
+		})
+	})
+	Describe("WriteManifest and ReadManifest", func() {
+		It("writes a manifest file that can be read back in", func() {
+			r, w, _ := os.Pipe()
+			openFlags := 0
+			utils.System.OpenFile = func(name string, flag int, perm os.FileMode) (*os.File, error) { openFlags = flag; return w, nil }
+			utils.WriteManifest("manifest_file", manifest)
+			Expect(openFlags & os.O_TRUNC).To(Equal(os.O_TRUNC))
+			contents, _ := ioutil.ReadAll(r)
+			testutils.ExpectRegex(string(contents), `"Status": "Complete"`)
+
+			r, w, _ = os.Pipe()
+			w.Write(contents)
+			w.Close()
+			utils.System.OpenFile = func(name string, flag int, perm os.FileMode) (*os.File, error) { return r, nil }
+			Expect(utils.ReadManifest("manifest_file")).To(Equal(manifest))
+		})
+		It("panics if the manifest file is not valid", func() {
+			r, w, _ := os.Pipe()
+			w.WriteString("not a manifest")
+			w.Close()
+			utils.System.OpenFile = func(name string, flag int, perm os.FileMode) (*os.File, error) { return r, nil }
+			defer testutils.ShouldPanicWithMessage("Unable to parse manifest file manifest_file")
+			utils.ReadManifest("manifest_file")
+		})
+	})
+	Describe("GetManifestFilePathForTimestamp", func() {
+		It("returns the path of the manifest file of another backup in the same base directory", func() {
+			testutils.SetDefaultSegmentConfiguration()
+			Expect(utils.GetManifestFilePathForTimestamp("20161231010101")).To(Equal("/data/gpseg-1/backups/20161231/20161231010101/gpbackup_20161231010101_manifest.json"))
+		})
+	})
+	Describe("GetBackupManifests", func() {
+		AfterEach(func() {
+			utils.System.Glob = filepath.Glob
+		})
+		It("reads the manifest of each backup in the base directory", func() {
+			testutils.SetDefaultSegmentConfiguration()
+			pattern := ""
+			utils.System.Glob = func(p string) ([]string, error) { pattern = p; return []string{"manifest_file"}, nil }
+			r, w, _ := os.Pipe()
+			w.WriteString(`{"DatabaseName": "testdb", "StartTime": "20161231010101", "Status": "Complete"}`)
+			w.Close()
+			utils.System.OpenFile = func(name string, flag int, perm os.FileMode) (*os.File, error) { return r, nil }
+			manifests := utils.GetBackupManifests()
+			Expect(pattern).To(Equal("/data/gpseg-1/backups/*/*/gpbackup_*_manifest.json"))
+			Expect(len(manifests)).To(Equal(1))
+			Expect(manifests[0].StartTime).To(Equal("20161231010101"))
+		})
+	})
+	Describe("ValidateManifest", func() {
+		It("accepts a complete backup taken on a cluster with the same number of segments", func() {
+			utils.ValidateManifest(manifest, 2)
+			Expect(logfile).ToNot(gbytes.Say("WARNING"))
+		})
+		It("warns if the backup was taken on a cluster with a different number of segments", func() {
+			utils.ValidateManifest(manifest, 4)
+			Expect(logfile).To(gbytes.Say("Backup was taken on a cluster with 2 segments, but the current cluster has 4 segments"))
+		})
+		It("panics if the backup is not complete", func() {
+			incompleteManifest := *manifest
+			incompleteManifest.Status = utils.BACKUP_STATUS_IN_PROGRESS
+			defer testutils.ShouldPanicWithMessage("Backup 20170101010101 is not complete (status: In Progress) and cannot be restored")
+			utils.ValidateManifest(&incompleteManifest, 2)
+		})
+	})
+})
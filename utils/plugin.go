@@ -0,0 +1,106 @@
+package utils
+
+/*
+ * This file contains structs and functions related to storage plugins, which
+ * are executables that send backup files to and retrieve them from storage
+ * other than the local disks of the cluster.
+ */
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+/*
+ * A plugin is called as "<executable> <command> <config file> <arguments>",
+ * where the commands are:
+ * - plugin_api_version: print the version of the plugin protocol
+ * - setup_plugin_for_backup, setup_plugin_for_restore, cleanup_plugin_for_backup,
+ *   and cleanup_plugin_for_restore <backup dir>: prepare for or finish a run
+ * - backup_file <file>: store a local file
+ * - restore_file <file>: retrieve a stored file to its local path
+ * - backup_data <file>: store the data read from stdin under the file's path
+ * - restore_data <file>: write the data stored under the file's path to stdout
+ * The data commands are run on the segments as part of COPY ... PROGRAM and the
+ * others are run on the master, so the executable and config file must exist
+ * at the same paths on every host in the cluster.
+ */
+const PLUGIN_API_VERSION = "0.1.0"
+
+/*
+ * The config file is in JSON.  Options are not interpreted by gpbackup, and
+ * are available to the plugin in the config file passed to every command.
+ */
+type PluginConfig struct {
+	ExecutablePath string            `json:"executablepath"`
+	Options        map[string]string `json:"options"`
+	ConfigPath     string            `json:"-"`
+}
+
+var (
+	// The plugin for the current backup or restore, or nil if the files are on the local disks
+	Plugin *PluginConfig
+)
+
+func ReadPluginConfig(configFile string) *PluginConfig {
+	configContents, err := ioutil.ReadAll(MustOpenFileForReading(configFile))
+	CheckError(err)
+	config := &PluginConfig{}
+	err = json.Unmarshal(configContents, config)
+	if err != nil {
+		logger.Fatal(errors.Errorf("Unable to parse plugin config file %s: %v", configFile, err), "")
+	}
+	if config.ExecutablePath == "" {
+		logger.Fatal(errors.Errorf("Plugin config file %s does not specify an executablepath", configFile), "")
+	}
+	config.ConfigPath = configFile
+	return config
+}
+
+/*
+ * Checks that the plugin can be run and speaks the same version of the plugin
+ * protocol before any files are sent to it.
+ */
+func (plugin *PluginConfig) CheckPluginVersion() {
+	version := strings.TrimSpace(plugin.Execute("plugin_api_version"))
+	if version != PLUGIN_API_VERSION {
+		logger.Fatal(errors.Errorf("Plugin %s uses plugin API version %s, but version %s is required", plugin.ExecutablePath, version, PLUGIN_API_VERSION), "")
+	}
+}
+
+/*
+ * Returns the command line for running a plugin command, for use on the
+ * segments.  The executable, config file, and file arguments are shell-quoted
+ * so that paths containing spaces are passed through as single arguments.
+ */
+func (plugin *PluginConfig) GetCommand(command string, args ...string) string {
+	cmdArgs := []string{ShellQuote(plugin.ExecutablePath), command, ShellQuote(plugin.ConfigPath)}
+	for _, arg := range args {
+		cmdArgs = append(cmdArgs, ShellQuote(arg))
+	}
+	return strings.Join(cmdArgs, " ")
+}
+
+// Runs a plugin command on the master and returns its output
+func (plugin *PluginConfig) Execute(command string, args ...string) string {
+	cmdArgs := append([]string{command, plugin.ConfigPath}, args...)
+	output, err := exec.Command(plugin.ExecutablePath, cmdArgs...).CombinedOutput()
+	if err != nil {
+		logger.Fatal(errors.Errorf("Plugin command %s failed: %s", plugin.GetCommand(command, args...), strings.TrimSpace(string(output))), "")
+	}
+	return string(output)
+}
+
+func (plugin *PluginConfig) BackupFile(filename string) {
+	logger.Verbose("Sending file %s to plugin", filename)
+	plugin.Execute("backup_file", filename)
+}
+
+func (plugin *PluginConfig) RestoreFile(filename string) {
+	logger.Verbose("Retrieving file %s from plugin", filename)
+	plugin.Execute("restore_file", filename)
+}
@@ -0,0 +1,70 @@
+package utils_test
+
+import (
+	"os"
+
+	"github.com/greenplum-db/gpbackup/testutils"
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("utils/plugin tests", func() {
+	plugin := &utils.PluginConfig{ExecutablePath: "/usr/local/bin/example_plugin", ConfigPath: "/home/gpadmin/plugin_config.json"}
+	mockConfigFile := func(contents string) {
+		r, w, _ := os.Pipe()
+		w.WriteString(contents)
+		w.Close()
+		utils.System.OpenFile = func(name string, flag int, perm os.FileMode) (*os.File, error) { return r, nil }
+	}
+
+	BeforeEach(func() {
+		testutils.SetupTestLogger()
+	})
+	AfterEach(func() {
+		utils.System.OpenFile = os.OpenFile
+		utils.Plugin = nil
+		utils.SetCompression("none", 0)
+		utils.EncryptionPassArg = ""
+	})
+
+	Describe("ReadPluginConfig", func() {
+		It("reads the executable and options from the config file", func() {
+			mockConfigFile(`{"executablepath": "/usr/local/bin/example_plugin", "options": {"directory": "/tmp/storage"}}`)
+			config := utils.ReadPluginConfig("/home/gpadmin/plugin_config.json")
+			Expect(config.ExecutablePath).To(Equal("/usr/local/bin/example_plugin"))
+			Expect(config.Options).To(Equal(map[string]string{"directory": "/tmp/storage"}))
+			Expect(config.ConfigPath).To(Equal("/home/gpadmin/plugin_config.json"))
+		})
+		It("panics if the config file is not valid", func() {
+			mockConfigFile("executablepath: /usr/local/bin/example_plugin")
+			defer testutils.ShouldPanicWithMessage("Unable to parse plugin config file plugin_config.json")
+			utils.ReadPluginConfig("plugin_config.json")
+		})
+		It("panics if the config file has no executable", func() {
+			mockConfigFile(`{"options": {"directory": "/tmp/storage"}}`)
+			defer testutils.ShouldPanicWithMessage("Plugin config file plugin_config.json does not specify an executablepath")
+			utils.ReadPluginConfig("plugin_config.json")
+		})
+	})
+	Describe("GetCommand", func() {
+		It("passes the config file and arguments to the plugin command", func() {
+			Expect(plugin.GetCommand("backup_data", "/tmp/file")).To(Equal("'/usr/local/bin/example_plugin' backup_data '/home/gpadmin/plugin_config.json' '/tmp/file'"))
+		})
+	})
+	Describe("GetCopyToTarget and GetCopyFromSource", func() {
+		It("send data to the plugin instead of a file", func() {
+			utils.Plugin = plugin
+			Expect(utils.GetCopyToTarget("/tmp/file")).To(Equal("PROGRAM '''/usr/local/bin/example_plugin'' backup_data ''/home/gpadmin/plugin_config.json'' ''/tmp/file'''"))
+			Expect(utils.GetCopyFromSource("/tmp/file")).To(Equal("PROGRAM '''/usr/local/bin/example_plugin'' restore_data ''/home/gpadmin/plugin_config.json'' ''/tmp/file'''"))
+		})
+		It("send compressed and encrypted data to the plugin", func() {
+			utils.Plugin = plugin
+			utils.SetCompression("gzip", 6)
+			utils.EncryptionPassArg = "env:KEY"
+			Expect(utils.GetCopyToTarget("/tmp/file.gz.enc")).To(Equal("PROGRAM 'gzip -c -6 | openssl enc -aes-256-cbc -pbkdf2 -salt -pass env:KEY | ''/usr/local/bin/example_plugin'' backup_data ''/home/gpadmin/plugin_config.json'' ''/tmp/file.gz.enc'''"))
+			Expect(utils.GetCopyFromSource("/tmp/file.gz.enc")).To(Equal("PROGRAM '''/usr/local/bin/example_plugin'' restore_data ''/home/gpadmin/plugin_config.json'' ''/tmp/file.gz.enc'' | openssl enc -d -aes-256-cbc -pbkdf2 -pass env:KEY | gzip -d -c'"))
+		})
+	})
+})
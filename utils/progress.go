@@ -0,0 +1,248 @@
+package utils
+
+/*
+ * This file contains structs and functions related to reporting the progress
+ * of dumping or loading table data.
+ */
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	progressBarWidth = 30
+)
+
+var (
+	// How often progress is shown when it is drawn as a bar and when it is logged
+	ProgressBarInterval = time.Second
+	ProgressLogInterval = 30 * time.Second
+)
+
+/*
+ * Sizes are the sizes of the tables in the catalog when the data was backed
+ * up, so the number of bytes done is the sum of the sizes of the tables that
+ * are done rather than the number of bytes actually written or read, which can
+ * differ because of compression or because of the data file format.  The
+ * throughput and the ETAs are estimated from those sizes as well.
+ */
+type ProgressReporter struct {
+	operation     string
+	totalTables   int
+	totalBytes    int64
+	tablesDone    int
+	bytesDone     int64
+	startTime     time.Time
+	currentTables map[string]tableProgress
+	output        io.Writer
+	isTerminal    bool
+	mutex         sync.Mutex
+	stop          chan bool
+	done          chan bool
+}
+
+type tableProgress struct {
+	size      int64
+	startTime time.Time
+}
+
+/*
+ * The operation is a verb phrase describing what is done to the tables, such as
+ * "Backing up data", that starts each line of progress output.  Progress is
+ * drawn as a bar if stdout is a terminal and logged periodically otherwise.
+ */
+func NewProgressReporter(operation string, totalTables int, totalBytes int64) *ProgressReporter {
+	return &ProgressReporter{
+		operation:     operation,
+		totalTables:   totalTables,
+		totalBytes:    totalBytes,
+		startTime:     System.Now(),
+		currentTables: make(map[string]tableProgress, 0),
+		output:        os.Stdout,
+		isTerminal:    isTerminal(os.Stdout),
+	}
+}
+
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+/*
+ * Starts showing progress in the background until Stop is called.  No progress
+ * bar is drawn if output is suppressed, and progress log lines are suppressed
+ * along with other Info-level messages.
+ */
+func (progress *ProgressReporter) Start() {
+	useBar := progress.isTerminal && logger.GetVerbosity() >= LOGINFO
+	interval := ProgressLogInterval
+	if useBar {
+		interval = ProgressBarInterval
+	}
+	progress.stop = make(chan bool)
+	progress.done = make(chan bool)
+	go func() {
+		defer close(progress.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-progress.stop:
+				if useBar {
+					MustPrintf(progress.output, "\r%s\n", progress.FormatProgressBar())
+				}
+				return
+			case <-ticker.C:
+				if useBar {
+					MustPrintf(progress.output, "\r%s\033[K", progress.FormatProgressBar())
+				} else {
+					logger.Info(progress.FormatProgress())
+				}
+			}
+		}
+	}()
+}
+
+func (progress *ProgressReporter) Stop() {
+	if progress.stop != nil {
+		close(progress.stop)
+		<-progress.done
+		progress.stop = nil
+	}
+	elapsed := System.Now().Sub(progress.startTime)
+	logger.Info("%s finished: %d of %d tables, %s in %s", progress.operation, progress.tablesDone, progress.totalTables, FormatBytes(progress.bytesDone), formatDuration(elapsed))
+}
+
+func (progress *ProgressReporter) StartTable(tableName string, size int64) {
+	progress.mutex.Lock()
+	defer progress.mutex.Unlock()
+	progress.currentTables[tableName] = tableProgress{size: size, startTime: System.Now()}
+}
+
+// Tables that fail count as done, since no more time will be spent on them
+func (progress *ProgressReporter) FinishTable(tableName string) {
+	progress.mutex.Lock()
+	defer progress.mutex.Unlock()
+	progress.tablesDone++
+	progress.bytesDone += progress.currentTables[tableName].size
+	delete(progress.currentTables, tableName)
+}
+
+/*
+ * Returns the throughput in bytes per second and the estimated time remaining
+ * overall.  The time remaining is estimated from the fraction of bytes done,
+ * or from the fraction of tables done if the tables have no size, and is -1
+ * if nothing is done yet.
+ */
+func (progress *ProgressReporter) getEstimates(now time.Time) (float64, time.Duration) {
+	elapsed := now.Sub(progress.startTime)
+	throughput := float64(0)
+	if elapsed > 0 {
+		throughput = float64(progress.bytesDone) / elapsed.Seconds()
+	}
+	fractionDone := float64(0)
+	if progress.totalBytes > 0 {
+		fractionDone = float64(progress.bytesDone) / float64(progress.totalBytes)
+	} else if progress.totalTables > 0 {
+		fractionDone = float64(progress.tablesDone) / float64(progress.totalTables)
+	}
+	if fractionDone == 0 {
+		return throughput, -1
+	}
+	return throughput, time.Duration(float64(elapsed) * (1 - fractionDone) / fractionDone)
+}
+
+/*
+ * Each table in progress is listed with its own ETA, estimated from its size
+ * and the overall throughput so far, in the order the tables were started.
+ */
+func (progress *ProgressReporter) formatCurrentTables(now time.Time, throughput float64) string {
+	tableNames := make([]string, 0)
+	for tableName := range progress.currentTables {
+		tableNames = append(tableNames, tableName)
+	}
+	sort.Slice(tableNames, func(i int, j int) bool {
+		first, second := progress.currentTables[tableNames[i]], progress.currentTables[tableNames[j]]
+		if first.startTime.Equal(second.startTime) {
+			return tableNames[i] < tableNames[j]
+		}
+		return first.startTime.Before(second.startTime)
+	})
+	tableStrs := make([]string, 0)
+	for _, tableName := range tableNames {
+		table := progress.currentTables[tableName]
+		tableETA := time.Duration(-1)
+		if throughput > 0 {
+			tableETA = time.Duration(float64(table.size)/throughput*float64(time.Second)) - now.Sub(table.startTime)
+			if tableETA < 0 {
+				tableETA = 0
+			}
+		}
+		tableStrs = append(tableStrs, fmt.Sprintf("%s (ETA %s)", tableName, formatDuration(tableETA)))
+	}
+	return strings.Join(tableStrs, ", ")
+}
+
+func (progress *ProgressReporter) formatStatus() string {
+	progress.mutex.Lock()
+	defer progress.mutex.Unlock()
+	now := System.Now()
+	throughput, eta := progress.getEstimates(now)
+	status := fmt.Sprintf("%d/%d tables, %s/%s, %s/s, ETA %s", progress.tablesDone, progress.totalTables, FormatBytes(progress.bytesDone), FormatBytes(progress.totalBytes), FormatBytes(int64(throughput)), formatDuration(eta))
+	if len(progress.currentTables) > 0 {
+		status += fmt.Sprintf(", current: %s", progress.formatCurrentTables(now, throughput))
+	}
+	return status
+}
+
+func (progress *ProgressReporter) getPercentDone() int {
+	progress.mutex.Lock()
+	defer progress.mutex.Unlock()
+	if progress.totalBytes > 0 {
+		return int(progress.bytesDone * 100 / progress.totalBytes)
+	} else if progress.totalTables > 0 {
+		return progress.tablesDone * 100 / progress.totalTables
+	}
+	return 100
+}
+
+// Returns a line of progress suitable for logging
+func (progress *ProgressReporter) FormatProgress() string {
+	return fmt.Sprintf("%s: %d%% done, %s", progress.operation, progress.getPercentDone(), progress.formatStatus())
+}
+
+// Returns a line of progress drawn as a bar, suitable for redrawing on a terminal
+func (progress *ProgressReporter) FormatProgressBar() string {
+	percentDone := progress.getPercentDone()
+	numFilled := percentDone * progressBarWidth / 100
+	bar := strings.Repeat("=", numFilled) + strings.Repeat(" ", progressBarWidth-numFilled)
+	return fmt.Sprintf("%s [%s] %3d%% %s", progress.operation, bar, percentDone, progress.formatStatus())
+}
+
+func FormatBytes(numBytes int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB", "PB"}
+	size := float64(numBytes)
+	unit := 0
+	for size >= 1024 && unit < len(units)-1 {
+		size /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d B", numBytes)
+	}
+	return fmt.Sprintf("%.1f %s", size, units[unit])
+}
+
+// A negative duration means the duration is not known yet
+func formatDuration(duration time.Duration) string {
+	if duration < 0 {
+		return "unknown"
+	}
+	return (duration / time.Second * time.Second).String()
+}
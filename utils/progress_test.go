@@ -0,0 +1,80 @@
+package utils_test
+
+import (
+	"time"
+
+	"github.com/greenplum-db/gpbackup/testutils"
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("utils/progress tests", func() {
+	startTime := time.Date(2017, time.January, 1, 1, 1, 1, 0, time.Local)
+	var progress *utils.ProgressReporter
+	setNow := func(seconds int) {
+		utils.System.Now = func() time.Time { return startTime.Add(time.Duration(seconds) * time.Second) }
+	}
+	BeforeEach(func() {
+		setNow(0)
+		progress = utils.NewProgressReporter("Backing up data", 4, 4*1024*1024)
+	})
+	AfterEach(func() {
+		utils.System.Now = time.Now
+	})
+	Describe("FormatProgress", func() {
+		It("shows an unknown ETA before any tables are done", func() {
+			progress.StartTable("public.foo", 1024*1024)
+			Expect(progress.FormatProgress()).To(Equal("Backing up data: 0% done, 0/4 tables, 0 B/4.0 MB, 0 B/s, ETA unknown, current: public.foo (ETA unknown)"))
+		})
+		It("estimates the throughput and the overall and per-table ETAs from the sizes of the tables done", func() {
+			progress.StartTable("public.foo", 1024*1024)
+			setNow(10)
+			progress.FinishTable("public.foo")
+			progress.StartTable("public.bar", 2*1024*1024)
+			setNow(15)
+			Expect(progress.FormatProgress()).To(Equal("Backing up data: 25% done, 1/4 tables, 1.0 MB/4.0 MB, 68.3 KB/s, ETA 45s, current: public.bar (ETA 25s)"))
+		})
+		It("lists the tables in progress in the order they were started", func() {
+			progress.StartTable("public.foo", 0)
+			setNow(1)
+			progress.StartTable("public.bar", 0)
+			Expect(progress.FormatProgress()).To(HaveSuffix("current: public.foo (ETA unknown), public.bar (ETA unknown)"))
+		})
+		It("estimates the ETA from the number of tables done if the tables have no size", func() {
+			progress = utils.NewProgressReporter("Restoring data", 2, 0)
+			progress.StartTable("public.foo", 0)
+			setNow(10)
+			progress.FinishTable("public.foo")
+			Expect(progress.FormatProgress()).To(Equal("Restoring data: 50% done, 1/2 tables, 0 B/0 B, 0 B/s, ETA 10s"))
+		})
+	})
+	Describe("FormatProgressBar", func() {
+		It("draws a bar filled in proportion to the bytes done", func() {
+			progress.StartTable("public.foo", 2*1024*1024)
+			setNow(10)
+			progress.FinishTable("public.foo")
+			Expect(progress.FormatProgressBar()).To(Equal("Backing up data [===============               ]  50% 1/4 tables, 2.0 MB/4.0 MB, 204.8 KB/s, ETA 10s"))
+		})
+	})
+	Describe("Stop", func() {
+		It("logs a summary of the tables done", func() {
+			_, stdout, _, _ := testutils.SetupTestLogger()
+			progress.StartTable("public.foo", 1024*1024)
+			setNow(61)
+			progress.FinishTable("public.foo")
+			progress.Stop()
+			Expect(stdout).To(gbytes.Say("Backing up data finished: 1 of 4 tables, 1.0 MB in 1m1s"))
+		})
+	})
+	Describe("FormatBytes", func() {
+		It("formats sizes in the largest unit under which they fit", func() {
+			Expect(utils.FormatBytes(0)).To(Equal("0 B"))
+			Expect(utils.FormatBytes(1023)).To(Equal("1023 B"))
+			Expect(utils.FormatBytes(1536)).To(Equal("1.5 KB"))
+			Expect(utils.FormatBytes(3 * 1024 * 1024 * 1024)).To(Equal("3.0 GB"))
+		})
+	})
+})
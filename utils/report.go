@@ -0,0 +1,135 @@
+package utils
+
+/*
+ * This file contains structs and functions related to the report file, a
+ * human-readable summary of a backup written to its directory at the end of
+ * every run, whether or not the backup succeeded.
+ */
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+/*
+ * A phase with no EndTime did not complete, either because it failed or
+ * because an earlier phase failed after it started.
+ */
+type ReportPhase struct {
+	Name      string
+	StartTime time.Time
+	EndTime   time.Time
+}
+
+/*
+ * SegmentSizes contains the total size in bytes of the data files written on
+ * each segment, keyed by content id, and is nil if the sizes are not known,
+ * such as when the data was sent to a plugin or the backup failed before its
+ * data was dumped.  Error is the error that failed the backup, if any.
+ */
+type Report struct {
+	Timestamp    string
+	DatabaseName string
+	DatabaseSize string
+	Flags        map[string]string
+	StartTime    time.Time
+	EndTime      time.Time
+	Phases       []ReportPhase
+	TableCount   int
+	SegmentSizes map[int]int64
+	Warnings     []string
+	Status       string
+	Error        string
+}
+
+func GetReportFilePath() string {
+	return fmt.Sprintf("%s/gpbackup_%s_report", GetDirForContent(-1), DumpTimestamp)
+}
+
+// Ends the phase in progress, if any, and starts the next one
+func (report *Report) StartPhase(name string) {
+	report.EndPhase()
+	report.Phases = append(report.Phases, ReportPhase{Name: name, StartTime: System.Now()})
+}
+
+func (report *Report) EndPhase() {
+	if len(report.Phases) > 0 && report.Phases[len(report.Phases)-1].EndTime.IsZero() {
+		report.Phases[len(report.Phases)-1].EndTime = System.Now()
+	}
+}
+
+func WriteReportFile(filename string, report *Report) {
+	reportFile := MustOpenFile(filename)
+	PrintReport(reportFile, report)
+}
+
+func PrintReport(writer io.Writer, report *Report) {
+	timeFormat := "2006-01-02 15:04:05"
+	MustPrintf(writer, "Greenplum Database Backup Report\n\n")
+	MustPrintf(writer, "Timestamp Key: %s\n", report.Timestamp)
+	MustPrintf(writer, "Database: %s\n", report.DatabaseName)
+	MustPrintf(writer, "Database Size: %s\n", report.DatabaseSize)
+	MustPrintf(writer, "Flags: %s\n", formatReportFlags(report.Flags))
+	MustPrintf(writer, "Start Time: %s\n", report.StartTime.Format(timeFormat))
+	MustPrintf(writer, "End Time: %s\n", report.EndTime.Format(timeFormat))
+	MustPrintf(writer, "Duration: %s\n", formatDuration(report.EndTime.Sub(report.StartTime)))
+	MustPrintf(writer, "Status: %s\n", report.Status)
+	if report.Error != "" {
+		MustPrintf(writer, "Error: %s\n", report.Error)
+	}
+
+	MustPrintf(writer, "\nPhase Durations:\n")
+	for _, phase := range report.Phases {
+		duration := "did not complete"
+		if !phase.EndTime.IsZero() {
+			duration = formatDuration(phase.EndTime.Sub(phase.StartTime))
+		}
+		MustPrintf(writer, "  %s: %s\n", phase.Name, duration)
+	}
+
+	MustPrintf(writer, "\nTable Count: %d\n", report.TableCount)
+	MustPrintf(writer, "\nData Bytes Per Segment:\n")
+	if report.SegmentSizes == nil {
+		MustPrintf(writer, "  Not available\n")
+	} else if len(report.SegmentSizes) == 0 {
+		MustPrintf(writer, "  None\n")
+	} else {
+		contentIDs := make([]int, 0)
+		for contentID := range report.SegmentSizes {
+			contentIDs = append(contentIDs, contentID)
+		}
+		sort.Ints(contentIDs)
+		for _, contentID := range contentIDs {
+			size := report.SegmentSizes[contentID]
+			MustPrintf(writer, "  Segment %d: %d bytes (%s)\n", contentID, size, FormatBytes(size))
+		}
+	}
+
+	MustPrintf(writer, "\nWarnings:\n")
+	if len(report.Warnings) == 0 {
+		MustPrintf(writer, "  None\n")
+	}
+	for _, warning := range report.Warnings {
+		MustPrintf(writer, "  %s\n", warning)
+	}
+}
+
+// Flags are printed in the order of their names, so that the report is the same for the same flags
+func formatReportFlags(flags map[string]string) string {
+	flagNames := make([]string, 0)
+	for name := range flags {
+		flagNames = append(flagNames, name)
+	}
+	sort.Strings(flagNames)
+	flagStrs := make([]string, 0)
+	for _, name := range flagNames {
+		flagStrs = append(flagStrs, fmt.Sprintf("--%s=%s", name, flags[name]))
+	}
+	if len(flagStrs) == 0 {
+		return "None"
+	}
+	return strings.Join(flagStrs, " ")
+}
@@ -0,0 +1,99 @@
+package utils_test
+
+import (
+	"time"
+
+	"github.com/greenplum-db/gpbackup/testutils"
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("utils/report tests", func() {
+	startTime := time.Date(2017, time.January, 1, 1, 1, 1, 0, time.Local)
+	var report *utils.Report
+	var buffer *gbytes.Buffer
+	BeforeEach(func() {
+		buffer = gbytes.NewBuffer()
+		report = &utils.Report{
+			Timestamp:    "20170101010101",
+			DatabaseName: "testdb",
+			DatabaseSize: "1024 MB",
+			Flags:        map[string]string{"jobs": "4", "dbname": "testdb"},
+			StartTime:    startTime,
+			EndTime:      startTime.Add(90 * time.Second),
+			TableCount:   2,
+			Status:       utils.BACKUP_STATUS_COMPLETE,
+		}
+	})
+	AfterEach(func() {
+		utils.System.Now = time.Now
+	})
+	Describe("GetReportFilePath", func() {
+		It("returns the path of the report file in the master backup directory", func() {
+			testutils.SetDefaultSegmentConfiguration()
+			Expect(utils.GetReportFilePath()).To(Equal("/data/gpseg-1/backups/20170101/20170101010101/gpbackup_20170101010101_report"))
+		})
+	})
+	Describe("StartPhase and EndPhase", func() {
+		It("ends each phase when the next one starts", func() {
+			utils.System.Now = func() time.Time { return startTime }
+			report.StartPhase("global")
+			utils.System.Now = func() time.Time { return startTime.Add(time.Second) }
+			report.StartPhase("predata")
+			utils.System.Now = func() time.Time { return startTime.Add(3 * time.Second) }
+			report.EndPhase()
+			Expect(report.Phases).To(Equal([]utils.ReportPhase{
+				{Name: "global", StartTime: startTime, EndTime: startTime.Add(time.Second)},
+				{Name: "predata", StartTime: startTime.Add(time.Second), EndTime: startTime.Add(3 * time.Second)},
+			}))
+		})
+	})
+	Describe("PrintReport", func() {
+		It("prints a report of a successful backup", func() {
+			report.Phases = []utils.ReportPhase{
+				{Name: "global", StartTime: startTime, EndTime: startTime.Add(time.Second)},
+				{Name: "data", StartTime: startTime.Add(time.Second), EndTime: startTime.Add(61 * time.Second)},
+			}
+			report.SegmentSizes = map[int]int64{1: 2048, 0: 1024}
+			report.Warnings = []string{"Skipping data dump of table public.ext because it is an external table."}
+			utils.PrintReport(buffer, report)
+			Expect(string(buffer.Contents())).To(Equal(`Greenplum Database Backup Report
+
+Timestamp Key: 20170101010101
+Database: testdb
+Database Size: 1024 MB
+Flags: --dbname=testdb --jobs=4
+Start Time: 2017-01-01 01:01:01
+End Time: 2017-01-01 01:02:31
+Duration: 1m30s
+Status: Complete
+
+Phase Durations:
+  global: 1s
+  data: 1m0s
+
+Table Count: 2
+
+Data Bytes Per Segment:
+  Segment 0: 1024 bytes (1.0 KB)
+  Segment 1: 2048 bytes (2.0 KB)
+
+Warnings:
+  Skipping data dump of table public.ext because it is an external table.
+`))
+		})
+		It("prints the error and the phase that did not complete for a failed backup", func() {
+			report.Status = utils.BACKUP_STATUS_FAILED
+			report.Error = "Data dump failed for 1 of 2 tables"
+			report.Phases = []utils.ReportPhase{{Name: "data", StartTime: startTime}}
+			utils.PrintReport(buffer, report)
+			Expect(buffer).To(gbytes.Say("Status: Failed\nError: Data dump failed for 1 of 2 tables\n"))
+			Expect(buffer).To(gbytes.Say("  data: did not complete\n"))
+			Expect(buffer).To(gbytes.Say("Data Bytes Per Segment:\n  Not available\n"))
+			Expect(buffer).To(gbytes.Say("Warnings:\n  None\n"))
+		})
+	})
+})
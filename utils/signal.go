@@ -0,0 +1,118 @@
+package utils
+
+/*
+ * This file contains structs and functions related to handling SIGINT and
+ * SIGTERM, so that the queries a run of gpbackup or gprestore has started in
+ * the database are cancelled instead of being left running after it exits.
+ */
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	cancellableConns = make([]*DBConn, 0)
+	cancelMutex      sync.Mutex
+	signalReceived   int32
+
+	errCancelled = errors.New("Query not run because a signal was received")
+)
+
+/*
+ * Looks up the pid of the backend serving the connection, so that its queries
+ * can be cancelled from another connection when a signal is received.  This
+ * must be called while the connection is idle, before it runs any queries that
+ * may need to be cancelled.
+ */
+func MakeCancellable(dbconn *DBConn) {
+	err := dbconn.Get(&dbconn.Pid, "SELECT pg_backend_pid();")
+	CheckError(err)
+	cancelMutex.Lock()
+	defer cancelMutex.Unlock()
+	cancellableConns = append(cancellableConns, dbconn)
+}
+
+// A closed connection's pid may be reused by another session, so it is never cancelled
+func removeCancellable(dbconn *DBConn) {
+	cancelMutex.Lock()
+	defer cancelMutex.Unlock()
+	for i, conn := range cancellableConns {
+		if conn == dbconn {
+			cancellableConns = append(cancellableConns[:i], cancellableConns[i+1:]...)
+			return
+		}
+	}
+}
+
+func (dbconn *DBConn) IsCancelled() bool {
+	return atomic.LoadInt32(&dbconn.cancelled) != 0
+}
+
+func WasSignalReceived() bool {
+	return atomic.LoadInt32(&signalReceived) != 0
+}
+
+/*
+ * Marks every cancellable connection as cancelled, so that it runs no more
+ * queries, and then cancels the query each one is running, if any, using the
+ * given connection.  The queries are cancelled after the connections are marked,
+ * so that a connection cannot start a new query after its query is cancelled.
+ */
+func CancelConnections(sideConn *DBConn) {
+	cancelMutex.Lock()
+	defer cancelMutex.Unlock()
+	for _, conn := range cancellableConns {
+		atomic.StoreInt32(&conn.cancelled, 1)
+	}
+	for _, conn := range cancellableConns {
+		logger.Verbose("Cancelling query of backend %d", conn.Pid)
+		cancelled := false
+		err := sideConn.Get(&cancelled, fmt.Sprintf("SELECT pg_cancel_backend(%d);", conn.Pid))
+		if err != nil {
+			logger.Warn("Unable to cancel query of backend %d: %v", conn.Pid, err)
+		}
+	}
+}
+
+/*
+ * Starts handling SIGINT and SIGTERM in the background.  On the first signal,
+ * the queries of the cancellable connections are cancelled from a new
+ * connection to the given database, which makes them fail, so that the run
+ * fails and DoTeardown cleans up after it as it does for any other error.  A
+ * second signal exits immediately, in case the first one cannot stop the run.
+ */
+func HandleSignals(dbname string) {
+	signalChan := make(chan os.Signal, 2)
+	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signalChan
+		atomic.StoreInt32(&signalReceived, 1)
+		logger.Warn("Received signal %v, cancelling queries", sig)
+		go func() {
+			<-signalChan
+			logger.Warn("Received a second signal, exiting immediately")
+			os.Exit(EXIT_FATAL)
+		}()
+		cancelQueries(dbname)
+	}()
+}
+
+// This runs in its own goroutine, so errors must not be allowed to panic
+func cancelQueries(dbname string) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Warn("Unable to cancel queries: %v", r)
+		}
+	}()
+	sideConn := NewDBConn(dbname)
+	sideConn.Connect()
+	defer sideConn.Close()
+	CancelConnections(sideConn)
+}
@@ -0,0 +1,63 @@
+package utils_test
+
+import (
+	"github.com/greenplum-db/gpbackup/testutils"
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+var _ = Describe("utils/signal tests", func() {
+	var conn, sideConn *utils.DBConn
+	var connMock, sideMock sqlmock.Sqlmock
+	BeforeEach(func() {
+		testutils.SetupTestLogger()
+		conn, connMock = testutils.CreateAndConnectMockDB()
+		sideConn, sideMock = testutils.CreateAndConnectMockDB()
+	})
+	AfterEach(func() {
+		conn.Close()
+		sideConn.Close()
+	})
+	Describe("MakeCancellable", func() {
+		It("records the pid of the backend serving the connection", func() {
+			connMock.ExpectQuery("SELECT pg_backend_pid()").WillReturnRows(sqlmock.NewRows([]string{"pg_backend_pid"}).AddRow(1234))
+			utils.MakeCancellable(conn)
+			Expect(conn.Pid).To(Equal(1234))
+			Expect(conn.IsCancelled()).To(BeFalse())
+		})
+	})
+	Describe("CancelConnections", func() {
+		It("cancels the query of each cancellable connection and stops it from running more queries", func() {
+			connMock.ExpectQuery("SELECT pg_backend_pid()").WillReturnRows(sqlmock.NewRows([]string{"pg_backend_pid"}).AddRow(1234))
+			utils.MakeCancellable(conn)
+			sideMock.ExpectQuery(`SELECT pg_cancel_backend\(1234\);`).WillReturnRows(sqlmock.NewRows([]string{"pg_cancel_backend"}).AddRow(true))
+
+			utils.CancelConnections(sideConn)
+
+			Expect(sideMock.ExpectationsWereMet()).To(Succeed())
+			Expect(conn.IsCancelled()).To(BeTrue())
+			_, err := conn.Exec("SELECT 1")
+			Expect(err).To(MatchError("Query not run because a signal was received"))
+			err = conn.Select(&[]int{}, "SELECT 1")
+			Expect(err).To(MatchError("Query not run because a signal was received"))
+		})
+		It("does not cancel connections that have been closed", func() {
+			connMock.ExpectQuery("SELECT pg_backend_pid()").WillReturnRows(sqlmock.NewRows([]string{"pg_backend_pid"}).AddRow(1234))
+			utils.MakeCancellable(conn)
+			conn.Close()
+
+			utils.CancelConnections(sideConn)
+
+			Expect(sideMock.ExpectationsWereMet()).To(Succeed())
+		})
+		It("does not cancel connections that were not made cancellable", func() {
+			utils.CancelConnections(sideConn)
+
+			Expect(sideMock.ExpectationsWereMet()).To(Succeed())
+			Expect(conn.IsCancelled()).To(BeFalse())
+		})
+	})
+})
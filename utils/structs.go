@@ -8,6 +8,7 @@ package utils
 import (
 	"os"
 	"os/user"
+	"path/filepath"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -44,11 +45,14 @@ type SystemFunctions struct {
 	CurrentUser func() (*user.User, error)
 	Getenv      func(key string) string
 	Getpid      func() int
+	Glob        func(pattern string) ([]string, error)
 	Hostname    func() (string, error)
 	IsNotExist  func(err error) bool
 	MkdirAll    func(path string, perm os.FileMode) error
 	Now         func() time.Time
 	OpenFile    func(name string, flag int, perm os.FileMode) (*os.File, error)
+	Remove      func(name string) error
+	RemoveAll   func(path string) error
 	Stat        func(name string) (os.FileInfo, error)
 }
 
@@ -57,11 +61,14 @@ func InitializeSystemFunctions() *SystemFunctions {
 		CurrentUser: user.Current,
 		Getenv:      os.Getenv,
 		Getpid:      os.Getpid,
+		Glob:        filepath.Glob,
 		Hostname:    os.Hostname,
 		IsNotExist:  os.IsNotExist,
 		MkdirAll:    os.MkdirAll,
 		Now:         time.Now,
 		OpenFile:    os.OpenFile,
+		Remove:      os.Remove,
+		RemoveAll:   os.RemoveAll,
 		Stat:        os.Stat,
 	}
 }
@@ -0,0 +1,105 @@
+package utils
+
+/*
+ * This file contains structs and functions related to the table of contents
+ * (TOC) file, which records where the statements for each object are located
+ * in the metadata files so that objects can be restored selectively.
+ */
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+)
+
+type TOC struct {
+	GlobalEntries   []MetadataEntry
+	PredataEntries  []MetadataEntry
+	PostdataEntries []MetadataEntry
+}
+
+/*
+ * Schema and Name are stored unquoted.  ReferenceObject holds the quoted,
+ * fully-qualified name of the table that an object such as an index or trigger
+ * belongs to, and is empty for objects that don't belong to a table.  The
+ * statements for the object are in the bytes from StartByte up to EndByte.
+ */
+type MetadataEntry struct {
+	Schema          string
+	Name            string
+	ObjectType      string
+	ReferenceObject string
+	StartByte       uint64
+	EndByte         uint64
+}
+
+/*
+ * This struct wraps a metadata file to keep track of how many bytes have been
+ * written to it, which gives the byte offsets of each object in the file.
+ */
+type FileWithByteCount struct {
+	io.Writer
+	ByteCount uint64
+}
+
+func NewFileWithByteCount(writer io.Writer) *FileWithByteCount {
+	return &FileWithByteCount{writer, 0}
+}
+
+func (file *FileWithByteCount) Write(p []byte) (int, error) {
+	bytesWritten, err := file.Writer.Write(p)
+	file.ByteCount += uint64(bytesWritten)
+	return bytesWritten, err
+}
+
+/*
+ * These functions are called after an object's statements have been printed
+ * to the file, so the current byte count of the file is its ending offset.
+ */
+func (toc *TOC) AddGlobalEntry(schema string, name string, objectType string, referenceObject string, start uint64, file *FileWithByteCount) {
+	toc.GlobalEntries = append(toc.GlobalEntries, MetadataEntry{schema, name, objectType, referenceObject, start, file.ByteCount})
+}
+
+func (toc *TOC) AddPredataEntry(schema string, name string, objectType string, referenceObject string, start uint64, file *FileWithByteCount) {
+	toc.PredataEntries = append(toc.PredataEntries, MetadataEntry{schema, name, objectType, referenceObject, start, file.ByteCount})
+}
+
+func (toc *TOC) AddPostdataEntry(schema string, name string, objectType string, referenceObject string, start uint64, file *FileWithByteCount) {
+	toc.PostdataEntries = append(toc.PostdataEntries, MetadataEntry{schema, name, objectType, referenceObject, start, file.ByteCount})
+}
+
+func WriteTOC(filename string, toc *TOC) {
+	tocFile := MustOpenFile(filename)
+	tocContents, err := json.MarshalIndent(toc, "", "  ")
+	CheckError(err)
+	MustPrintf(tocFile, "%s\n", tocContents)
+}
+
+func ReadTOC(filename string) *TOC {
+	tocContents, err := ioutil.ReadAll(MustOpenFileForReading(filename))
+	CheckError(err)
+	toc := &TOC{}
+	err = json.Unmarshal(tocContents, toc)
+	if err != nil {
+		logger.Fatal(errors.Errorf("Unable to parse TOC file %s: %v", filename, err), "")
+	}
+	return toc
+}
+
+/*
+ * Returns the statements for each of the given entries, in the same order as
+ * the entries, from the metadata file the entries were recorded for.
+ */
+func GetMetadataStatements(filename string, entries []MetadataEntry) []string {
+	metadata := ReadMetadataFile(filename)
+	statements := make([]string, 0)
+	for _, entry := range entries {
+		if entry.StartByte > entry.EndByte || entry.EndByte > uint64(len(metadata)) {
+			logger.Fatal(errors.Errorf("Invalid byte range %d-%d for %s %s in metadata file %s", entry.StartByte, entry.EndByte, entry.ObjectType, entry.Name, filename), "")
+		}
+		statements = append(statements, string(metadata[entry.StartByte:entry.EndByte]))
+	}
+	return statements
+}
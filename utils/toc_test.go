@@ -0,0 +1,94 @@
+package utils_test
+
+import (
+	"os"
+
+	"github.com/greenplum-db/gpbackup/testutils"
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("utils/toc tests", func() {
+	var toc *utils.TOC
+	var backupfile *utils.FileWithByteCount
+	mockFile := func(contents string) {
+		r, w, _ := os.Pipe()
+		w.WriteString(contents)
+		w.Close()
+		utils.System.OpenFile = func(name string, flag int, perm os.FileMode) (*os.File, error) { return r, nil }
+	}
+
+	BeforeEach(func() {
+		testutils.SetupTestLogger()
+		toc = &utils.TOC{}
+		backupfile = utils.NewFileWithByteCount(gbytes.NewBuffer())
+	})
+	AfterEach(func() {
+		utils.System.OpenFile = os.OpenFile
+	})
+
+	Describe("FileWithByteCount", func() {
+		It("counts the bytes written to the file", func() {
+			utils.MustPrintf(backupfile, "CREATE SCHEMA foo;")
+			Expect(backupfile.ByteCount).To(Equal(uint64(18)))
+			utils.MustPrintln(backupfile, "CREATE SCHEMA bar;")
+			Expect(backupfile.ByteCount).To(Equal(uint64(37)))
+		})
+	})
+	Describe("AddGlobalEntry", func() {
+		It("adds an entry ending at the current byte count of the file", func() {
+			utils.MustPrintf(backupfile, "CREATE ROLE foo;")
+			toc.AddGlobalEntry("", "foo", "ROLE", "", 0, backupfile)
+			Expect(toc.GlobalEntries).To(Equal([]utils.MetadataEntry{{"", "foo", "ROLE", "", 0, 16}}))
+			Expect(toc.PredataEntries).To(BeEmpty())
+		})
+	})
+	Describe("AddPredataEntry", func() {
+		It("adds an entry ending at the current byte count of the file", func() {
+			utils.MustPrintf(backupfile, "CREATE SCHEMA foo;")
+			start := backupfile.ByteCount
+			utils.MustPrintf(backupfile, "CREATE TABLE foo.bar (i int);")
+			toc.AddPredataEntry("foo", "bar", "TABLE", "", start, backupfile)
+			Expect(toc.PredataEntries).To(Equal([]utils.MetadataEntry{{"foo", "bar", "TABLE", "", 18, 47}}))
+			Expect(toc.PostdataEntries).To(BeEmpty())
+		})
+	})
+	Describe("AddPostdataEntry", func() {
+		It("adds an entry ending at the current byte count of the file", func() {
+			utils.MustPrintf(backupfile, "CREATE INDEX idx ON foo.bar (i);")
+			toc.AddPostdataEntry("foo", "idx", "INDEX", "foo.bar", 0, backupfile)
+			Expect(toc.PostdataEntries).To(Equal([]utils.MetadataEntry{{"foo", "idx", "INDEX", "foo.bar", 0, 32}}))
+			Expect(toc.PredataEntries).To(BeEmpty())
+		})
+	})
+	Describe("ReadTOC", func() {
+		It("reads a TOC file", func() {
+			mockFile(`{"PredataEntries": [{"Schema": "foo", "Name": "bar", "ObjectType": "TABLE", "ReferenceObject": "", "StartByte": 0, "EndByte": 29}], "PostdataEntries": []}`)
+			resultTOC := utils.ReadTOC("toc_file")
+			Expect(resultTOC.PredataEntries).To(Equal([]utils.MetadataEntry{{"foo", "bar", "TABLE", "", 0, 29}}))
+			Expect(resultTOC.PostdataEntries).To(BeEmpty())
+		})
+		It("panics if the TOC file is not valid", func() {
+			mockFile("not a toc")
+			defer testutils.ShouldPanicWithMessage("Unable to parse TOC file toc_file")
+			utils.ReadTOC("toc_file")
+		})
+	})
+	Describe("GetMetadataStatements", func() {
+		It("returns the statements for the given entries in order", func() {
+			mockFile("CREATE SCHEMA foo;CREATE TABLE foo.bar (i int);")
+			entries := []utils.MetadataEntry{{"foo", "bar", "TABLE", "", 18, 47}, {"foo", "foo", "SCHEMA", "", 0, 18}}
+			statements := utils.GetMetadataStatements("predata_file", entries)
+			Expect(statements).To(Equal([]string{"CREATE TABLE foo.bar (i int);", "CREATE SCHEMA foo;"}))
+		})
+		It("panics if an entry is outside of the file", func() {
+			mockFile("CREATE SCHEMA foo;")
+			entries := []utils.MetadataEntry{{"foo", "bar", "TABLE", "", 18, 47}}
+			defer testutils.ShouldPanicWithMessage("Invalid byte range 18-47 for TABLE bar in metadata file predata_file")
+			utils.GetMetadataStatements("predata_file", entries)
+		})
+	})
+})
@@ -14,6 +14,16 @@ var (
 	DumpTimestamp string
 )
 
+/*
+ * These exit codes give the overall status of a run of gpbackup or gprestore, so
+ * that scripts and cron jobs can tell failed runs apart from successful ones.
+ */
+const (
+	EXIT_SUCCESS  = 0
+	EXIT_FATAL    = 1
+	EXIT_WARNINGS = 2
+)
+
 /*
  * Abort() is for handling critical errors.  It panic()s to unwind the call stack
  * until the panic is caught by the recover() in DoTeardown() in backup.go, at
@@ -65,6 +75,25 @@ func SetDumpTimestamp(timestamp string) string {
 	return DumpTimestamp
 }
 
+/*
+ * Returns the string as an escape string constant, which can be put directly
+ * in a query whether or not standard_conforming_strings is on.
+ */
+func QuoteLiteral(literal string) string {
+	return fmt.Sprintf("E'%s'", strings.NewReplacer(`\`, `\\`, `'`, `''`).Replace(literal))
+}
+
+/*
+ * Returns the string in single quotes so that the shell passes it through as a
+ * single word, whatever spaces or metacharacters it contains.  Embedded single
+ * quotes are closed off and double-quoted rather than backslash-escaped, so
+ * that the result can itself be put in a SQL string literal with only its
+ * single quotes doubled.
+ */
+func ShellQuote(str string) string {
+	return fmt.Sprintf("'%s'", strings.Replace(str, "'", `'"'"'`, -1))
+}
+
 // Dollar-quoting logic is based on appendStringLiteralDQ() in pg_dump.
 func DollarQuoteString(literal string) string {
 	delimStr := "_XXXXXXX"
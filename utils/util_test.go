@@ -44,4 +44,23 @@ var _ = Describe("utils/util tests", func() {
 			Expect(actual).To(Equal(expected))
 		})
 	})
+	Context("QuoteLiteral", func() {
+		It("quotes a string with no special characters", func() {
+			Expect(utils.QuoteLiteral("testdb")).To(Equal("E'testdb'"))
+		})
+		It("escapes single quotes and backslashes", func() {
+			Expect(utils.QuoteLiteral(`test'db\; DROP DATABASE postgres; --`)).To(Equal(`E'test''db\\; DROP DATABASE postgres; --'`))
+		})
+	})
+	Context("ShellQuote", func() {
+		It("quotes a string with no special characters", func() {
+			Expect(utils.ShellQuote("/data/backups")).To(Equal("'/data/backups'"))
+		})
+		It("quotes spaces and shell metacharacters", func() {
+			Expect(utils.ShellQuote("/data/my backups; rm -rf $HOME")).To(Equal("'/data/my backups; rm -rf $HOME'"))
+		})
+		It("escapes single quotes", func() {
+			Expect(utils.ShellQuote("/data/gp'backups")).To(Equal(`'/data/gp'"'"'backups'`))
+		})
+	})
 })